@@ -0,0 +1,624 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/l7policies"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/monitors"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/pools"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+var backend = "cli"
+
+// apiCollections the lbaas v2 resources of the api backend and the key of their list responses.
+var apiCollections = map[string]string{
+	"loadbalancer":  "loadbalancers",
+	"listener":      "listeners",
+	"pool":          "pools",
+	"member":        "members",
+	"healthmonitor": "healthmonitors",
+	"l7policy":      "l7policies",
+}
+
+var (
+	// apiRefFlags the flags referring to other objects, sent as the id field with names resolved.
+	apiRefFlags = map[string]struct{ Field, Type string }{
+		"--loadbalancer":  {"loadbalancer_id", "loadbalancer"},
+		"--listener":      {"listener_id", "listener"},
+		"--pool":          {"pool_id", "pool"},
+		"--default-pool":  {"default_pool_id", "pool"},
+		"--redirect-pool": {"redirect_pool_id", "pool"},
+		"--subnet":        {"subnet_id", "subnet"},
+	}
+	// apiRenamedFields the fields of the flags named differently in the API, like --flavor.
+	apiRenamedFields = map[string]string{"flavor": "flavor_id"}
+	apiIntFields     = map[string]bool{
+		"protocol_port": true, "connection_limit": true, "weight": true,
+		"delay": true, "timeout": true, "max_retries": true, "position": true,
+	}
+	// apiBoolFields are sent as json booleans, like --admin-state-up True.
+	apiBoolFields = map[string]bool{"admin_state_up": true}
+	// apiBoolFlags the valueless flags and the admin_state_up they set.
+	apiBoolFlags = map[string]bool{"--admin-state-down": false, "--disable": false, "--enable": true}
+	// apiClientFlags of the neutron client itself, with or without a value, not sent to the API.
+	apiClientFlags = map[string]bool{"--format": true, "-f": true, "--request-format": true, "-c": true, "--column": true}
+
+	uuidRegexp = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// APIResponder is implemented by the executors calling the API, to record the response of the last run.
+type APIResponder interface {
+	LastResponse() (status int, requestID string)
+}
+
+// APIExecutor translates the lbaas-* commands into neutron lbaas v2 API calls with gophercloud,
+// authenticated with keystone v3 from the OS_* environment, again when the token expires.
+type APIExecutor struct {
+	provider *gophercloud.ProviderClient
+	network  *gophercloud.ServiceClient
+	endpoint string
+	recorder *apiRecorder
+}
+
+// apiUnsupportedError is the command not mapped to the API yet.
+type apiUnsupportedError struct {
+	command string
+}
+
+func (e *apiUnsupportedError) Error() string {
+	return fmt.Sprintf("api backend does not support '%s' yet, use --backend cli", e.command)
+}
+
+// apiRecorder records the last neutron call through the provider's transport: its status code, request id,
+// the error response, which gophercloud does not return as is, and the time of a POST/PUT/DELETE call.
+type apiRecorder struct {
+	next http.RoundTripper
+
+	mu        sync.Mutex
+	method    string
+	url       string
+	status    int
+	requestID string
+	errBody   []byte
+	latency   time.Duration
+}
+
+func (r *apiRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	fs := time.Now()
+	resp, err := r.next.RoundTrip(req)
+	if strings.HasSuffix(req.URL.Path, "/auth/tokens") {
+		return resp, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.method, r.url, r.status, r.requestID, r.errBody = req.Method, req.URL.String(), 0, "", nil
+	if req.Method != http.MethodGet {
+		r.latency = time.Since(fs)
+	}
+	if err != nil {
+		return resp, err
+	}
+	r.status, r.requestID = resp.StatusCode, resp.Header.Get("X-Openstack-Request-Id")
+	if resp.StatusCode >= 400 {
+		r.errBody, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(r.errBody))
+	}
+	return resp, nil
+}
+
+func (r *apiRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.method, r.url, r.status, r.requestID, r.errBody, r.latency = "", "", 0, "", nil, 0
+}
+
+// NewAPIExecutor authenticate with keystone and find the network endpoint in the catalog.
+func NewAPIExecutor() (*APIExecutor, error) {
+	authURL := strings.TrimSuffix(env("OS_AUTH_URL", ""), "/")
+	if authURL == "" {
+		return nil, fmt.Errorf("no OS_AUTH_URL environment found")
+	}
+	if !strings.HasSuffix(authURL, "/v3") {
+		if strings.HasSuffix(authURL, "/v2.0") {
+			return nil, fmt.Errorf("api backend supports keystone v3 only, OS_AUTH_URL is %s", authURL)
+		}
+		authURL += "/v3"
+	}
+
+	opts := gophercloud.AuthOptions{
+		IdentityEndpoint: authURL,
+		Username:         env("OS_USERNAME", ""),
+		Password:         env("OS_PASSWORD", ""),
+		DomainID:         env("OS_USER_DOMAIN_ID", ""),
+		AllowReauth:      true,
+	}
+	if opts.DomainID == "" {
+		opts.DomainName = env("OS_USER_DOMAIN_NAME", "Default")
+	}
+	if id := env("OS_PROJECT_ID", env("OS_TENANT_ID", "")); id != "" {
+		opts.Scope = &gophercloud.AuthScope{ProjectID: id}
+	} else {
+		opts.Scope = &gophercloud.AuthScope{
+			ProjectName: env("OS_PROJECT_NAME", env("OS_TENANT_NAME", "")),
+			DomainID:    env("OS_PROJECT_DOMAIN_ID", ""),
+		}
+		if opts.Scope.DomainID == "" {
+			opts.Scope.DomainName = env("OS_PROJECT_DOMAIN_NAME", "Default")
+		}
+	}
+	provider, err := openstack.NewClient(authURL)
+	if err != nil {
+		return nil, err
+	}
+	recorder := &apiRecorder{next: NeutronTransport()}
+	provider.HTTPClient = http.Client{Timeout: 5 * time.Minute, Transport: recorder}
+	if err := openstack.Authenticate(provider, opts); err != nil {
+		return nil, fmt.Errorf("keystone authentication failed: %s", err.Error())
+	}
+
+	iface := strings.TrimSuffix(env("OS_INTERFACE", env("OS_ENDPOINT_TYPE", "public")), "URL")
+	network, err := openstack.NewNetworkV2(provider, gophercloud.EndpointOpts{
+		Region:       env("OS_REGION_NAME", ""),
+		Availability: gophercloud.Availability(iface),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no %s network endpoint found in the catalog: %s", iface, err.Error())
+	}
+	return &APIExecutor{
+		provider: provider,
+		network:  network,
+		endpoint: strings.TrimSuffix(network.ResourceBase, "/"),
+		recorder: recorder,
+	}, nil
+}
+
+func env(name string, defaultValue string) string {
+	if v, ok := LookupEnv(name); ok && v != "" {
+		return v
+	}
+	return defaultValue
+}
+
+// APILatency get the time of the POST/PUT/DELETE call of the last run.
+func (ae *APIExecutor) APILatency() time.Duration {
+	ae.recorder.mu.Lock()
+	defer ae.recorder.mu.Unlock()
+	return ae.recorder.latency
+}
+
+// LastResponse get the HTTP status code and x-openstack-request-id of the last run.
+func (ae *APIExecutor) LastResponse() (int, string) {
+	ae.recorder.mu.Lock()
+	defer ae.recorder.mu.Unlock()
+	return ae.recorder.status, ae.recorder.requestID
+}
+
+// Run translate the command into the API call and return the response like 'neutron ... --format json'.
+// Subcommands not mapped fail with exit code 2, API and name resolution errors with exit code 1.
+func (ae *APIExecutor) Run(ctx context.Context, argv []string) (string, string, int, error) {
+	ae.recorder.reset()
+	if HasCommandEnv(ctx) {
+		err := &apiUnsupportedError{"per-command environment overrides"}
+		return "", err.Error(), 2, err
+	}
+	ae.provider.Context = ctx
+	defer func() { ae.provider.Context = nil }()
+
+	out, err := ae.call(argv)
+	if _, ok := err.(*apiUnsupportedError); ok {
+		return "", err.Error(), 2, err
+	}
+
+	r := ae.recorder
+	r.mu.Lock()
+	stderr := ""
+	if r.method != "" {
+		stderr = fmt.Sprintf("%s call to network for %s used request id %s\n", r.method, r.url, r.requestID)
+	}
+	status, errBody := r.status, r.errBody
+	r.mu.Unlock()
+
+	if err != nil {
+		if status >= 400 {
+			return "", stderr + string(errBody), 1, fmt.Errorf("HTTP %d", status)
+		}
+		return "", stderr + err.Error(), 1, err
+	}
+	return out, stderr, 0, nil
+}
+
+// apiCommand is a lbaas-* command parsed for the API call.
+type apiCommand struct {
+	subcmd     string
+	resource   string
+	operation  string
+	flags      map[string]string
+	positional []string
+}
+
+// parseAPICommand split the lbaas-<resource>-<operation> command into its flags and positional arguments.
+func parseAPICommand(argv []string) (*apiCommand, error) {
+	subcmd, i := "", 0
+	for i = range argv {
+		if strings.HasPrefix(argv[i], "lbaas-") {
+			subcmd = argv[i]
+			break
+		}
+	}
+	subs := strings.Split(subcmd, "-")
+	if len(subs) != 3 {
+		return nil, &apiUnsupportedError{strings.Join(argv, " ")}
+	}
+	if _, ok := apiCollections[subs[1]]; !ok {
+		return nil, &apiUnsupportedError{subcmd}
+	}
+
+	cmd := &apiCommand{subcmd: subcmd, resource: subs[1], operation: subs[2], flags: map[string]string{}}
+	args := argv[i+1:]
+	for j := 0; j < len(args); j++ {
+		n := args[j]
+		if !strings.HasPrefix(n, "-") {
+			cmd.positional = append(cmd.positional, n)
+			continue
+		}
+		if kv := strings.SplitN(n, "=", 2); len(kv) == 2 {
+			cmd.flags[kv[0]] = kv[1]
+			continue
+		}
+		if _, ok := apiBoolFlags[n]; ok || n == "--debug" {
+			cmd.flags[n] = ""
+			continue
+		}
+		if j+1 < len(args) {
+			cmd.flags[n] = args[j+1]
+			j++
+		}
+	}
+	return cmd, nil
+}
+
+// call run the command with the lbaas_v2 client of gophercloud, and get the object or the objects in json.
+func (ae *APIExecutor) call(argv []string) (string, error) {
+	cmd, err := parseAPICommand(argv)
+	if err != nil {
+		return "", err
+	}
+	switch cmd.operation {
+	case "list", "show", "delete", "create", "update":
+	default:
+		return "", &apiUnsupportedError{cmd.subcmd}
+	}
+
+	pool := ""
+	if cmd.resource == "member" {
+		// lbaas-member-create ... POOL, lbaas-member-show MEMBER POOL
+		if len(cmd.positional) == 0 {
+			return "", fmt.Errorf("no pool in %s", cmd.subcmd)
+		}
+		if pool, err = ae.resolve("pool", "", cmd.positional[len(cmd.positional)-1]); err != nil {
+			return "", err
+		}
+		cmd.positional = cmd.positional[:len(cmd.positional)-1]
+	}
+
+	if cmd.operation == "list" {
+		objs, err := ae.list(cmd.resource, pool, cmd.flags["--name"])
+		if err != nil {
+			return "", err
+		}
+		jd, _ := json.Marshal(objs)
+		return string(jd), nil
+	}
+
+	if cmd.operation == "create" {
+		body, err := ae.body(cmd)
+		if err != nil {
+			return "", err
+		}
+		if cmd.resource == "loadbalancer" {
+			// lbaas-loadbalancer-create ... VIP_SUBNET
+			if len(cmd.positional) == 0 {
+				return "", fmt.Errorf("no vip subnet in %s", cmd.subcmd)
+			}
+			if body["vip_subnet_id"], err = ae.resolve("subnet", "", cmd.positional[0]); err != nil {
+				return "", err
+			}
+		}
+		return ae.create(cmd, pool, body)
+	}
+
+	if len(cmd.positional) == 0 {
+		return "", fmt.Errorf("no %s in %s", cmd.resource, cmd.subcmd)
+	}
+	id, err := ae.resolve(cmd.resource, pool, cmd.positional[0])
+	if err != nil {
+		return "", err
+	}
+	switch cmd.operation {
+	case "show":
+		return ae.get(cmd.resource, pool, id)
+	case "delete":
+		return fmt.Sprintf("Deleted %s: %s\n", cmd.resource, id), ae.delete(cmd.resource, pool, id)
+	}
+	body, err := ae.body(cmd)
+	if err != nil {
+		return "", err
+	}
+	return ae.update(cmd, pool, id, body)
+}
+
+// body translate the flags of the create or update command into the fields of the request body.
+func (ae *APIExecutor) body(cmd *apiCommand) (map[string]interface{}, error) {
+	body := map[string]interface{}{}
+	for flag, v := range cmd.flags {
+		if apiClientFlags[flag] || flag == "--debug" {
+			continue
+		}
+		if up, ok := apiBoolFlags[flag]; ok {
+			body["admin_state_up"] = up
+			continue
+		}
+		if ref, ok := apiRefFlags[flag]; ok {
+			id, err := ae.resolve(ref.Type, "", v)
+			if err != nil {
+				return nil, err
+			}
+			body[ref.Field] = id
+			continue
+		}
+		field := strings.ReplaceAll(strings.TrimLeft(flag, "-"), "-", "_")
+		if renamed, ok := apiRenamedFields[field]; ok {
+			field = renamed
+		}
+		switch {
+		case field == "session_persistence":
+			sp := map[string]string{}
+			for _, kv := range strings.Split(v, ",") {
+				if p := strings.SplitN(kv, "=", 2); len(p) == 2 {
+					sp[p[0]] = p[1]
+				}
+			}
+			body[field] = sp
+		case apiIntFields[field]:
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", flag, v)
+			}
+			body[field] = n
+		case apiBoolFields[field]:
+			b, err := strconv.ParseBool(strings.ToLower(v))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", flag, v)
+			}
+			body[field] = b
+		default:
+			body[field] = v
+		}
+	}
+	return body, nil
+}
+
+// decodeOpts fill in the create or update options of gophercloud with the body, by their json fields.
+// The fields the options do not have are not supported.
+func decodeOpts(cmd *apiCommand, body map[string]interface{}, opts interface{}) error {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(opts).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		fields[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	for field := range body {
+		if !fields[field] {
+			return &apiUnsupportedError{fmt.Sprintf("%s --%s", cmd.subcmd, strings.ReplaceAll(field, "_", "-"))}
+		}
+	}
+	jd, _ := json.Marshal(body)
+	if err := json.Unmarshal(jd, opts); err != nil {
+		return fmt.Errorf("invalid arguments of %s: %s", cmd.subcmd, err.Error())
+	}
+	return nil
+}
+
+// objectOf get the object in the response of gophercloud, like 'neutron ... --format json' shows.
+func objectOf(r gophercloud.Result, resource string) (string, error) {
+	if r.Err != nil {
+		return "", r.Err
+	}
+	var v interface{} = r.Body
+	if m, ok := r.Body.(map[string]interface{}); ok {
+		if obj, ok := m[resource]; ok {
+			v = obj
+		}
+	}
+	jd, _ := json.Marshal(v)
+	return string(jd), nil
+}
+
+func (ae *APIExecutor) create(cmd *apiCommand, pool string, body map[string]interface{}) (string, error) {
+	c := ae.network
+	switch cmd.resource {
+	case "loadbalancer":
+		opts := loadbalancers.CreateOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(loadbalancers.Create(c, opts).Result, cmd.resource)
+	case "listener":
+		opts := listeners.CreateOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(listeners.Create(c, opts).Result, cmd.resource)
+	case "pool":
+		opts := pools.CreateOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(pools.Create(c, opts).Result, cmd.resource)
+	case "member":
+		opts := pools.CreateMemberOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(pools.CreateMember(c, pool, opts).Result, cmd.resource)
+	case "healthmonitor":
+		opts := monitors.CreateOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(monitors.Create(c, opts).Result, cmd.resource)
+	default:
+		opts := l7policies.CreateOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(l7policies.Create(c, opts).Result, cmd.resource)
+	}
+}
+
+func (ae *APIExecutor) update(cmd *apiCommand, pool string, id string, body map[string]interface{}) (string, error) {
+	c := ae.network
+	switch cmd.resource {
+	case "loadbalancer":
+		opts := loadbalancers.UpdateOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(loadbalancers.Update(c, id, opts).Result, cmd.resource)
+	case "listener":
+		opts := listeners.UpdateOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(listeners.Update(c, id, opts).Result, cmd.resource)
+	case "pool":
+		opts := pools.UpdateOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(pools.Update(c, id, opts).Result, cmd.resource)
+	case "member":
+		opts := pools.UpdateMemberOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(pools.UpdateMember(c, pool, id, opts).Result, cmd.resource)
+	case "healthmonitor":
+		opts := monitors.UpdateOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(monitors.Update(c, id, opts).Result, cmd.resource)
+	default:
+		opts := l7policies.UpdateOpts{}
+		if err := decodeOpts(cmd, body, &opts); err != nil {
+			return "", err
+		}
+		return objectOf(l7policies.Update(c, id, opts).Result, cmd.resource)
+	}
+}
+
+func (ae *APIExecutor) get(resource string, pool string, id string) (string, error) {
+	c := ae.network
+	switch resource {
+	case "loadbalancer":
+		return objectOf(loadbalancers.Get(c, id).Result, resource)
+	case "listener":
+		return objectOf(listeners.Get(c, id).Result, resource)
+	case "pool":
+		return objectOf(pools.Get(c, id).Result, resource)
+	case "member":
+		return objectOf(pools.GetMember(c, pool, id).Result, resource)
+	case "healthmonitor":
+		return objectOf(monitors.Get(c, id).Result, resource)
+	default:
+		return objectOf(l7policies.Get(c, id).Result, resource)
+	}
+}
+
+func (ae *APIExecutor) delete(resource string, pool string, id string) error {
+	c := ae.network
+	switch resource {
+	case "loadbalancer":
+		return loadbalancers.Delete(c, id).ExtractErr()
+	case "listener":
+		return listeners.Delete(c, id).ExtractErr()
+	case "pool":
+		return pools.Delete(c, id).ExtractErr()
+	case "member":
+		return pools.DeleteMember(c, pool, id).ExtractErr()
+	case "healthmonitor":
+		return monitors.Delete(c, id).ExtractErr()
+	default:
+		return l7policies.Delete(c, id).ExtractErr()
+	}
+}
+
+// list get the objects of the resource, all pages of them, with the name if given.
+func (ae *APIExecutor) list(resource string, pool string, name string) ([]interface{}, error) {
+	c := ae.network
+	var pager pagination.Pager
+	collection := apiCollections[resource]
+	switch resource {
+	case "loadbalancer":
+		pager = loadbalancers.List(c, loadbalancers.ListOpts{Name: name})
+	case "listener":
+		pager = listeners.List(c, listeners.ListOpts{Name: name})
+	case "pool":
+		pager = pools.List(c, pools.ListOpts{Name: name})
+	case "member":
+		pager = pools.ListMembers(c, pool, pools.ListMembersOpts{Name: name})
+	case "healthmonitor":
+		pager = monitors.List(c, monitors.ListOpts{Name: name})
+	case "l7policy":
+		pager = l7policies.List(c, l7policies.ListOpts{Name: name})
+	case "subnet":
+		pager, collection = subnets.List(c, subnets.ListOpts{Name: name}), "subnets"
+	default:
+		return nil, &apiUnsupportedError{"lbaas-" + resource + "-list"}
+	}
+
+	objs := []interface{}{}
+	err := pager.EachPage(func(page pagination.Page) (bool, error) {
+		body, _ := page.GetBody().(map[string]interface{})
+		items, _ := body[collection].([]interface{})
+		objs = append(objs, items...)
+		return true, nil
+	})
+	return objs, err
+}
+
+// resolve get the id of the object by name, with a list call. Ids are returned as is.
+func (ae *APIExecutor) resolve(resource string, pool string, idOrName string) (string, error) {
+	if uuidRegexp.MatchString(idOrName) {
+		return idOrName, nil
+	}
+	objs, err := ae.list(resource, pool, idOrName)
+	if err != nil {
+		return "", err
+	}
+	if len(objs) != 1 {
+		return "", fmt.Errorf("Unable to find %s with name '%s': %d found", resource, idOrName, len(objs))
+	}
+	obj, _ := objs[0].(map[string]interface{})
+	id, _ := obj["id"].(string)
+	return id, nil
+}
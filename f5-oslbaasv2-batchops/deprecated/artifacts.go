@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var (
+	artifactsDir  string
+	omitRawOutput bool
+
+	// runArtifactsDir is the directory of this run in --artifacts-dir, named by the start time and run id.
+	runArtifactsDir string
+)
+
+// CommandArtifacts is the files of a command in the run directory of --artifacts-dir.
+type CommandArtifacts struct {
+	Command string `json:"command"`
+	Stdout  string `json:"stdout"`
+	Stderr  string `json:"stderr"`
+}
+
+// RunArtifact is the run.json in the run directory.
+type RunArtifact struct {
+	Metadata *RunMetadata `json:"metadata"`
+	Summary  *Summary     `json:"summary"`
+}
+
+// CreateRunArtifactsDir create the directory of this run in --artifacts-dir.
+func CreateRunArtifactsDir() error {
+	dir := filepath.Join(artifactsDir, fmt.Sprintf("%s-%s", runMeta.StartedAt.Format("20060102-150405"), runMeta.RunID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	runArtifactsDir = dir
+	logger.Printf("%20s: %s", "Artifacts Dir", runArtifactsDir)
+	return nil
+}
+
+// WriteArtifacts write the command, stdout and stderr of the command to NNN-command.txt, NNN-stdout.json
+// and NNN-stderr.txt, and drop the output from the result with --omit-raw-output.
+func (cmdctx *CommandContext) WriteArtifacts() {
+	prefix := filepath.Join(runArtifactsDir, fmt.Sprintf("%03d", cmdctx.Seq))
+	artifacts := &CommandArtifacts{prefix + "-command.txt", prefix + "-stdout.json", prefix + "-stderr.txt"}
+	for _, n := range []struct {
+		path    string
+		content string
+	}{{artifacts.Command, cmdctx.Command + "\n"}, {artifacts.Stdout, cmdctx.RawOut}, {artifacts.Stderr, cmdctx.Stderr}} {
+		if err := ioutil.WriteFile(n.path, []byte(n.content), 0644); err != nil {
+			logger.Printf("Command(%d/%d): Failed to write artifact: %s", cmdctx.Seq, len(cmdList), err.Error())
+			return
+		}
+	}
+	cmdctx.Artifacts = artifacts
+
+	if omitRawOutput && cmdctx.RawOut != "" {
+		cmdctx.RawOutBytes = len(cmdctx.RawOut)
+		cmdctx.RawOut = ""
+		cmdctx.Parsed = nil
+	}
+}
+
+// WriteRunArtifact write the metadata and summary of the run to run.json in the run directory.
+func WriteRunArtifact() {
+	path := filepath.Join(runArtifactsDir, "run.json")
+	jd, _ := json.MarshalIndent(RunArtifact{runMeta, NewSummary(cmdResults.Sorted())}, "", "  ")
+	if err := ioutil.WriteFile(path, append(jd, '\n'), 0644); err != nil {
+		logger.Printf("Failed to write %s: %s", path, err.Error())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	assertExprs RepeatedFlag
+	assertFile  string
+	assertions  []Assertion
+)
+
+// Assertion expects a field of the json output to be the value. Filter, if any, selects the
+// commands to check; otherwise every command with a json object output is checked.
+type Assertion struct {
+	Filter   *regexp.Regexp
+	Path     string
+	Expected interface{}
+}
+
+// ParseAssertion parse field=value, the field can be a dotted path like listeners.0.id.
+// The value is a json literal, or a plain string if not.
+func ParseAssertion(expr string) (Assertion, error) {
+	kv := strings.SplitN(expr, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return Assertion{}, fmt.Errorf("invalid assertion %s, expect field=value", expr)
+	}
+	return Assertion{Path: strings.TrimSpace(kv[0]), Expected: parseAssertValue(kv[1])}, nil
+}
+
+func parseAssertValue(s string) interface{} {
+	var v interface{}
+	if json.Unmarshal([]byte(s), &v) == nil {
+		return v
+	}
+	return s
+}
+
+// LoadAssertFile read the assertions mapping the command regexps to the expected field values, like
+// {"lbaas-listener-create": {"protocol_port": 80}, "lbaas-loadbalancer-show": {"admin_state_up": true}}.
+func LoadAssertFile(path string) ([]Assertion, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]map[string]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	filters := []string{}
+	for k := range m {
+		filters = append(filters, k)
+	}
+	sort.Strings(filters)
+
+	asserts := []Assertion{}
+	for _, f := range filters {
+		reg, err := regexp.Compile(f)
+		if err != nil {
+			return nil, err
+		}
+		fields := []string{}
+		for k := range m[f] {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		for _, k := range fields {
+			asserts = append(asserts, Assertion{reg, k, m[f][k]})
+		}
+	}
+	return asserts, nil
+}
+
+// FieldOf get the field by the dotted path, array elements are addressed by index.
+func FieldOf(doc interface{}, path string) (interface{}, bool) {
+	v := doc
+	for _, k := range strings.Split(path, ".") {
+		switch n := v.(type) {
+		case map[string]interface{}:
+			fv, ok := n[k]
+			if !ok {
+				return nil, false
+			}
+			v = fv
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, false
+			}
+			v = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Assert check the output of the successful command. Failed assertions fail the command with
+// the expected and actual values in Err, the failure class Assertion.
+func (cmdctx *CommandContext) Assert(asserts []Assertion) {
+	doc := cmdctx.Parsed
+	if doc == nil {
+		_ = json.Unmarshal([]byte(cmdctx.RawOut), &doc)
+	}
+	_, isObject := doc.(map[string]interface{})
+
+	failures := []string{}
+	for _, a := range asserts {
+		if a.Filter != nil && !a.Filter.MatchString(cmdctx.Command) {
+			continue
+		}
+		if !isObject {
+			if a.Filter != nil {
+				failures = append(failures, fmt.Sprintf("%s: output is not a json object", a.Path))
+			}
+			continue
+		}
+		actual, ok := FieldOf(doc, a.Path)
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: expected %s, got nothing", a.Path, jsonString(a.Expected)))
+			continue
+		}
+		if !reflect.DeepEqual(a.Expected, actual) {
+			failures = append(failures, fmt.Sprintf("%s: expected %s, got %s", a.Path, jsonString(a.Expected), jsonString(actual)))
+		}
+	}
+	if len(failures) == 0 {
+		return
+	}
+	cmdctx.ExitCode = 1
+	cmdctx.FailureClass = "Assertion"
+	cmdctx.Err = "assertion failed: " + strings.Join(failures, "; ")
+}
+
+func jsonString(v interface{}) string {
+	jd, _ := json.Marshal(v)
+	return string(jd)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+var (
+	auditHash    bool
+	auditHMACKey string
+	verifyFile   string
+)
+
+// auditRecord is the part of a result covered by the audit hash, as written to the output file.
+type auditRecord struct {
+	Seq       int    `json:"seqnum"`
+	Command   string `json:"command"`
+	RawOut    string `json:"output"`
+	ExitCode  int    `json:"exitcode"`
+	Duration  int64  `json:"duration"`
+	AuditHash string `json:"audit_hash"`
+}
+
+func (r auditRecord) hash(key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%d|%s|%d|%d|%s", r.Seq, r.Command, r.ExitCode, r.Duration, r.RawOut)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ComputeAuditHash compute the HMAC-SHA256 of the command result.
+// Duration is in milliseconds, the same as in the output file.
+func (cmdctx *CommandContext) ComputeAuditHash(key string) string {
+	return auditRecord{
+		Seq:      cmdctx.Seq,
+		Command:  cmdctx.Command,
+		RawOut:   cmdctx.RawOut,
+		ExitCode: cmdctx.ExitCode,
+		Duration: cmdctx.Duration.Milliseconds(),
+	}.hash(key)
+}
+
+// readAuditRecords read the result file in json, legacy or jsonl format.
+func readAuditRecords(path string) ([]auditRecord, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []auditRecord{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err := json.Unmarshal(data, &records)
+		return records, err
+	}
+	output := struct {
+		Results []auditRecord `json:"results"`
+	}{}
+	if json.Unmarshal(data, &output) == nil && output.Results != nil {
+		return output.Results, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		r := auditRecord{}
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// VerifyAudit re-compute the audit hashes of the result file and compare.
+// Returns the exit code: 0 if all hashes match.
+func VerifyAudit() int {
+	defer outputFile.Close()
+
+	if verifyFile == "" || auditHMACKey == "" {
+		logger.Printf("verify-audit mode requires --verify-file and --audit-hmac-key")
+		return 1
+	}
+
+	records, err := readAuditRecords(verifyFile)
+	if err != nil {
+		logger.Printf("Failed to read result file %s: %s", verifyFile, err.Error())
+		return 1
+	}
+
+	mismatched := 0
+	for _, r := range records {
+		expected := r.hash(auditHMACKey)
+		if !hmac.Equal([]byte(expected), []byte(r.AuditHash)) {
+			mismatched++
+			logger.Printf("Command(%d): audit hash mismatched: %s", r.Seq, r.Command)
+		}
+	}
+	logger.Printf("Verified %d record(s) in %s, %d mismatched", len(records), verifyFile, mismatched)
+
+	if mismatched > 0 {
+		return 1
+	}
+	return 0
+}
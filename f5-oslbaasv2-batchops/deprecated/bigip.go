@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	bigipHost            string
+	bigipUsername        string
+	bigipPassword        string
+	bigipCredentialsFile string
+	bigipInsecure        bool
+	bigipEnvPrefix       = "Project"
+	bigipTimeout         = 30 * time.Second
+)
+
+// bigipMonitorTypes map the healthmonitor types to the iControl REST monitor paths.
+var bigipMonitorTypes = map[string]string{"HTTP": "http", "HTTPS": "https", "TCP": "tcp", "PING": "gateway-icmp"}
+
+// BIGIPCredentials is the --bigip-credentials-file content.
+type BIGIPCredentials struct {
+	Host     string `json:"host"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoadBIGIPCredentials fill the BIG-IP flags not given from the credentials file.
+func LoadBIGIPCredentials(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var creds BIGIPCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return err
+	}
+	for _, n := range []struct {
+		flag  *string
+		value string
+	}{{&bigipHost, creds.Host}, {&bigipUsername, creds.Username}, {&bigipPassword, creds.Password}} {
+		if *n.flag == "" {
+			*n.flag = n.value
+		}
+	}
+	return nil
+}
+
+// BIGIPVerifiable tells the command creates or deletes an object deployed to the BIG-IP by the agent.
+func (cmdctx *CommandContext) BIGIPVerifiable() bool {
+	switch cmdctx.ResourceType {
+	case "listener", "pool", "member", "healthmonitor":
+		return cmdctx.OperationType == "create" || cmdctx.OperationType == "delete"
+	}
+	return false
+}
+
+// BIGIPName get the name of the object deployed by the agent: <environment prefix>_<id>.
+func BIGIPName(id string) string {
+	return bigipEnvPrefix + "_" + id
+}
+
+// BIGIPPath get the iControl REST path of the object, from its neutron attributes. For members,
+// the path of the members of the pool is returned.
+func BIGIPPath(resourceType string, obj map[string]interface{}, poolID string) (string, error) {
+	tenant, _ := obj["tenant_id"].(string)
+	if tenant == "" {
+		tenant, _ = obj["project_id"].(string)
+	}
+	id, _ := obj["id"].(string)
+	if tenant == "" || id == "" {
+		return "", fmt.Errorf("no id or tenant_id of %s", resourceType)
+	}
+	partition := "~" + BIGIPName(tenant) + "~"
+
+	switch resourceType {
+	case "listener":
+		return "/mgmt/tm/ltm/virtual/" + partition + BIGIPName(id), nil
+	case "pool":
+		return "/mgmt/tm/ltm/pool/" + partition + BIGIPName(id), nil
+	case "member":
+		if poolID == "" {
+			return "", fmt.Errorf("no pool of member %s", id)
+		}
+		return "/mgmt/tm/ltm/pool/" + partition + BIGIPName(poolID) + "/members", nil
+	case "healthmonitor":
+		t, _ := obj["type"].(string)
+		mt, ok := bigipMonitorTypes[t]
+		if !ok {
+			return "", fmt.Errorf("unknown healthmonitor type %s", t)
+		}
+		return "/mgmt/tm/ltm/monitor/" + mt + "/" + partition + BIGIPName(id), nil
+	}
+	return "", fmt.Errorf("%s is not verified on BIG-IP", resourceType)
+}
+
+// bigipGet get the iControl REST path. Returns false if it is not found.
+func bigipGet(path string, v interface{}) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://"+bigipHost+path, nil)
+	if err != nil {
+		return false, err
+	}
+	req.SetBasicAuth(bigipUsername, bigipPassword)
+	client := http.Client{
+		Timeout:   bigipTimeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: bigipInsecure}},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		return false, fmt.Errorf("BIG-IP responded %s for %s", resp.Status, path)
+	}
+	if v == nil {
+		return true, nil
+	}
+	return true, json.NewDecoder(resp.Body).Decode(v)
+}
+
+// BIGIPExists tells whether the object is on the BIG-IP. Members are matched by address and port
+// in the members of the pool, their names having the route domain like 10.0.0.1%1:80.
+func BIGIPExists(resourceType string, obj map[string]interface{}, poolID string) (bool, error) {
+	path, err := BIGIPPath(resourceType, obj, poolID)
+	if err != nil {
+		return false, err
+	}
+	if resourceType != "member" {
+		return bigipGet(path, nil)
+	}
+
+	var members struct {
+		Items []struct {
+			Name string `json:"name"`
+		} `json:"items"`
+	}
+	if found, err := bigipGet(path, &members); !found || err != nil {
+		return false, err
+	}
+	address, _ := obj["address"].(string)
+	port := fmt.Sprint(obj["protocol_port"])
+	for _, n := range members.Items {
+		i := strings.LastIndex(n.Name, ":")
+		if i < 0 {
+			continue
+		}
+		if strings.SplitN(n.Name[:i], "%", 2)[0] == address && n.Name[i+1:] == port {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CaptureBIGIPObject show the object before it is deleted, for its attributes to verify the deletion.
+func (cmdctx *CommandContext) CaptureBIGIPObject() {
+	obj, err := cmdctx.showObject()
+	if err != nil {
+		logWarn("Command(%d/%d): Failed to show object before delete: %s", cmdctx.Seq, len(cmdList), err.Error())
+		return
+	}
+	cmdctx.bigipObject = obj
+}
+
+// VerifyBIGIP check the created object is on the BIG-IP, and the deleted one is not.
+// Mismatches are recorded as drift without failing the command.
+func (cmdctx *CommandContext) VerifyBIGIP() {
+	obj := cmdctx.bigipObject
+	if cmdctx.OperationType == "create" {
+		if err := json.Unmarshal([]byte(cmdctx.RawOut), &obj); err != nil {
+			cmdctx.BIGIPDrift = "unverified: invalid output: " + err.Error()
+			return
+		}
+	}
+	if obj == nil {
+		cmdctx.BIGIPDrift = "unverified: no object shown before delete"
+		return
+	}
+
+	poolID := ""
+	if cmdctx.ResourceType == "member" {
+		args := PositionalArgs(cmdctx.Command)
+		if len(args) == 0 {
+			cmdctx.BIGIPDrift = "unverified: no pool in command"
+			return
+		}
+		id, err := ObjectIDOf("pool", args[len(args)-1])
+		if err != nil {
+			cmdctx.BIGIPDrift = "unverified: " + err.Error()
+			return
+		}
+		poolID = id
+	}
+
+	exists, err := BIGIPExists(cmdctx.ResourceType, obj, poolID)
+	switch {
+	case err != nil:
+		cmdctx.BIGIPDrift = "unverified: " + err.Error()
+	case cmdctx.OperationType == "create" && !exists:
+		cmdctx.BIGIPDrift = fmt.Sprintf("%s %v is not found on BIG-IP", cmdctx.ResourceType, obj["id"])
+	case cmdctx.OperationType == "delete" && exists:
+		cmdctx.BIGIPDrift = fmt.Sprintf("%s %v is still on BIG-IP", cmdctx.ResourceType, obj["id"])
+	default:
+		logInfo("Command(%d/%d): Verified %s on BIG-IP %s", cmdctx.Seq, len(cmdList), cmdctx.ResourceType, bigipHost)
+		return
+	}
+	logger.Printf("Command(%d/%d): BIG-IP drift: %s", cmdctx.Seq, len(cmdList), cmdctx.BIGIPDrift)
+}
+
+// ObjectIDOf get the id of the object by id or name, from database or by command.
+func ObjectIDOf(objectType string, idOrName string) (string, error) {
+	if uuidRegexp.MatchString(idOrName) {
+		return idOrName, nil
+	}
+	if dbConn != nil {
+		return singleColumn(lbaasSchema.Tables[objectType], "id", idOrName)
+	}
+	obj, err := ShowFromCmd(context.Background(), objectType, idOrName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(obj["id"]), nil
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DriftItem is an object differing between the neutron database and the BIG-IP.
+type DriftItem struct {
+	ObjectType string `json:"object_type"`
+	ID         string `json:"id"`
+	BIGIPName  string `json:"bigip_name"`
+	Partition  string `json:"partition"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// DriftReport is the result of the audit mode.
+type DriftReport struct {
+	LoadBalancer string      `json:"loadbalancer,omitempty"`
+	ProjectID    string      `json:"project_id,omitempty"`
+	Partitions   []string    `json:"partitions"`
+	Checked      int         `json:"checked"`
+	Missing      []DriftItem `json:"missing"`
+	Orphaned     []DriftItem `json:"orphaned"`
+	Mismatched   []DriftItem `json:"mismatched"`
+}
+
+// auditObject is the attributes of an lbaas object compared with the BIG-IP.
+type auditObject struct {
+	ID              string
+	ProjectID       string
+	LoadbalancerID  string
+	PoolID          string
+	HealthmonitorID string
+	Address         string
+	VipAddress      string
+	Type            string
+	ProtocolPort    int
+}
+
+// auditColumns selected for each object type, besides id and project id.
+var auditColumns = map[string]string{
+	"loadbalancer":  "vip_address",
+	"listener":      "loadbalancer_id, protocol_port",
+	"pool":          "COALESCE(loadbalancer_id, '') AS loadbalancer_id, COALESCE(healthmonitor_id, '') AS healthmonitor_id",
+	"member":        "pool_id, address, protocol_port",
+	"healthmonitor": "type",
+}
+
+// bigipPartition is the configuration of a partition deployed by the agent.
+type bigipPartition struct {
+	// virtuals destinations like /Project_t1/10.0.0.5%1:80, by name.
+	virtuals map[string]string
+	// pools member names like 10.0.0.1%1:80, by name.
+	pools map[string][]string
+	// monitors types, by name.
+	monitors map[string]string
+}
+
+// auditObjectsFromDB query the objects of the projects by type.
+func auditObjectsFromDB(objectType string, projects []string) ([]auditObject, error) {
+	rows := []auditObject{}
+	err := dbConn.Table(lbaasSchema.Tables[objectType]).
+		Select(fmt.Sprintf("id, %s AS project_id, %s", lbaasSchema.ProjectColumn, auditColumns[objectType])).
+		Where(fmt.Sprintf("%s IN ?", lbaasSchema.ProjectColumn), projects).Scan(&rows).Error
+	return rows, err
+}
+
+// bigipItems list the iControl REST collection in the partition.
+func bigipItems(path string, partition string, query string, v interface{}) error {
+	filter := url.Values{"$filter": {"partition eq " + partition}}.Encode()
+	if query != "" {
+		filter += "&" + query
+	}
+	_, err := bigipGet(path+"?"+filter, v)
+	return err
+}
+
+// BIGIPPartitionOf get the virtual servers, pools with members and monitors in the partition.
+func BIGIPPartitionOf(partition string) (*bigipPartition, error) {
+	bp := &bigipPartition{map[string]string{}, map[string][]string{}, map[string]string{}}
+
+	var virtuals struct {
+		Items []struct {
+			Name        string `json:"name"`
+			Destination string `json:"destination"`
+		} `json:"items"`
+	}
+	if err := bigipItems("/mgmt/tm/ltm/virtual", partition, "", &virtuals); err != nil {
+		return nil, err
+	}
+	for _, n := range virtuals.Items {
+		bp.virtuals[n.Name] = n.Destination
+	}
+
+	var pools struct {
+		Items []struct {
+			Name             string `json:"name"`
+			MembersReference struct {
+				Items []struct {
+					Name string `json:"name"`
+				} `json:"items"`
+			} `json:"membersReference"`
+		} `json:"items"`
+	}
+	if err := bigipItems("/mgmt/tm/ltm/pool", partition, "expandSubcollections=true", &pools); err != nil {
+		return nil, err
+	}
+	for _, n := range pools.Items {
+		members := []string{}
+		for _, m := range n.MembersReference.Items {
+			members = append(members, m.Name)
+		}
+		bp.pools[n.Name] = members
+	}
+
+	for _, t := range bigipMonitorTypes {
+		var monitors struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+		}
+		if err := bigipItems("/mgmt/tm/ltm/monitor/"+t, partition, "", &monitors); err != nil {
+			return nil, err
+		}
+		for _, n := range monitors.Items {
+			bp.monitors[n.Name] = t
+		}
+	}
+	return bp, nil
+}
+
+// addressPort strip the partition and route domain of the virtual destination or member name,
+// like /Project_t1/10.0.0.5%1:80 to 10.0.0.5:80.
+func addressPort(s string) string {
+	s = s[strings.LastIndex(s, "/")+1:]
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return s
+	}
+	return strings.SplitN(s[:i], "%", 2)[0] + s[i:]
+}
+
+// AuditDrift compare the objects of the loadbalancer, or all of the projects, with their partitions.
+// Orphans are the objects named by the agent in the partitions without database counterparts.
+func AuditDrift(lbID string, projects []string) (*DriftReport, error) {
+	report := &DriftReport{LoadBalancer: lbID, Partitions: []string{},
+		Missing: []DriftItem{}, Orphaned: []DriftItem{}, Mismatched: []DriftItem{}}
+
+	objects := map[string][]auditObject{}
+	for t := range auditColumns {
+		rows, err := auditObjectsFromDB(t, projects)
+		if err != nil {
+			return nil, err
+		}
+		objects[t] = rows
+	}
+
+	vips := map[string]string{}
+	for _, n := range objects["loadbalancer"] {
+		vips[n.ID] = n.VipAddress
+	}
+	inScope := map[string]bool{}
+	for _, n := range objects["pool"] {
+		if lbID == "" || n.LoadbalancerID == lbID {
+			inScope[n.ID] = true
+			if n.HealthmonitorID != "" {
+				inScope[n.HealthmonitorID] = true
+			}
+		}
+	}
+
+	for _, project := range projects {
+		partition := BIGIPName(project)
+		report.Partitions = append(report.Partitions, partition)
+		bp, err := BIGIPPartitionOf(partition)
+		if err != nil {
+			return nil, err
+		}
+		drift := func(objectType string, id string, detail string) DriftItem {
+			return DriftItem{objectType, id, BIGIPName(id), partition, detail}
+		}
+
+		known := map[string]bool{}
+		for _, t := range []string{"listener", "pool", "member", "healthmonitor"} {
+			for _, n := range objects[t] {
+				if n.ProjectID != project {
+					continue
+				}
+				known[BIGIPName(n.ID)] = true
+				scoped := lbID == "" || n.LoadbalancerID == lbID || inScope[n.ID] || inScope[n.PoolID]
+				if !scoped {
+					continue
+				}
+				report.Checked++
+
+				switch t {
+				case "listener":
+					dest, ok := bp.virtuals[BIGIPName(n.ID)]
+					expected := fmt.Sprintf("%s:%d", vips[n.LoadbalancerID], n.ProtocolPort)
+					if !ok {
+						report.Missing = append(report.Missing, drift(t, n.ID, "virtual server"))
+					} else if addressPort(dest) != expected {
+						report.Mismatched = append(report.Mismatched, drift(t, n.ID,
+							fmt.Sprintf("destination %s, expected %s", addressPort(dest), expected)))
+					}
+				case "pool":
+					if _, ok := bp.pools[BIGIPName(n.ID)]; !ok {
+						report.Missing = append(report.Missing, drift(t, n.ID, "pool"))
+					}
+				case "member":
+					expected := fmt.Sprintf("%s:%d", n.Address, n.ProtocolPort)
+					found := false
+					for _, m := range bp.pools[BIGIPName(n.PoolID)] {
+						found = found || addressPort(m) == expected
+					}
+					if !found {
+						report.Missing = append(report.Missing, drift(t, n.ID, "pool member "+expected))
+					}
+				case "healthmonitor":
+					mt, ok := bp.monitors[BIGIPName(n.ID)]
+					if !ok {
+						report.Missing = append(report.Missing, drift(t, n.ID, "monitor"))
+					} else if mt != bigipMonitorTypes[n.Type] {
+						report.Mismatched = append(report.Mismatched, drift(t, n.ID,
+							fmt.Sprintf("monitor type %s, expected %s", mt, bigipMonitorTypes[n.Type])))
+					}
+				}
+			}
+		}
+
+		for _, objectType := range []string{"listener", "pool", "healthmonitor"} {
+			for _, n := range bp.names(objectType) {
+				if strings.HasPrefix(n, bigipEnvPrefix+"_") && !known[n] {
+					report.Orphaned = append(report.Orphaned, DriftItem{objectType, strings.TrimPrefix(n, bigipEnvPrefix+"_"), n, partition, ""})
+				}
+			}
+		}
+		for _, p := range objects["pool"] {
+			if p.ProjectID != project || !inScope[p.ID] {
+				continue
+			}
+			expected := map[string]bool{}
+			for _, m := range objects["member"] {
+				if m.PoolID == p.ID {
+					expected[fmt.Sprintf("%s:%d", m.Address, m.ProtocolPort)] = true
+				}
+			}
+			for _, m := range bp.pools[BIGIPName(p.ID)] {
+				if !expected[addressPort(m)] {
+					report.Orphaned = append(report.Orphaned, DriftItem{"member", "", m, partition, "in pool " + BIGIPName(p.ID)})
+				}
+			}
+		}
+	}
+	sort.SliceStable(report.Orphaned, func(i, j int) bool { return report.Orphaned[i].BIGIPName < report.Orphaned[j].BIGIPName })
+	return report, nil
+}
+
+// names get the sorted names of the virtual servers, pools or monitors, by the object type.
+func (bp *bigipPartition) names(objectType string) []string {
+	names := []string{}
+	switch objectType {
+	case "listener":
+		for k := range bp.virtuals {
+			names = append(names, k)
+		}
+	case "pool":
+		for k := range bp.pools {
+			names = append(names, k)
+		}
+	case "healthmonitor":
+		for k := range bp.monitors {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AuditBIGIP report the drift between the neutron database and the BIG-IP, of --loadbalancer or
+// all the objects of --os-project-id, and write it to the output file. Returns the exit code.
+func AuditBIGIP() int {
+	defer outputFile.Close()
+
+	if dbConn == nil || bigipHost == "" {
+		logger.Printf("audit mode requires --mysql-uri and --bigip-host")
+		return 1
+	}
+
+	lbID := ""
+	projects := []string{}
+	switch {
+	case loadbalancer != "":
+		id, err := dbSource().ID(lbaasSchema.LoadBalancerType, loadbalancer)
+		if err != nil {
+			logger.Printf("Failed to find loadbalancer %s: %s", loadbalancer, err.Error())
+			return 1
+		}
+		project, err := singleColumn(lbaasSchema.Tables["loadbalancer"], lbaasSchema.ProjectColumn, id)
+		if err != nil {
+			logger.Printf("Failed to find project of loadbalancer %s: %s", loadbalancer, err.Error())
+			return 1
+		}
+		lbID, projects = id, []string{project}
+	case projectID != "":
+		projects = []string{projectID}
+	default:
+		logger.Printf("audit mode requires --loadbalancer or --os-project-id")
+		return 1
+	}
+
+	report, err := AuditDrift(lbID, projects)
+	if err != nil {
+		logger.Printf("Failed to audit: %s", err.Error())
+		return 1
+	}
+	report.ProjectID = projects[0]
+
+	fmt.Println()
+	fmt.Println(Colorize(colorBold, "------------------------- Drift Report -------------------------"))
+	fmt.Println()
+	fmt.Printf("%-10s %-14s %-36s %-44s %s\n", "DRIFT", "TYPE", "ID", "BIG-IP NAME", "DETAIL")
+	for _, d := range []struct {
+		name  string
+		items []DriftItem
+	}{{"missing", report.Missing}, {"orphaned", report.Orphaned}, {"mismatched", report.Mismatched}} {
+		for _, n := range d.items {
+			fmt.Printf("%-10s %-14s %-36s %-44s %s\n", d.name, n.ObjectType, n.ID, n.BIGIPName, n.Detail)
+		}
+	}
+	fmt.Println()
+	fmt.Printf("%d object(s) checked in %s: %d missing, %d orphaned, %d mismatched.\n", report.Checked,
+		strings.Join(report.Partitions, ", "), len(report.Missing), len(report.Orphaned), len(report.Mismatched))
+	fmt.Println()
+	fmt.Println(Colorize(colorBold, "----------------------- Drift Report End -----------------------"))
+	fmt.Println()
+
+	jd, _ := json.MarshalIndent(report, "", "  ")
+	if _, e := outputFile.WriteString(string(jd)); e != nil {
+		logger.Printf("Error happens while writing: %s", e.Error())
+	}
+
+	if len(report.Missing)+len(report.Orphaned)+len(report.Mismatched) > 0 {
+		return 1
+	}
+	return 0
+}
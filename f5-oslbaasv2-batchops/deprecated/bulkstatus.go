@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+var bulkStatusFile string
+
+// ObjectStatus is the provisioning status of an lbaas object.
+type ObjectStatus struct {
+	ObjectType         string `json:"object_type"`
+	ID                 string `json:"id"`
+	ProvisioningStatus string `json:"provisioning_status"`
+	Error              string `json:"error,omitempty"`
+}
+
+// ObjectStatusesFromDB get the status of objects grouped by type, one query per type.
+// Falls back to per-object queries when the bulk query fails.
+func ObjectStatusesFromDB(idsByType map[string][]string) []ObjectStatus {
+	rlt := []ObjectStatus{}
+	for _, t := range lbaasSchema.ObjectTypes {
+		ids := idsByType[t]
+		if len(ids) == 0 {
+			continue
+		}
+
+		statuses, err := dbSource().ProvisioningStatuses(t, ids)
+		if err != nil {
+			logger.Printf("Bulk query of %d %s(s) failed, query one by one: %s", len(ids), t, err.Error())
+		}
+		for _, id := range ids {
+			n := ObjectStatus{ObjectType: t, ID: id}
+			if err != nil {
+				status, e := dbSource().StatusOf(t, id, true)
+				n.ProvisioningStatus = status
+				if e != nil {
+					n.Error = e.Error()
+				}
+			} else if status, ok := statuses[id]; ok {
+				n.ProvisioningStatus = status
+			} else {
+				n.Error = "not found"
+			}
+			rlt = append(rlt, n)
+		}
+	}
+	return rlt
+}
+
+// BulkStatus write the status of the objects listed in bulkStatusFile to the output file.
+// Returns the exit code.
+func BulkStatus() int {
+	defer outputFile.Close()
+
+	if dbConn == nil {
+		logger.Printf("bulk-status mode requires --mysql-uri")
+		return 1
+	}
+
+	f, err := os.Open(bulkStatusFile)
+	if err != nil {
+		logger.Printf("Failed to open bulk status file: %s", err.Error())
+		return 1
+	}
+	defer f.Close()
+
+	idsByType := map[string][]string{}
+	scanner := bufio.NewScanner(f)
+	for ln := 1; scanner.Scan(); ln++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.Split(line, ",")
+		t := strings.TrimSpace(kv[0])
+		if _, ok := lbaasSchema.Tables[t]; len(kv) != 2 || !ok {
+			logger.Printf("Invalid line %d in %s: %s", ln, bulkStatusFile, line)
+			return 1
+		}
+		idsByType[t] = append(idsByType[t], strings.TrimSpace(kv[1]))
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Printf("Failed to read bulk status file: %s", err.Error())
+		return 1
+	}
+
+	statuses := ObjectStatusesFromDB(idsByType)
+	jd, _ := json.MarshalIndent(statuses, "", "  ")
+	if _, e := outputFile.WriteString(string(jd)); e != nil {
+		logger.Printf("Error happens while writing: %s", e.Error())
+		return 1
+	}
+	return 0
+}
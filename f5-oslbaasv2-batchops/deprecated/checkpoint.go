@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+var (
+	checkpointInterval int
+
+	// resumedCount the number of leading commands in cmdList completed by the resumed checkpoint.
+	resumedCount int
+)
+
+// CheckpointPath is the checkpoint file next to the output file.
+func CheckpointPath() string {
+	return outputFilePath + ".checkpoint"
+}
+
+// CheckCheckpointOutput tells the checkpoint can be kept next to the output file: the output must be
+// a regular file, not /dev/stdout or a pipe, which is rewritten when the checkpoint is resumed.
+func CheckCheckpointOutput() error {
+	if outputFilePath == "" {
+		return fmt.Errorf("--command-batch-checkpoint-interval requires --output-filepath of a regular file")
+	}
+	fi, err := os.Stat(outputFilePath)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("--command-batch-checkpoint-interval requires --output-filepath of a regular file, not %s", outputFilePath)
+	}
+	return nil
+}
+
+// WriteCheckpoint write the results so far in the output file format, replacing the last checkpoint.
+func WriteCheckpoint() {
+	jd, _ := json.MarshalIndent(RunOutput{runMeta, cmdResults.Sorted()}, "", "  ")
+	tmp := CheckpointPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, jd, 0644); err != nil {
+		logger.Printf("Failed to write checkpoint %s: %s", tmp, err.Error())
+		return
+	}
+	if err := os.Rename(tmp, CheckpointPath()); err != nil {
+		logger.Printf("Failed to write checkpoint %s: %s", CheckpointPath(), err.Error())
+		return
+	}
+	logDebug("Checkpoint %d results to %s", cmdResults.Len(), CheckpointPath())
+}
+
+// ResumeCheckpoint load the results of the checkpoint left by an interrupted run, if any.
+// The completed commands are moved to the head of cmdList in their seq order, and skipped by
+// ExecuteNeutronCommands; cmdList is shuffled in each run so they are matched by command.
+// The output files, holding the partial results of the interrupted run, are rewritten from the start:
+// jsonl records of the completed commands again, the json output at the end.
+func ResumeCheckpoint() error {
+	data, err := ioutil.ReadFile(CheckpointPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var output RunOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return fmt.Errorf("invalid checkpoint %s: %s", CheckpointPath(), err.Error())
+	}
+	results := output.Results
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Seq < results[j].Seq })
+
+	remaining := append([]string{}, cmdList...)
+	completed := []string{}
+	for _, r := range results {
+		found := -1
+		for i, n := range remaining {
+			if NewCommandContext(n).Command == r.Command {
+				found = i
+				break
+			}
+		}
+		if found == -1 {
+			return fmt.Errorf("checkpoint %s has command '%s' not generated in this run, remove it to start over",
+				CheckpointPath(), r.Command)
+		}
+		completed = append(completed, remaining[found])
+		remaining = append(remaining[:found], remaining[found+1:]...)
+	}
+
+	cmdList = append(completed, remaining...)
+	cmdResults = NewResultCollector()
+	cmdResults.AddBatch(results)
+	for _, r := range results {
+		r.TrackCompletion()
+	}
+	resumedCount = len(results)
+
+	if err := outputFile.Truncate(); err != nil {
+		return fmt.Errorf("failed to rewrite the output file: %s", err.Error())
+	}
+	for _, r := range cmdResults.Sorted() {
+		WriteRecord(r)
+	}
+	logger.Printf("%20s: %s, %d commands completed", "Resumed Checkpoint", CheckpointPath(), resumedCount)
+	return nil
+}
+
+// CheckpointResult write the checkpoint every checkpointInterval results.
+func CheckpointResult() {
+	if checkpointInterval > 0 && cmdResults.Len()%checkpointInterval == 0 {
+		WriteCheckpoint()
+	}
+}
+
+// RemoveCheckpoint remove the checkpoint once the run completes.
+func RemoveCheckpoint() {
+	if err := os.Remove(CheckpointPath()); err != nil && !os.IsNotExist(err) {
+		logger.Printf("Failed to remove checkpoint %s: %s", CheckpointPath(), err.Error())
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+var (
+	cleanupFile string
+	cleanupPath string
+
+	// cleanupOrder deletes children before their parents.
+	cleanupOrder = []string{"l7rule", "l7policy", "healthmonitor", "member", "vip", "pool", "listener", "loadbalancer"}
+)
+
+// DeleteCommandOf generate the delete command in cmdList format for the created object.
+// Members and l7rules are deleted with their parent, which is the positional argument of the create command.
+func (cmdctx *CommandContext) DeleteCommandOf() string {
+	lb := cmdctx.LoadBalancer
+	if cmdctx.ResourceType == lbaasSchema.LoadBalancerType {
+		lb = cmdctx.ObjectID
+	}
+
+	cmd := fmt.Sprintf("%s%s-delete %s", lbaasSchema.SubcommandPrefix, cmdctx.ResourceType, cmdctx.ObjectID)
+	if cmdctx.ResourceType == "member" || cmdctx.ResourceType == "l7rule" {
+		if args := PositionalArgs(cmdctx.Command); len(args) > 0 {
+			cmd = fmt.Sprintf("%s %s", cmd, args[len(args)-1])
+		}
+	}
+	return lb + "|" + cmd
+}
+
+// CleanupCommands generate the delete commands of the successfully created objects.
+// Children are deleted before parents; the same type is deleted in reverse creation order.
+func CleanupCommands(results []*CommandContext) []string {
+	cmds := []string{}
+	for _, t := range cleanupOrder {
+		for i := len(results) - 1; i >= 0; i-- {
+			n := results[i]
+			if n.ResourceType == t && n.OperationType == "create" && n.ExitCode == 0 && n.ObjectID != "" && n.SkipReason == "" {
+				cmds = append(cmds, n.DeleteCommandOf())
+			}
+		}
+	}
+	return cmds
+}
+
+// WriteCleanupFile rewrite the cleanup file with the objects created so far.
+func WriteCleanupFile() {
+	cmds := CleanupCommands(cmdResults.Sorted())
+	data := strings.Join(cmds, "\n") + "\n"
+	if err := ioutil.WriteFile(cleanupFile, []byte(data), 0644); err != nil {
+		logger.Printf("Failed to write cleanup file %s: %s", cleanupFile, err.Error())
+	}
+}
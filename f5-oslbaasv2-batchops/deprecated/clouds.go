@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	cloudOpenRCs   RepeatedFlag
+	cloudsParallel bool
+	// cloudName identifies the cloud of the results, set for each cloud run of --openrc.
+	cloudName string
+)
+
+// cloudValueFlags are replaced in the run of each cloud; the ones writing files get the cloud
+// name suffixed, --metrics-listen is dropped for the ports not to collide.
+var cloudValueFlags = map[string]bool{
+	"--openrc": true, "--openrc-path": true, "--cloud-name": true, "--commands-file": true, "--output-filepath": true,
+	"--summary-filepath": true, "--report-html": true, "--report-junit": true, "--command-stats-histogram-output": true,
+	"--neutron-command-stderr-dir": true, "--log-file": true, "--command-seq-to-command-file": true, "--cleanup-file": true,
+	"--command-list-to-graphviz": true, "--metrics-listen": true,
+}
+var cloudBoolFlags = map[string]bool{"--clouds-parallel": true, "--yes": true, "--force": true, "--confirm": true}
+
+// Cloud is an openrc file the batch runs against.
+type Cloud struct {
+	Name       string
+	OpenRC     string
+	OutputPath string
+	Results    []*CommandContext
+	Err        error
+}
+
+// NewClouds name the clouds by their openrc file names without extension, like staging for staging.rc.
+func NewClouds(openrcs []string) []*Cloud {
+	clouds := []*Cloud{}
+	names := map[string]int{}
+	for _, n := range openrcs {
+		base := filepath.Base(n)
+		name := strings.TrimSuffix(base, filepath.Ext(base))
+		names[name]++
+		if names[name] > 1 {
+			name = fmt.Sprintf("%s%d", name, names[name])
+		}
+		clouds = append(clouds, &Cloud{Name: name, OpenRC: n})
+	}
+	return clouds
+}
+
+// CloudPath suffix the file name with the cloud name, like rlt.json to rlt-staging.json.
+func CloudPath(path string, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+// CloudArgs get the arguments of the run of the cloud: the command arguments without the template,
+// the generated commands in commandsPath, and the output files suffixed with the cloud name.
+func (cloud *Cloud) CloudArgs(args []string, commandsPath string) []string {
+	if i := StringArray(args).IndexOf("--"); i != -1 {
+		args = args[:i]
+	}
+	cloudArgs := []string{}
+	for i := 0; i < len(args); i++ {
+		name := "--" + strings.TrimLeft(strings.SplitN(args[i], "=", 2)[0], "-")
+		if cloudValueFlags[name] {
+			if !strings.Contains(args[i], "=") {
+				i++
+			}
+			continue
+		}
+		if !cloudBoolFlags[name] {
+			cloudArgs = append(cloudArgs, args[i])
+		}
+	}
+
+	for _, n := range outputFilePaths {
+		switch {
+		case n == dbSink:
+			cloudArgs = append(cloudArgs, "--output-filepath", n)
+		case !strings.HasPrefix(n, "/dev/") && cloud.OutputPath == "":
+			cloud.OutputPath = CloudPath(n, cloud.Name)
+		}
+	}
+	if cloud.OutputPath == "" {
+		cloud.OutputPath = "results-" + cloud.Name + ".json"
+	}
+	cloudArgs = append(cloudArgs, "--output-filepath", cloud.OutputPath)
+
+	for _, n := range []struct {
+		flag  string
+		value string
+	}{
+		{"--summary-filepath", summaryFilePath}, {"--report-html", reportHTML}, {"--report-junit", reportJUnit},
+		{"--command-stats-histogram-output", histogramOutput}, {"--neutron-command-stderr-dir", stderrDir},
+		{"--log-file", logFile}, {"--command-seq-to-command-file", seqFilePath}, {"--cleanup-file", cleanupFile},
+		{"--command-list-to-graphviz", graphvizPath},
+	} {
+		if n.value != "" {
+			cloudArgs = append(cloudArgs, n.flag, CloudPath(n.value, cloud.Name))
+		}
+	}
+	return append(cloudArgs, "--openrc-path", cloud.OpenRC, "--cloud-name", cloud.Name,
+		"--commands-file", commandsPath, "--yes")
+}
+
+// prefixWriter prefix each line written, for the outputs of the clouds run in parallel.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mutex  *sync.Mutex
+	buf    []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		pw.mutex.Lock()
+		_, _ = pw.w.Write(append([]byte(pw.prefix), pw.buf[:i+1]...))
+		pw.mutex.Unlock()
+		pw.buf = pw.buf[i+1:]
+	}
+}
+
+// ReadResultsFile read the results in the output file, of any --output-format.
+func ReadResultsFile(path string) ([]*CommandContext, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ro RunOutput
+	if json.Unmarshal(data, &ro) == nil && ro.Results != nil {
+		return ro.Results, nil
+	}
+	results := []*CommandContext{}
+	if json.Unmarshal(data, &results) == nil {
+		return results, nil
+	}
+	results = []*CommandContext{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		cmdctx := &CommandContext{}
+		if err := json.Unmarshal(scanner.Bytes(), cmdctx); err != nil {
+			return nil, err
+		}
+		results = append(results, cmdctx)
+	}
+	return results, scanner.Err()
+}
+
+// RunClouds run the commands against each --openrc cloud, one by one or with --clouds-parallel
+// concurrently, as the runs of this program. Then report the results of each cloud and compare
+// their latencies. Returns the exit code.
+func RunClouds() int {
+	defer outputFile.Close()
+
+	if len(cmdList) > maxCommands && !assumeYes {
+		exitf(exitUsage, "%d commands generated, more than --max-commands %d. "+
+			"Add --yes or a higher --max-commands to proceed.", len(cmdList), maxCommands)
+	}
+	if !assumeYes && IsTerminal(os.Stdin) && !ConfirmDeletes() {
+		logger.Printf("Aborted.")
+		return 1
+	}
+	if confirmBatch && !ConfirmBatch() {
+		logger.Printf("Aborted.")
+		return 1
+	}
+
+	f, err := ioutil.TempFile("", "batchops-commands")
+	if err != nil {
+		logger.Printf("Failed to write the commands: %s", err.Error())
+		return 1
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(strings.Join(cmdList, "\n") + "\n")
+	f.Close()
+	if err != nil {
+		logger.Printf("Failed to write the commands: %s", err.Error())
+		return 1
+	}
+
+	clouds := NewClouds(cloudOpenRCs)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for _, cloud := range clouds {
+		c := exec.Command(os.Args[0], cloud.CloudArgs(os.Args[1:], f.Name())...)
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		logger.Printf("%20s: %s, %s", "Cloud", cloud.Name, cloud.OpenRC)
+		if !cloudsParallel {
+			cloud.Err = c.Run()
+			continue
+		}
+		c.Stdin = nil
+		c.Stdout = &prefixWriter{prefix: "[" + cloud.Name + "] ", w: os.Stderr, mutex: &mutex}
+		c.Stderr = &prefixWriter{prefix: "[" + cloud.Name + "] ", w: os.Stderr, mutex: &mutex}
+		wg.Add(1)
+		go func(cloud *Cloud) {
+			defer wg.Done()
+			cloud.Err = c.Run()
+		}(cloud)
+	}
+	wg.Wait()
+
+	rc := 0
+	runMeta = NewRunMetadata()
+	for _, cloud := range clouds {
+		if cloud.Err != nil {
+			logger.Printf("Cloud %s failed to run: %s", cloud.Name, cloud.Err.Error())
+			rc = 1
+		}
+		results, err := ReadResultsFile(cloud.OutputPath)
+		if err != nil {
+			logger.Printf("Failed to read results of cloud %s: %s", cloud.Name, err.Error())
+			rc = 1
+			continue
+		}
+		cloud.Results = results
+		cmdResults.AddBatch(results)
+	}
+
+	merged := cmdResults
+	for _, cloud := range clouds {
+		fmt.Println()
+		fmt.Println(Colorize(colorBold, fmt.Sprintf("=========================== Cloud %s ===========================", cloud.Name)))
+		cmdResults = NewResultCollector()
+		cmdResults.AddBatch(cloud.Results)
+		PrintReport()
+	}
+	PrintCloudComparison(clouds)
+
+	cmdResults = merged
+	WriteResult()
+	return rc
+}
+
+// PrintCloudComparison print the count, p50 and p95 of the latencies of the clouds by resource
+// and operation type.
+func PrintCloudComparison(clouds []*Cloud) {
+	keys := []string{}
+	stats := map[string]map[string]*LatencyHistogram{}
+	for _, cloud := range clouds {
+		for _, h := range LatencyHistograms(cloud.Results, latencyBuckets) {
+			key := h.ResourceType + "-" + h.OperationType
+			if _, ok := stats[key]; !ok {
+				stats[key] = map[string]*LatencyHistogram{}
+				keys = append(keys, key)
+			}
+			stats[key][cloud.Name] = h
+		}
+	}
+
+	fmt.Println(Colorize(colorBold, "---------------------- Latency Comparison ----------------------"))
+	fmt.Println()
+	fmt.Printf("%-22s", "TYPE")
+	for _, cloud := range clouds {
+		fmt.Printf(" | %-22s", cloud.Name+" n/p50/p95 ms")
+	}
+	fmt.Println()
+	for _, key := range keys {
+		fmt.Printf("%-22s", key)
+		for _, cloud := range clouds {
+			cell := "-"
+			if h, ok := stats[key][cloud.Name]; ok {
+				cell = fmt.Sprintf("%d/%d/%d", h.Count, h.P50, h.P95)
+			}
+			fmt.Printf(" | %-22s", cell)
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+	fmt.Println(Colorize(colorBold, "-------------------- Latency Comparison End ---------------------"))
+	fmt.Println()
+}
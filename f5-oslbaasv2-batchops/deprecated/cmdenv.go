@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"f5-oslbaasv2-batchops/pkg/batch"
+)
+
+// envAnnotationPrefix starts the per-command environment overrides of the command line, like
+// env:OS_PROJECT_NAME=projA,OS_PROJECT_DOMAIN_NAME=Default|projA-lb1|lbaas-pool-create ...
+const envAnnotationPrefix = "env:"
+
+var (
+	commandEnvFlags RepeatedFlag
+
+	// secretEnvRegexp matches the names of the environment variables redacted in the results.
+	secretEnvRegexp = regexp.MustCompile(`(?i)password|secret|token|key`)
+)
+
+// SplitEnvAnnotation split the env:K=V,... annotation off the command line.
+// Returns nil if the command line has no annotation.
+func SplitEnvAnnotation(commandline string) (map[string]string, string, error) {
+	if !strings.HasPrefix(commandline, envAnnotationPrefix) {
+		return nil, commandline, nil
+	}
+	annotationAndRest := strings.SplitN(commandline, "|", 2)
+	if len(annotationAndRest) != 2 {
+		return nil, commandline, fmt.Errorf("no command after %s", annotationAndRest[0])
+	}
+
+	env := map[string]string{}
+	for _, n := range strings.Split(strings.TrimPrefix(annotationAndRest[0], envAnnotationPrefix), ",") {
+		kv := strings.SplitN(strings.TrimSpace(n), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, commandline, fmt.Errorf("invalid environment override %s, expect NAME=value", n)
+		}
+		env[kv[0]] = kv[1]
+	}
+	return env, annotationAndRest[1], nil
+}
+
+// EnvAnnotation format the overrides as the env:K=V,... annotation, or "" if none.
+func EnvAnnotation(env []string) string {
+	if len(env) == 0 {
+		return ""
+	}
+	return envAnnotationPrefix + strings.Join(env, ",") + "|"
+}
+
+// RedactedEnv get the overrides recorded in the result, the secret ones masked.
+func RedactedEnv(env map[string]string) map[string]string {
+	if env == nil {
+		return nil
+	}
+	redacted := map[string]string{}
+	for k, v := range env {
+		if secretEnvRegexp.MatchString(k) {
+			v = "***"
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+// CommandEnvOf get the environment of the command: CommandEnv with the overrides in the context.
+func CommandEnvOf(ctx context.Context) []string {
+	base := CommandEnv()
+	env := batch.EnvOf(ctx)
+	if len(env) == 0 {
+		return base
+	}
+
+	merged := []string{}
+	for _, n := range base {
+		if _, ok := env[strings.SplitN(n, "=", 2)[0]]; !ok {
+			merged = append(merged, n)
+		}
+	}
+	names := []string{}
+	for k := range env {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		merged = append(merged, k+"="+env[k])
+	}
+	return merged
+}
+
+// HasCommandEnv tells whether the context has environment overrides.
+func HasCommandEnv(ctx context.Context) bool {
+	return len(batch.EnvOf(ctx)) > 0
+}
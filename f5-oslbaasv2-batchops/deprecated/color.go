@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// colorEnabled when stdout is a terminal and neither NO_COLOR nor --no-color is set.
+var colorEnabled = IsTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+
+var (
+	noColor   bool
+	reportSLA time.Duration
+)
+
+// reportCommandWidth is the max width of the commands in the colored report, longer ones are abbreviated.
+const reportCommandWidth = 72
+
+// IsTerminal tells whether the file is a character device, like a tty.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Colorize wrap s with the ANSI color if color is enabled.
+func Colorize(color string, s string) string {
+	if !colorEnabled {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// ReportColor red for failures, yellow for the successes slower than --report-sla, green otherwise.
+func ReportColor(cmdctx *CommandContext) string {
+	if cmdctx.ExitCode != 0 || cmdctx.CheckErr != "" {
+		return colorRed
+	}
+	if reportSLA > 0 && cmdctx.Duration > reportSLA {
+		return colorYellow
+	}
+	return colorGreen
+}
+
+// DistinguishingArgs get the arguments not shared by all the commands, like the values of the template
+// variables.
+func DistinguishingArgs(results []*CommandContext) map[string]bool {
+	counts := map[string]int{}
+	for _, n := range results {
+		seen := map[string]bool{}
+		for _, arg := range strings.Fields(n.Command) {
+			if !seen[arg] {
+				seen[arg] = true
+				counts[arg]++
+			}
+		}
+	}
+	distinguishing := map[string]bool{}
+	for arg, count := range counts {
+		if count < len(results) {
+			distinguishing[arg] = true
+		}
+	}
+	return distinguishing
+}
+
+// AbbreviateCommand shorten the command to width with ellipses, keeping the subcommand and the
+// distinguishing arguments with their flags, then cutting the tail.
+func AbbreviateCommand(command string, width int, distinguishing map[string]bool) string {
+	if len([]rune(command)) <= width {
+		return command
+	}
+	args := strings.Fields(command)
+	kept := []string{}
+	omitted := false
+	for i, arg := range args {
+		keep := i < 2 || distinguishing[arg] ||
+			(strings.HasPrefix(arg, "-") && i+1 < len(args) && distinguishing[args[i+1]])
+		if !keep {
+			omitted = true
+			continue
+		}
+		if omitted {
+			kept = append(kept, "…")
+			omitted = false
+		}
+		kept = append(kept, arg)
+	}
+	if omitted {
+		kept = append(kept, "…")
+	}
+	short := []rune(strings.Join(kept, " "))
+	if len(short) > width {
+		short = append(short[:width-1], '…')
+	}
+	return string(short)
+}
+
+// PrintColoredResults print the results in aligned columns colored by ReportColor, with the long
+// commands abbreviated, for the terminals.
+func PrintColoredResults(results []*CommandContext) {
+	distinguishing := DistinguishingArgs(results)
+	commands := make([]string, len(results))
+	seqWidth, commandWidth := 1, 1
+	for i, n := range results {
+		commands[i] = AbbreviateCommand(n.Command, reportCommandWidth, distinguishing)
+		if w := len(fmt.Sprint(n.Seq)); w > seqWidth {
+			seqWidth = w
+		}
+		if w := len([]rune(commands[i])); w > commandWidth {
+			commandWidth = w
+		}
+	}
+	for i, n := range results {
+		line := fmt.Sprintf("%*d  %s%s  exit %-3d  %s  %8d ms  waited %8d ms", seqWidth, n.Seq,
+			commands[i], strings.Repeat(" ", commandWidth-len([]rune(commands[i]))),
+			n.ExitCode, n.StartedAt.Format("2006-01-02 15:04:05.000"), n.Duration.Milliseconds(), n.WaitDuration.Milliseconds())
+		fmt.Println(Colorize(ReportColor(n), line))
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+var (
+	dbUsername     string
+	dbPassword     string
+	dbPasswordFile string
+	dbHost         string
+	dbPort         string
+	dbName         string
+)
+
+// dbFlags are the --db-* flags assembled to --mysql-uri, falling back to their environment variables when empty.
+var dbFlags = []struct {
+	Name  string
+	Env   string
+	Value *string
+}{
+	{"--db-username", "BATCHOPS_DB_USERNAME", &dbUsername},
+	{"--db-password", "BATCHOPS_DB_PASSWORD", &dbPassword},
+	{"--db-host", "BATCHOPS_DB_HOST", &dbHost},
+	{"--db-port", "BATCHOPS_DB_PORT", &dbPort},
+	{"--db-name", "BATCHOPS_DB_NAME", &dbName},
+}
+
+// DBURIFromFlags assemble the mysql uri from the --db-* flags or their BATCHOPS_DB_* environment variables.
+// The password is read from --db-password-file if given, before BATCHOPS_DB_PASSWORD. Returns "" if none is
+// given; the port alone, like an exported BATCHOPS_DB_PORT, does not ask for a database.
+func DBURIFromFlags() (string, error) {
+	if dbPasswordFile != "" {
+		if dbPassword != "" {
+			return "", fmt.Errorf("--db-password-file and --db-password are exclusive")
+		}
+		data, err := ioutil.ReadFile(dbPasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read --db-password-file: %s", err.Error())
+		}
+		dbPassword = strings.TrimRight(string(data), "\r\n")
+	}
+	given := false
+	for _, n := range dbFlags {
+		if *n.Value == "" {
+			*n.Value, _ = LookupEnv(n.Env)
+		}
+		given = given || *n.Value != "" && n.Value != &dbPort
+	}
+	if !given {
+		return "", nil
+	}
+
+	if dbPort == "" {
+		dbPort = "3306"
+	}
+	missing := []string{}
+	for _, n := range dbFlags {
+		if *n.Value == "" {
+			missing = append(missing, fmt.Sprintf("%s(%s)", n.Name, n.Env))
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+
+	cfg := mysqldriver.NewConfig()
+	cfg.User, cfg.Passwd, cfg.DBName = dbUsername, dbPassword, dbName
+	cfg.Net, cfg.Addr = "tcp", net.JoinHostPort(dbHost, dbPort)
+	cfg.ParseTime = true
+	return cfg.FormatDSN(), nil
+}
+
+// WithParseTime add parseTime=true to the mysql uri, so that the DATETIME columns, like the updated_at
+// of standardattributes, are scanned into time.Time instead of bytes.
+func WithParseTime(dsn string) (string, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return "", MaskDSNError(err, dsn)
+	}
+	cfg.ParseTime = true
+	return cfg.FormatDSN(), nil
+}
+
+// MaskDSN mask the password of the mysql uri for the logs, like user:***@tcp(host:port)/db. The password
+// may contain '@' and '/', so it spans from the first ':' to the last '@' before the database name, as the
+// driver parses it.
+func MaskDSN(dsn string) string {
+	end := strings.LastIndex(dsn, "/")
+	if end < 0 {
+		end = len(dsn)
+	}
+	at := strings.LastIndex(dsn[:end], "@")
+	if at < 0 {
+		return dsn
+	}
+	colon := strings.Index(dsn[:at], ":")
+	if colon < 0 {
+		return dsn
+	}
+	return dsn[:colon+1] + "***" + dsn[at:]
+}
+
+// MaskDSNError mask the mysql uri and its password in the error, in case the driver echoes them.
+func MaskDSNError(err error, dsn string) error {
+	if err == nil {
+		return nil
+	}
+	msg := strings.ReplaceAll(err.Error(), dsn, MaskDSN(dsn))
+	if cfg, e := mysqldriver.ParseDSN(dsn); e == nil && cfg.Passwd != "" {
+		msg = strings.ReplaceAll(msg, cfg.Passwd, "***")
+	}
+	return fmt.Errorf("%s", msg)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+const (
+	labelAnnotationPrefix = "label="
+	needsAnnotationPrefix = "needs="
+)
+
+// graphvizPath is where --command-list-to-graphviz writes the dependency graph of the commands.
+var graphvizPath string
+
+// completedLabels tell if the labeled commands finished successfully, for the commands needing them.
+var completedLabels = map[string]bool{}
+
+// SplitDepAnnotations split the leading label=NAME| and needs=SEQ|LABEL,...| annotations off the command line.
+func SplitDepAnnotations(commandline string) (string, []string, string) {
+	label, needs := "", []string{}
+	for {
+		segmentAndRest := strings.SplitN(commandline, "|", 2)
+		if len(segmentAndRest) != 2 {
+			return label, needs, commandline
+		}
+		switch segment := strings.TrimSpace(segmentAndRest[0]); {
+		case strings.HasPrefix(segment, labelAnnotationPrefix):
+			label = strings.TrimPrefix(segment, labelAnnotationPrefix)
+		case strings.HasPrefix(segment, needsAnnotationPrefix):
+			for _, n := range strings.Split(strings.TrimPrefix(segment, needsAnnotationPrefix), ",") {
+				if n = strings.TrimSpace(n); n != "" {
+					needs = append(needs, n)
+				}
+			}
+		default:
+			return label, needs, commandline
+		}
+		commandline = segmentAndRest[1]
+	}
+}
+
+// depCommand is a line of the commands file with its dependencies.
+type depCommand struct {
+	label string
+	needs []int
+	line  string
+	// name is the label, or #seq when it is needed without a label.
+	name string
+}
+
+// OrderByNeeds resolve the needs=SEQ|LABEL annotations of the commands in the commands file order,
+// and move the commands needed before the ones needing them, the order kept otherwise.
+// The commands are returned with the label=NAME|needs=NAME,...| annotations resolved to the labels,
+// #seq for the ones without. Unknown dependencies and cycles are errors.
+func OrderByNeeds(lines []string) ([]string, error) {
+	cmds := []*depCommand{}
+	labels := map[string]int{}
+	needsByLine := [][]string{}
+	for i, n := range lines {
+		label, needs, rest := SplitDepAnnotations(n)
+		if label != "" {
+			if _, ok := labels[label]; ok {
+				return nil, fmt.Errorf("duplicated label %s", label)
+			}
+			labels[label] = i
+		}
+		cmds = append(cmds, &depCommand{label: label, line: rest, name: label})
+		needsByLine = append(needsByLine, needs)
+	}
+	for i, needs := range needsByLine {
+		for _, n := range needs {
+			j, ok := labels[n]
+			if seq, err := strconv.Atoi(n); err == nil {
+				j, ok = seq-1, seq >= 1 && seq <= len(cmds)
+			}
+			if !ok {
+				return nil, fmt.Errorf("command %d needs unknown %s", i+1, n)
+			}
+			if cmds[j].name == "" {
+				cmds[j].name = fmt.Sprintf("#%d", j+1)
+			}
+			cmds[i].needs = append(cmds[i].needs, j)
+		}
+	}
+
+	ordered := []string{}
+	// 0 not visited, 1 visiting, 2 ordered.
+	states := make([]int, len(cmds))
+	path := []int{}
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch states[i] {
+		case 2:
+			return nil
+		case 1:
+			names := []string{}
+			for k := len(path) - 1; k >= 0 && path[k] != i; k-- {
+				names = append([]string{cmds[path[k]].name}, names...)
+			}
+			names = append([]string{cmds[i].name}, names...)
+			return fmt.Errorf("dependency cycle %s -> %s", strings.Join(names, " -> "), cmds[i].name)
+		}
+		states[i] = 1
+		path = append(path, i)
+		for _, j := range cmds[i].needs {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		states[i] = 2
+		ordered = append(ordered, cmds[i].DepAnnotations(cmds)+cmds[i].line)
+		return nil
+	}
+	for i := range cmds {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// DepAnnotations format the label and the names of the needed commands as the annotations.
+func (dc *depCommand) DepAnnotations(cmds []*depCommand) string {
+	annotations := ""
+	if dc.name != "" {
+		annotations += labelAnnotationPrefix + dc.name + "|"
+	}
+	if len(dc.needs) > 0 {
+		names := []string{}
+		for _, j := range dc.needs {
+			names = append(names, cmds[j].name)
+		}
+		annotations += needsAnnotationPrefix + strings.Join(names, ",") + "|"
+	}
+	return annotations
+}
+
+// NeedsFailed tell which needed command did not finish successfully, or "" if all did.
+func (cmdctx *CommandContext) NeedsFailed() string {
+	for _, n := range cmdctx.Needs {
+		if !completedLabels[n] {
+			return n
+		}
+	}
+	return ""
+}
+
+// SkipForFailedNeeds mark the command skipped if a command it needs failed or did not run.
+// Returns true if skipped.
+func (cmdctx *CommandContext) SkipForFailedNeeds() bool {
+	failed := cmdctx.NeedsFailed()
+	if failed == "" {
+		return false
+	}
+	cmdctx.ExitCode = -1
+	cmdctx.Err = fmt.Sprintf("skipped, needed command %s did not complete", failed)
+	cmdctx.SkipReason = "skipped-dependency"
+	return true
+}
+
+// TrackCompletion remember if the labeled command finished successfully.
+func (cmdctx *CommandContext) TrackCompletion() {
+	if cmdctx.Label != "" {
+		completedLabels[cmdctx.Label] = cmdctx.ExitCode == 0 && cmdctx.CheckErr == ""
+	}
+}
+
+// CommandListGraphviz draw the commands in the DOT format: the nodes are the command seqs labeled
+// with the resource/operation type, the edges go from the needed commands to the ones needing them.
+func CommandListGraphviz(cmds []string) string {
+	ctxs := []*CommandContext{}
+	seqs := map[string]int{}
+	for i, n := range cmds {
+		cmdctx := NewCommandContext(n)
+		ctxs = append(ctxs, cmdctx)
+		if cmdctx.Label != "" {
+			seqs[cmdctx.Label] = i + 1
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph commands {\n")
+	for i, cmdctx := range ctxs {
+		label := fmt.Sprintf("%d: %s/%s", i+1, cmdctx.ResourceType, cmdctx.OperationType)
+		if cmdctx.Label != "" && !strings.HasPrefix(cmdctx.Label, "#") {
+			label += " " + cmdctx.Label
+		}
+		fmt.Fprintf(&b, "  %d [label=%q];\n", i+1, label)
+	}
+	for i, cmdctx := range ctxs {
+		for _, n := range cmdctx.Needs {
+			if seq, ok := seqs[n]; ok {
+				fmt.Fprintf(&b, "  %d -> %d;\n", seq, i+1)
+			}
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// WriteCommandListGraphviz write the dependency graph of cmdList to graphvizPath before execution.
+func WriteCommandListGraphviz() {
+	if err := ioutil.WriteFile(graphvizPath, []byte(CommandListGraphviz(cmdList)), 0644); err != nil {
+		logger.Fatalf("Failed to write graphviz file %s: %s", graphvizPath, err.Error())
+	}
+	logger.Printf("%20s: %s", "Graphviz File", graphvizPath)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	captureDiff bool
+
+	// diffIgnored fields change with the operation itself.
+	diffIgnored = map[string]bool{"provisioning_status": true, "operating_status": true}
+
+	// valuelessFlags of lbaas-* commands, which take no value.
+	valuelessFlags = map[string]bool{"--admin-state-down": true, "--invert": true, "--debug": true}
+)
+
+// FieldDiff is the values of a changed field.
+type FieldDiff struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// PositionalArgs get the positional arguments after the lbaas-*(lb-* for v1) subcommand.
+// Flags are assumed to take a value unless in valuelessFlags or given as --flag=value.
+func PositionalArgs(command string) []string {
+	args := strings.Fields(command)
+	positional := []string{}
+	started := false
+	for i := 0; i < len(args); i++ {
+		n := args[i]
+		if !started {
+			started = strings.HasPrefix(n, lbaasSchema.SubcommandPrefix)
+			continue
+		}
+		if strings.HasPrefix(n, "-") {
+			if !strings.Contains(n, "=") && !valuelessFlags[n] {
+				i++
+			}
+			continue
+		}
+		positional = append(positional, n)
+	}
+	return positional
+}
+
+// showObject show the object operated by the command, like 'lbaas-member-show MEMBER POOL'.
+func (cmdctx *CommandContext) showObject() (map[string]interface{}, error) {
+	args := PositionalArgs(cmdctx.Command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no object in command")
+	}
+	return ShowFromCmd(context.Background(), cmdctx.ResourceType, args...)
+}
+
+// CaptureBefore show the object before the update.
+func (cmdctx *CommandContext) CaptureBefore() {
+	obj, err := cmdctx.showObject()
+	if err != nil {
+		logWarn("Command(%d/%d): Failed to show object before update: %s", cmdctx.Seq, len(cmdList), err.Error())
+		return
+	}
+	cmdctx.Before = obj
+}
+
+// CaptureAfter show the object after the update and diff with the one before.
+func (cmdctx *CommandContext) CaptureAfter() {
+	obj, err := cmdctx.showObject()
+	if err != nil {
+		logWarn("Command(%d/%d): Failed to show object after update: %s", cmdctx.Seq, len(cmdList), err.Error())
+		return
+	}
+	cmdctx.After = obj
+	cmdctx.Diff = DiffObjects(cmdctx.Before, cmdctx.After)
+	logInfo("Command(%d/%d): %d field(s) changed", cmdctx.Seq, len(cmdList), len(cmdctx.Diff))
+}
+
+// NoopUpdates get the update commands captured with no field changed, likely a template bug.
+func NoopUpdates(results []*CommandContext) []*CommandContext {
+	noops := []*CommandContext{}
+	for _, n := range results {
+		if n.Before != nil && n.After != nil && len(n.Diff) == 0 {
+			noops = append(noops, n)
+		}
+	}
+	return noops
+}
+
+// DiffObjects compare the top-level fields of the objects.
+func DiffObjects(before, after map[string]interface{}) map[string]FieldDiff {
+	diff := map[string]FieldDiff{}
+	for k, v := range before {
+		if !diffIgnored[k] && !reflect.DeepEqual(v, after[k]) {
+			diff[k] = FieldDiff{v, after[k]}
+		}
+	}
+	for k, v := range after {
+		if _, ok := before[k]; !ok && !diffIgnored[k] {
+			diff[k] = FieldDiff{nil, v}
+		}
+	}
+	return diff
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	checkEndpoint        bool
+	endpointCheckTimeout = 10
+)
+
+// CheckEndpointReachable GET the root of OS_AUTH_URL, any HTTP response means reachable.
+func CheckEndpointReachable() error {
+	authURL, _ := LookupEnv("OS_AUTH_URL")
+	if authURL == "" {
+		return fmt.Errorf("no OS_AUTH_URL environment found")
+	}
+	u, err := url.Parse(authURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid OS_AUTH_URL %s", authURL)
+	}
+	root := fmt.Sprintf("%s://%s/", u.Scheme, u.Host)
+
+	client := http.Client{Timeout: time.Duration(endpointCheckTimeout) * time.Second, Transport: NeutronTransport()}
+	resp, err := client.Get(root)
+	if err != nil {
+		return fmt.Errorf("endpoint %s is not reachable in %d seconds: %s", root, endpointCheckTimeout, err.Error())
+	}
+	resp.Body.Close()
+	logger.Printf("%20s: %s %s", "Endpoint Reachable", root, resp.Status)
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"f5-oslbaasv2-batchops/pkg/batch"
+)
+
+// executor runs the neutron commands, replaced by a fake in tests.
+var executor batch.Executor = batch.NewExecExecutor(batch.ExecOptions{Env: CommandEnvOf})
+
+// runner runs the commands with the executor, in --neutron-format with the TLS options.
+func runner() *batch.Runner {
+	return batch.NewRunner(batch.RunnerOptions{
+		Executor: executor,
+		Format:   neutronFormat,
+		Args:     NeutronTLSArgs(),
+		Logger:   levelLogger{},
+	})
+}
+
+// checker checks the readiness of the commands' objects with --pending-states.
+func checker() *batch.Checker {
+	return batch.NewChecker(batch.CheckerOptions{
+		LoadBalancerType: lbaasSchema.LoadBalancerType,
+		Pending:          IsPending,
+		Total:            len(cmdList),
+		Logger:           levelLogger{},
+	})
+}
+
+// levelLogger logs the progress of the batch and status packages by --log-level.
+type levelLogger struct{}
+
+func (levelLogger) Debugf(format string, v ...interface{}) { logDebug(format, v...) }
+func (levelLogger) Infof(format string, v ...interface{})  { logInfo(format, v...) }
+func (levelLogger) Warnf(format string, v ...interface{})  { logWarn(format, v...) }
+func (levelLogger) Printf(format string, v ...interface{}) { logger.Printf(format, v...) }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"f5-oslbaasv2-batchops/pkg/batch"
+)
+
+var (
+	skipExisting bool
+	recreate     bool
+)
+
+// ArgValue get the value of the flag in the command, like '--name lb1' or '--name=lb1'.
+func ArgValue(command string, flag string) string {
+	args := strings.Fields(command)
+	for i, n := range args {
+		if n == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(n, flag+"=") {
+			return n[len(flag)+1:]
+		}
+	}
+	return ""
+}
+
+// ExistingObjectID find the id of the object with the same type and name as the create command.
+// Returns "" if the command has no name or no such object.
+func (cmdctx *CommandContext) ExistingObjectID(ctx context.Context) (string, error) {
+	name := ArgValue(cmdctx.Command, "--name")
+	if name == "" {
+		return "", nil
+	}
+
+	if dbConn != nil {
+		table, ok := lbaasSchema.Tables[cmdctx.ResourceType]
+		if !ok {
+			return "", fmt.Errorf("unknown object type %s", cmdctx.ResourceType)
+		}
+		if !lbaasSchema.HasName(cmdctx.ResourceType) {
+			return "", fmt.Errorf("%s has no name to find the existing %s %s", table, cmdctx.ResourceType, name)
+		}
+		entries := []NeutronResponse{}
+		query := dbConn.Table(table).Select(neutronColumns(cmdctx.ResourceType)).Where("name = ?", name)
+		if projectID != "" {
+			query = query.Where(fmt.Sprintf("%s = ?", lbaasSchema.ProjectColumn), projectID)
+		}
+		if err := query.Find(&entries).Error; err != nil {
+			return "", err
+		}
+		if len(entries) > 1 {
+			return "", fmt.Errorf("%s %s has %d records", cmdctx.ResourceType, name, len(entries))
+		}
+		if len(entries) == 1 {
+			return entries[0].ID, nil
+		}
+		return "", nil
+	}
+
+	args := []string{"--name", name}
+	if cmdctx.ResourceType == "member" {
+		args = append([]string{cmdctx.ParentArg()}, args...)
+	}
+	objs, err := ListFromCmd(ctx, cmdctx.ResourceType, args...)
+	if err != nil {
+		return "", err
+	}
+	if len(objs) > 1 {
+		return "", fmt.Errorf("%s %s has %d records", cmdctx.ResourceType, name, len(objs))
+	}
+	if len(objs) == 1 {
+		return fmt.Sprint(objs[0]["id"]), nil
+	}
+	return "", nil
+}
+
+// ParentArg get the parent of member and l7rule commands, which is the positional argument,
+// wherever it is among the flags.
+func (cmdctx *CommandContext) ParentArg() string {
+	args := PositionalArgs(cmdctx.Command)
+	if len(args) == 0 {
+		return ""
+	}
+	return args[len(args)-1]
+}
+
+// HandleExisting skip or delete the existing object before the create command.
+// Returns true if the command should not be executed.
+func (cmdctx *CommandContext) HandleExisting(ctx context.Context) bool {
+	logPrefix := fmt.Sprintf("Command(%d/%d):", cmdctx.Seq, len(cmdList))
+
+	id, err := cmdctx.ExistingObjectID(ctx)
+	if err != nil {
+		logger.Printf("%s Failed to check existing %s: %s", logPrefix, cmdctx.ResourceType, err.Error())
+		cmdctx.ExitCode = -1
+		cmdctx.Err = err.Error()
+		return true
+	}
+	if id == "" {
+		return false
+	}
+
+	if skipExisting {
+		logInfo("%s Skipped, %s %s exists", logPrefix, cmdctx.ResourceType, id)
+		cmdctx.ObjectID = id
+		cmdctx.SkipReason = "skipped-existing"
+		return true
+	}
+
+	logInfo("%s Delete existing %s %s before recreating", logPrefix, cmdctx.ResourceType, id)
+	delctx := CommandContext{CommandContext: batch.CommandContext{
+		Command: fmt.Sprintf("neutron %s%s-delete %s", lbaasSchema.SubcommandPrefix, cmdctx.ResourceType, id),
+	}}
+	if cmdctx.ResourceType == "member" || cmdctx.ResourceType == "l7rule" {
+		delctx.Command += " " + cmdctx.ParentArg()
+	}
+	delctx.Execute(ctx)
+	if delctx.ExitCode != 0 {
+		logger.Printf("%s Failed to delete existing %s %s: %s", logPrefix, cmdctx.ResourceType, id, delctx.Err)
+		cmdctx.ExitCode = -1
+		cmdctx.Err = delctx.Err
+		return true
+	}
+
+	if cmdctx.ResourceType != lbaasSchema.LoadBalancerType {
+		if err := cmdctx.WaitForReady(ctx); err != nil {
+			logger.Printf("%s Not ready after deleting existing %s: %s", logPrefix, cmdctx.ResourceType, err.Error())
+			cmdctx.ExitCode = -1
+			cmdctx.Err = err.Error()
+			return true
+		}
+	}
+	return false
+}
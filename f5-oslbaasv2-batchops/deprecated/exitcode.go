@@ -0,0 +1,18 @@
+package main
+
+import "os"
+
+// Exit codes of the failures before running the commands, for the scripts to branch on the cause.
+// The other failures exit 1.
+const (
+	exitUsage = 2
+	exitEnv   = 3
+	exitDB    = 4
+)
+
+// exitf log the failure and exit with the code.
+func exitf(code int, format string, v ...interface{}) {
+	logger.Printf(format, v...)
+	ReleaseLocks()
+	os.Exit(code)
+}
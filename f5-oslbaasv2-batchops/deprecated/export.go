@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"f5-oslbaasv2-batchops/pkg/batch"
+)
+
+var scenarioFile string
+
+// Scenario is the object tree of a loadbalancer, as shown by neutron.
+// Objects refer to each other by id, which is re-resolved by name when imported.
+type Scenario struct {
+	LoadBalancer   map[string]interface{}   `json:"loadbalancer"`
+	Listeners      []map[string]interface{} `json:"listeners"`
+	Pools          []map[string]interface{} `json:"pools"`
+	Members        []map[string]interface{} `json:"members"`
+	HealthMonitors []map[string]interface{} `json:"healthmonitors"`
+	L7Policies     []map[string]interface{} `json:"l7policies"`
+	L7Rules        []map[string]interface{} `json:"l7rules"`
+}
+
+// createFlag maps an object attribute to the create command's flag.
+// A flag of "" means the attribute is the positional argument.
+type createFlag struct {
+	Attribute string
+	Flag      string
+}
+
+// createFlags of the lbaas-*-create commands, for the attributes copied as-is.
+var createFlags = map[string][]createFlag{
+	"loadbalancer": {{"name", "--name"}, {"description", "--description"}, {"vip_address", "--vip-address"},
+		{"provider", "--provider"}, {"vip_subnet_id", ""}},
+	"listener": {{"name", "--name"}, {"description", "--description"}, {"protocol", "--protocol"},
+		{"protocol_port", "--protocol-port"}, {"connection_limit", "--connection-limit"},
+		{"default_tls_container_ref", "--default-tls-container-ref"}},
+	"pool": {{"name", "--name"}, {"description", "--description"}, {"protocol", "--protocol"},
+		{"lb_algorithm", "--lb-algorithm"}},
+	"member": {{"name", "--name"}, {"address", "--address"}, {"protocol_port", "--protocol-port"},
+		{"weight", "--weight"}, {"subnet_id", "--subnet"}},
+	"healthmonitor": {{"name", "--name"}, {"type", "--type"}, {"delay", "--delay"}, {"timeout", "--timeout"},
+		{"max_retries", "--max-retries"}, {"http_method", "--http-method"}, {"url_path", "--url-path"},
+		{"expected_codes", "--expected-codes"}},
+	"l7policy": {{"name", "--name"}, {"description", "--description"}, {"action", "--action"},
+		{"redirect_url", "--redirect-url"}, {"position", "--position"}},
+	"l7rule": {{"type", "--type"}, {"compare_type", "--compare-type"}, {"key", "--key"}, {"value", "--value"}},
+}
+
+// ShowFromCmd run 'neutron lbaas-<objectType>-show' and parse the object.
+func ShowFromCmd(ctx context.Context, objectType string, args ...string) (map[string]interface{}, error) {
+	obj := map[string]interface{}{}
+	err := runJSONCmd(ctx, fmt.Sprintf("%s%s-show", lbaasSchema.SubcommandPrefix, objectType), args, &obj)
+	return obj, err
+}
+
+// ListFromCmd run 'neutron lbaas-<objectType>-list' and parse the objects.
+func ListFromCmd(ctx context.Context, objectType string, args ...string) ([]map[string]interface{}, error) {
+	objs := []map[string]interface{}{}
+	err := runJSONCmd(ctx, fmt.Sprintf("%s%s-list", lbaasSchema.SubcommandPrefix, objectType), args, &objs)
+	return objs, err
+}
+
+func runJSONCmd(ctx context.Context, subcmd string, args []string, v interface{}) error {
+	chkctx := CommandContext{CommandContext: batch.CommandContext{
+		Command: strings.Join(append([]string{"neutron", subcmd}, args...), " "),
+		Format:  "json",
+	}}
+	chkctx.Execute(ctx)
+	if chkctx.ExitCode != 0 {
+		return fmt.Errorf("%s: %s", chkctx.Command, chkctx.Err)
+	}
+	if err := json.Unmarshal([]byte(chkctx.RawOut), v); err != nil {
+		return fmt.Errorf("%s: invalid output: %s", chkctx.Command, err.Error())
+	}
+	return nil
+}
+
+// refIDs get the ids from the reference list attribute, like "listeners": [{"id": "..."}].
+func refIDs(obj map[string]interface{}, attribute string) []string {
+	ids := []string{}
+	refs, _ := obj[attribute].([]interface{})
+	for _, r := range refs {
+		if m, ok := r.(map[string]interface{}); ok {
+			if id, ok := m["id"].(string); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// ExportLoadbalancer walk the object tree of the loadbalancer with neutron commands.
+func ExportLoadbalancer(ctx context.Context, lbIDName string) (*Scenario, error) {
+	sc := Scenario{}
+	var err error
+
+	logger.Printf("Export loadbalancer %s", lbIDName)
+	if sc.LoadBalancer, err = ShowFromCmd(ctx, "loadbalancer", lbIDName); err != nil {
+		return nil, err
+	}
+
+	for _, id := range refIDs(sc.LoadBalancer, "listeners") {
+		listener, err := ShowFromCmd(ctx, "listener", id)
+		if err != nil {
+			return nil, err
+		}
+		sc.Listeners = append(sc.Listeners, listener)
+
+		for _, pid := range refIDs(listener, "l7policies") {
+			policy, err := ShowFromCmd(ctx, "l7policy", pid)
+			if err != nil {
+				return nil, err
+			}
+			sc.L7Policies = append(sc.L7Policies, policy)
+
+			rules, err := ListFromCmd(ctx, "l7rule", pid)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range rules {
+				r["l7policy_id"] = pid
+				sc.L7Rules = append(sc.L7Rules, r)
+			}
+		}
+	}
+
+	for _, id := range refIDs(sc.LoadBalancer, "pools") {
+		pool, err := ShowFromCmd(ctx, "pool", id)
+		if err != nil {
+			return nil, err
+		}
+		sc.Pools = append(sc.Pools, pool)
+
+		members, err := ListFromCmd(ctx, "member", id)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			m["pool_id"] = id
+			sc.Members = append(sc.Members, m)
+		}
+
+		if hmid, ok := pool["healthmonitor_id"].(string); ok && hmid != "" {
+			hm, err := ShowFromCmd(ctx, "healthmonitor", hmid)
+			if err != nil {
+				return nil, err
+			}
+			sc.HealthMonitors = append(sc.HealthMonitors, hm)
+		}
+	}
+
+	logger.Printf("Exported %d listener(s), %d pool(s), %d member(s), %d healthmonitor(s), %d l7policy(s), %d l7rule(s)",
+		len(sc.Listeners), len(sc.Pools), len(sc.Members), len(sc.HealthMonitors), len(sc.L7Policies), len(sc.L7Rules))
+	return &sc, nil
+}
+
+// ExportScenario write the object tree of --loadbalancer to the output file.
+// Returns the exit code.
+func ExportScenario() int {
+	defer outputFile.Close()
+
+	if loadbalancer == "" {
+		logger.Printf("export mode requires --loadbalancer")
+		return 1
+	}
+	sc, err := ExportLoadbalancer(context.Background(), loadbalancer)
+	if err != nil {
+		logger.Printf("Failed to export loadbalancer %s: %s", loadbalancer, err.Error())
+		return 1
+	}
+
+	jd, _ := json.MarshalIndent(sc, "", "  ")
+	// the scenario is only useful if it can be imported.
+	if _, err := sc.Commands(); err != nil {
+		logger.Printf("Failed to export loadbalancer %s: %s", loadbalancer, err.Error())
+		return 1
+	}
+	if _, e := outputFile.WriteString(string(jd)); e != nil {
+		logger.Printf("Error happens while writing: %s", e.Error())
+		return 1
+	}
+	return 0
+}
+
+// ImportScenario generate the create commands of the scenario file, parent objects first.
+func ImportScenario(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc := Scenario{}
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, err
+	}
+	if sc.LoadBalancer == nil {
+		return nil, fmt.Errorf("no loadbalancer in scenario %s", path)
+	}
+	cmds, err := sc.Commands()
+	if err != nil {
+		return nil, fmt.Errorf("scenario %s: %s", path, err.Error())
+	}
+	logger.Printf("%20s: %d commands from scenario", "Command List", len(cmds))
+	return cmds, nil
+}
+
+// Commands generate the create commands of the scenario, parent objects first.
+func (sc *Scenario) Commands() ([]string, error) {
+	// objects are referred by name, as ids change in the new environment.
+	names := map[string]string{}
+	nameOf := func(objectType string, obj map[string]interface{}) string {
+		id, _ := obj["id"].(string)
+		name, _ := obj["name"].(string)
+		if name == "" {
+			name = fmt.Sprintf("%s-%.8s", objectType, id)
+			obj["name"] = name
+		}
+		names[id] = name
+		return name
+	}
+
+	cmds := []string{}
+	var err error
+	add := func(objectType string, obj map[string]interface{}, extra ...string) {
+		if err != nil {
+			return
+		}
+		var cmd string
+		if cmd, err = CreateCommandOf(objectType, obj, extra...); err == nil {
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	lb := nameOf("loadbalancer", sc.LoadBalancer)
+	add("loadbalancer", sc.LoadBalancer)
+	for _, n := range sc.Listeners {
+		nameOf("listener", n)
+		add("listener", n, "--loadbalancer", lb)
+	}
+	for _, n := range sc.Pools {
+		nameOf("pool", n)
+		if ids := refIDs(n, "listeners"); len(ids) > 0 {
+			add("pool", n, "--listener", names[ids[0]])
+		} else {
+			add("pool", n, "--loadbalancer", lb)
+		}
+	}
+	for _, n := range sc.Members {
+		pool, _ := n["pool_id"].(string)
+		add("member", n, names[pool])
+	}
+	for _, n := range sc.HealthMonitors {
+		if ids := refIDs(n, "pools"); len(ids) > 0 {
+			add("healthmonitor", n, "--pool", names[ids[0]])
+		}
+	}
+	for _, n := range sc.L7Policies {
+		nameOf("l7policy", n)
+		args := []string{"--listener", names[fmt.Sprint(n["listener_id"])]}
+		if pool, ok := n["redirect_pool_id"].(string); ok && pool != "" {
+			args = append(args, "--redirect-pool", names[pool])
+		}
+		add("l7policy", n, args...)
+	}
+	for _, n := range sc.L7Rules {
+		add("l7rule", n, names[fmt.Sprint(n["l7policy_id"])])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, n := range cmds {
+		cmds[i] = lb + "|" + n
+	}
+	return cmds, nil
+}
+
+// CreateCommandOf generate the lbaas-<objectType>-create command of the object. The commands are
+// split by space when executed, so the values with whitespace, like a description, are rejected.
+func CreateCommandOf(objectType string, obj map[string]interface{}, extra ...string) (string, error) {
+	args := []string{fmt.Sprintf("lbaas-%s-create", objectType)}
+	positional := []string{}
+	for _, f := range createFlags[objectType] {
+		v, ok := obj[f.Attribute]
+		if !ok || v == nil || fmt.Sprint(v) == "" {
+			continue
+		}
+		value := fmt.Sprint(v)
+		if strings.ContainsAny(value, " \t\r\n") {
+			id, _ := obj["id"].(string)
+			return "", fmt.Errorf("%s %s has whitespace in %s %q, which can not be passed in a command", objectType, id, f.Attribute, value)
+		}
+		if f.Flag == "" {
+			positional = append(positional, value)
+		} else {
+			args = append(args, f.Flag, value)
+		}
+	}
+	for _, n := range extra {
+		if n == "" || strings.ContainsAny(n, " \t\r\n") {
+			return "", fmt.Errorf("%s refers to an invalid parent name %q", objectType, n)
+		}
+	}
+	if up, ok := obj["admin_state_up"].(bool); ok && !up {
+		args = append(args, "--admin-state-down")
+	}
+	if invert, ok := obj["invert"].(bool); ok && invert {
+		args = append(args, "--invert")
+	}
+	args = append(args, extra...)
+	args = append(args, positional...)
+	return strings.Join(args, " "), nil
+}
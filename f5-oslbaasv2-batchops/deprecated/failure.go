@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	// commandRetries the times to retry the commands failed with a transient failure class.
+	commandRetries int
+
+	idempotent bool
+
+	skipOnParentFailure        bool
+	skipDeletesOnParentFailure bool
+	// failedLoadBalancers the seq of the first failed command of each loadbalancer, for --skip-on-parent-failure.
+	failedLoadBalancers = map[string]int{}
+
+	maxFailures            int
+	maxConsecutiveFailures int
+	// failureCount and consecutiveFailures count the failed commands, for --max-failures.
+	failureCount        int
+	consecutiveFailures int
+	// alreadyExistsRegexp matches the neutron errors of creating an object which exists.
+	alreadyExistsRegexp = regexp.MustCompile(`(?i)already (exists|present)|already has a listener with protocol_port|Duplicate`)
+)
+
+// failureClasses classify the failed commands by the neutron error output, checked in order.
+var failureClasses = []struct {
+	Class   string
+	Pattern *regexp.Regexp
+}{
+	{"Auth", regexp.MustCompile(`(?i)\b401\b|Unauthorized|requires authentication|\b403\b|Forbidden|Could not find versioned identity endpoints`)},
+	{"NotFound", regexp.MustCompile(`(?i)\b404\b|NotFound|could not be found|Unable to find`)},
+	{"RateLimited", regexp.MustCompile(`(?i)\b429\b|Too Many Requests|OverLimit|Rate limit`)},
+	{"Conflict", regexp.MustCompile(`(?i)\b409\b|Conflict|StateInvalid|Invalid state PENDING_|is in use|immutable`)},
+}
+
+// ClassifyFailure get the failure class of the command output: NotFound, Conflict, Auth,
+// RateLimited or Unknown.
+func ClassifyFailure(stderr string, stdout string) string {
+	for _, fc := range failureClasses {
+		if fc.Pattern.MatchString(stderr) || fc.Pattern.MatchString(stdout) {
+			return fc.Class
+		}
+	}
+	return "Unknown"
+}
+
+// AlreadyDone tells the failed create or delete has its desired state already: the object to create
+// exists, or the object to delete is not found.
+func (cmdctx *CommandContext) AlreadyDone() bool {
+	switch cmdctx.OperationType {
+	case "create":
+		return alreadyExistsRegexp.MatchString(cmdctx.Err)
+	case "delete":
+		return cmdctx.FailureClass == "NotFound"
+	}
+	return false
+}
+
+// Transient tells the failure may succeed when retried: Conflict, like the loadbalancer
+// pending, and RateLimited.
+func Transient(failureClass string) bool {
+	return failureClass == "Conflict" || failureClass == "RateLimited"
+}
+
+// TrackFailures count the failed command and get the reason to abort the batch when --max-failures or
+// --max-consecutive-failures is reached. The commands skipped are not counted.
+func (cmdctx *CommandContext) TrackFailures() string {
+	if cmdctx.SkipReason != "" {
+		return ""
+	}
+	if cmdctx.ExitCode == 0 && cmdctx.CheckErr == "" {
+		consecutiveFailures = 0
+		return ""
+	}
+	failureCount++
+	consecutiveFailures++
+	if maxFailures > 0 && failureCount >= maxFailures {
+		return fmt.Sprintf("%d commands failed, reaching --max-failures %d", failureCount, maxFailures)
+	}
+	if maxConsecutiveFailures > 0 && consecutiveFailures >= maxConsecutiveFailures {
+		return fmt.Sprintf("%d commands failed in a row, reaching --max-consecutive-failures %d", consecutiveFailures, maxConsecutiveFailures)
+	}
+	return ""
+}
+
+// TrackParentFailure remember the loadbalancer of the failed command, the commands skipped are not counted.
+func (cmdctx *CommandContext) TrackParentFailure() {
+	if cmdctx.LoadBalancer == "" || cmdctx.SkipReason != "" || (cmdctx.ExitCode == 0 && cmdctx.CheckErr == "") {
+		return
+	}
+	if _, ok := failedLoadBalancers[cmdctx.LoadBalancer]; !ok {
+		failedLoadBalancers[cmdctx.LoadBalancer] = cmdctx.Seq
+	}
+}
+
+// SkipForParentFailure mark the create or update command skipped if an earlier command of its
+// loadbalancer failed; deletes are skipped too with --skip-deletes-on-parent-failure.
+// Returns true if skipped.
+func (cmdctx *CommandContext) SkipForParentFailure() bool {
+	seq, ok := failedLoadBalancers[cmdctx.LoadBalancer]
+	if !ok || cmdctx.LoadBalancer == "" {
+		return false
+	}
+	switch cmdctx.OperationType {
+	case "create", "update":
+	case "delete":
+		if !skipDeletesOnParentFailure {
+			return false
+		}
+	default:
+		return false
+	}
+	cmdctx.ExitCode = -1
+	cmdctx.Err = fmt.Sprintf("skipped, loadbalancer %s failed in command %d", cmdctx.LoadBalancer, seq)
+	cmdctx.SkipReason = "skipped-parent-failure"
+	return true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	jsonPathFilterExpr string
+	jsonPathFilter     *JSONPathFilter
+
+	jsonPathFilterReg    = regexp.MustCompile(`^\$(\.results)?\[\?\((.+)\)\]$`)
+	jsonPathConditionReg = regexp.MustCompile(`^@\.([\w\.]+)\s*(==|!=|>=|<=|>|<)\s*(.+)$`)
+)
+
+// JSONPathFilter is the subset of JSONPath filter expressions applied on each result,
+// like $.results[?(@.resource_type == "member" && @.duration > 1000)].
+type JSONPathFilter struct {
+	Conditions []JSONPathCondition
+}
+
+// JSONPathCondition compares a field of the result with a literal value.
+type JSONPathCondition struct {
+	Field []string
+	Op    string
+	Value interface{}
+}
+
+// ParseJSONPathFilter parse the filter expression. Conditions can be joined with &&.
+func ParseJSONPathFilter(expr string) (*JSONPathFilter, error) {
+	m := jsonPathFilterReg.FindStringSubmatch(strings.TrimSpace(expr))
+	if m == nil {
+		return nil, fmt.Errorf("expect $.results[?(<conditions>)], got %s", expr)
+	}
+	filter := &JSONPathFilter{}
+	for _, n := range strings.Split(m[2], "&&") {
+		cm := jsonPathConditionReg.FindStringSubmatch(strings.TrimSpace(n))
+		if cm == nil {
+			return nil, fmt.Errorf("invalid condition %s, expect @.field <op> value", strings.TrimSpace(n))
+		}
+		v, err := parseJSONPathValue(strings.TrimSpace(cm[3]))
+		if err != nil {
+			return nil, err
+		}
+		filter.Conditions = append(filter.Conditions, JSONPathCondition{strings.Split(cm[1], "."), cm[2], v})
+	}
+	return filter, nil
+}
+
+func parseJSONPathValue(s string) (interface{}, error) {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1], nil
+	}
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %s, expect a quoted string, number, true, false or null", s)
+	}
+	return f, nil
+}
+
+// Match tells whether the result, as written to the output file, meets all the conditions.
+func (f *JSONPathFilter) Match(cmdctx *CommandContext) bool {
+	jd, _ := json.Marshal(cmdctx)
+	var doc interface{}
+	if json.Unmarshal(jd, &doc) != nil {
+		return false
+	}
+	for _, c := range f.Conditions {
+		v := doc
+		for _, k := range c.Field {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				v = nil
+				break
+			}
+			v = obj[k]
+		}
+		if !c.compare(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c JSONPathCondition) compare(v interface{}) bool {
+	switch c.Op {
+	case "==":
+		return v == c.Value
+	case "!=":
+		return v != c.Value
+	}
+
+	var r int
+	switch cv := c.Value.(type) {
+	case float64:
+		fv, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case fv < cv:
+			r = -1
+		case fv > cv:
+			r = 1
+		}
+	case string:
+		sv, ok := v.(string)
+		if !ok {
+			return false
+		}
+		r = strings.Compare(sv, cv)
+	default:
+		return false
+	}
+
+	switch c.Op {
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	case "<":
+		return r < 0
+	default:
+		return r <= 0
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	generateOnly   bool
+	generateFormat = "internal"
+	generateJSON   bool
+)
+
+// GeneratedCommand get the command line of cmdList entry n in generateFormat.
+func GeneratedCommand(n string) string {
+	if generateFormat == "neutron" {
+		_, _, n = SplitDepAnnotations(n)
+		_, n, _ = SplitEnvAnnotation(n)
+		lbAndCmd := strings.SplitN(n, "|", 2)
+		return "neutron " + lbAndCmd[len(lbAndCmd)-1]
+	}
+	return n
+}
+
+// GenerateCommands print the generated commands to stdout without execution.
+func GenerateCommands() int {
+	lines := []string{}
+	for _, n := range cmdList {
+		lines = append(lines, GeneratedCommand(n))
+	}
+
+	if generateJSON {
+		jd, _ := json.MarshalIndent(lines, "", "  ")
+		fmt.Println(string(jd))
+		return 0
+	}
+	for _, l := range lines {
+		fmt.Fprintln(os.Stdout, l)
+	}
+	return 0
+}
@@ -3,7 +3,12 @@ module f5-oslbaasv2-batchops
 go 1.15
 
 require (
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-sql-driver/mysql v1.5.0
+	github.com/gophercloud/gophercloud v0.14.0
+	github.com/prometheus/client_golang v1.8.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.14.0
 	gorm.io/driver/mysql v1.0.3
 	gorm.io/gorm v1.20.8
 )
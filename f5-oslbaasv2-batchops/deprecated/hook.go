@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	onFailureHook        string
+	onFailureHookTimeout = 30 * time.Second
+)
+
+// RunFailureHook run --on-failure-hook by sh with the failed command in the BATCHOPS_* environment
+// variables. The hook output is logged, and its failure never aborts the batch.
+func RunFailureHook(cmdctx *CommandContext) {
+	ctx, cancel := context.WithTimeout(context.Background(), onFailureHookTimeout)
+	defer cancel()
+
+	c := exec.CommandContext(ctx, "sh", "-c", onFailureHook)
+	c.Env = append(os.Environ(), FailureHookEnv(cmdctx)...)
+	out, err := c.CombinedOutput()
+	if len(out) > 0 {
+		logInfo("Command(%d/%d): Failure hook output: %s", cmdctx.Seq, len(cmdList), strings.TrimSpace(string(out)))
+	}
+	if err != nil {
+		logWarn("Command(%d/%d): Failure hook failed: %s", cmdctx.Seq, len(cmdList), err.Error())
+	}
+}
+
+// FailureHookEnv get the environment variables describing the failed command for the hook.
+func FailureHookEnv(cmdctx *CommandContext) []string {
+	return []string{
+		"BATCHOPS_RUN_ID=" + runMeta.RunID,
+		"BATCHOPS_SEQ=" + strconv.Itoa(cmdctx.Seq),
+		"BATCHOPS_COMMAND=" + cmdctx.Command,
+		"BATCHOPS_EXITCODE=" + strconv.Itoa(cmdctx.ExitCode),
+		"BATCHOPS_ERROR=" + cmdctx.Err,
+		"BATCHOPS_FAILURE_CLASS=" + cmdctx.FailureClass,
+		"BATCHOPS_LOADBALANCER=" + cmdctx.LoadBalancer,
+	}
+}
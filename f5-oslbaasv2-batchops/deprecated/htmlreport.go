@@ -0,0 +1,157 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"sort"
+	"time"
+)
+
+var reportHTML string
+
+// HTMLReport is the data rendered by --report-html, the same results as the output file.
+type HTMLReport struct {
+	Metadata   *RunMetadata
+	Results    []*CommandContext
+	Total      int
+	Succeeded  int
+	Failed     int
+	Skipped    int
+	Operations []HTMLOperation
+	Failures   []*CommandContext
+}
+
+// HTMLOperation is the average duration bar of a resource and operation type.
+type HTMLOperation struct {
+	Name    string
+	Count   int
+	AvgMs   int64
+	Percent int64
+}
+
+// NewHTMLReport summarize the results for the html report.
+func NewHTMLReport(results []*CommandContext) *HTMLReport {
+	rpt := &HTMLReport{Metadata: runMeta, Results: results, Total: len(results)}
+	totals := map[string]time.Duration{}
+	counts := map[string]int{}
+	for _, n := range results {
+		switch n.CommandStatus() {
+		case "success":
+			rpt.Succeeded++
+		case "skipped":
+			rpt.Skipped++
+		default:
+			rpt.Failed++
+			rpt.Failures = append(rpt.Failures, n)
+		}
+		if !n.StartedAt.IsZero() {
+			key := n.ResourceType + "-" + n.OperationType
+			totals[key] += n.Duration
+			counts[key]++
+		}
+	}
+
+	var maxMs int64 = 1
+	for key, total := range totals {
+		op := HTMLOperation{Name: key, Count: counts[key], AvgMs: (total / time.Duration(counts[key])).Milliseconds()}
+		if op.AvgMs > maxMs {
+			maxMs = op.AvgMs
+		}
+		rpt.Operations = append(rpt.Operations, op)
+	}
+	sort.Slice(rpt.Operations, func(i, j int) bool { return rpt.Operations[i].Name < rpt.Operations[j].Name })
+	for i := range rpt.Operations {
+		rpt.Operations[i].Percent = rpt.Operations[i].AvgMs * 100 / maxMs
+	}
+	return rpt
+}
+
+// WriteHTMLReport render the results to reportHTML, a single file without external assets.
+func WriteHTMLReport() {
+	f, err := os.Create(reportHTML)
+	if err != nil {
+		logger.Printf("Failed to create html report %s: %s", reportHTML, err.Error())
+		return
+	}
+	defer f.Close()
+
+	if err := htmlReportTemplate.Execute(f, NewHTMLReport(cmdResults.Sorted())); err != nil {
+		logger.Printf("Failed to render html report %s: %s", reportHTML, err.Error())
+		return
+	}
+	logger.Printf("Writen html report to file %s", reportHTML)
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms":     func(d time.Duration) int64 { return d.Milliseconds() },
+	"status": func(n *CommandContext) string { return n.CommandStatus() },
+	"time":   func(t time.Time) string { return t.Format("2006-01-02 15:04:05.000") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>f5-oslbaasv2-batchops run {{.Metadata.RunID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; font-size: 13px; }
+th { background: #eee; cursor: pointer; }
+tr.success td.status { color: #1a7f37; }
+tr.failed td.status { color: #cf222e; font-weight: bold; }
+tr.skipped td.status { color: #9a6700; }
+.meta td:first-child { font-weight: bold; width: 12em; }
+.bar { background: #4a90d9; height: 14px; }
+.summary span { display: inline-block; margin-right: 2em; font-size: 18px; }
+pre { background: #f6f8fa; padding: 8px; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Execution Report</h1>
+<table class="meta">
+<tr><td>Run ID</td><td>{{.Metadata.RunID}}</td></tr>
+<tr><td>Started</td><td>{{time .Metadata.StartedAt}}</td></tr>
+<tr><td>Finished</td><td>{{time .Metadata.FinishedAt}}</td></tr>
+<tr><td>Command Line</td><td>{{.Metadata.CommandLine}}</td></tr>
+<tr><td>Hostname</td><td>{{.Metadata.Hostname}}</td></tr>
+<tr><td>OS_AUTH_URL</td><td>{{.Metadata.AuthURL}}</td></tr>
+<tr><td>OS_PROJECT_NAME</td><td>{{.Metadata.ProjectName}}</td></tr>
+<tr><td>Neutron Version</td><td>{{.Metadata.NeutronVersion}}</td></tr>
+</table>
+<div class="summary">
+<span>Total: {{.Total}}</span><span>Succeeded: {{.Succeeded}}</span><span>Failed: {{.Failed}}</span><span>Skipped: {{.Skipped}}</span>
+</div>
+<h2>Average Duration</h2>
+<table>
+<tr><th>Operation</th><th>Count</th><th>Average(ms)</th><th style="width:50%"></th></tr>
+{{range .Operations}}<tr><td>{{.Name}}</td><td>{{.Count}}</td><td>{{.AvgMs}}</td><td><div class="bar" style="width:{{.Percent}}%"></div></td></tr>
+{{end}}</table>
+<h2>Commands</h2>
+<table id="commands">
+<thead><tr><th>Seq</th><th>Command</th><th>Status</th><th>Exit Code</th><th>Started</th><th>Duration(ms)</th></tr></thead>
+<tbody>
+{{range .Results}}<tr class="{{status .}}"><td>{{.Seq}}</td><td>{{.Command}}</td><td class="status">{{status .}}</td><td>{{.ExitCode}}</td><td>{{time .StartedAt}}</td><td>{{ms .Duration}}</td></tr>
+{{end}}</tbody>
+</table>
+<h2>Failed Commands</h2>
+{{range .Failures}}<details><summary>{{.Seq}}: {{.Command}}</summary><pre>{{.Err}}</pre></details>
+{{else}}<p>None</p>
+{{end}}
+<script>
+document.querySelectorAll("#commands th").forEach(function(th, col) {
+  var asc = true;
+  th.addEventListener("click", function() {
+    var tbody = document.querySelector("#commands tbody");
+    var rows = Array.prototype.slice.call(tbody.rows);
+    rows.sort(function(a, b) {
+      var x = a.cells[col].textContent, y = b.cells[col].textContent;
+      var c = (isNaN(x) || isNaN(y)) ? x.localeCompare(y) : x - y;
+      return asc ? c : -c;
+    });
+    asc = !asc;
+    rows.forEach(function(r) { tbody.appendChild(r); });
+  });
+});
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+)
+
+var reportJUnit string
+
+// JUnitTestSuites is the root of the JUnit XML report.
+type JUnitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []JUnitTestSuite `xml:"testsuite"`
+}
+
+// JUnitTestSuite is the run, with the commands as test cases.
+type JUnitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Hostname   string          `xml:"hostname,attr"`
+	Properties []JUnitProperty `xml:"properties>property"`
+	TestCases  []JUnitTestCase `xml:"testcase"`
+}
+
+// JUnitProperty is a run metadata entry.
+type JUnitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// JUnitTestCase is one command.
+type JUnitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *JUnitMessage `xml:"failure,omitempty"`
+	Skipped   *JUnitMessage `xml:"skipped,omitempty"`
+}
+
+// JUnitMessage is the failure or skipped element.
+type JUnitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// NewJUnitReport map each result to a test case. Commands exit non-zero or failing
+// the --check-done verification are failures, and commands not ready to run are skipped.
+func NewJUnitReport(results []*CommandContext) *JUnitTestSuites {
+	suite := JUnitTestSuite{
+		Name:      "f5-oslbaasv2-batchops",
+		Tests:     len(results),
+		Timestamp: runMeta.StartedAt.Format("2006-01-02T15:04:05"),
+		Hostname:  runMeta.Hostname,
+		Properties: []JUnitProperty{
+			{"run_id", runMeta.RunID},
+			{"command_line", runMeta.CommandLine},
+			{"os_auth_url", runMeta.AuthURL},
+			{"neutron_version", runMeta.NeutronVersion},
+		},
+		TestCases: []JUnitTestCase{},
+	}
+	if !runMeta.FinishedAt.IsZero() {
+		suite.Time = fmt.Sprintf("%.3f", runMeta.FinishedAt.Sub(runMeta.StartedAt).Seconds())
+	}
+
+	for _, n := range results {
+		tc := JUnitTestCase{
+			ClassName: n.ResourceType + "." + n.OperationType,
+			Name:      n.Command,
+			Time:      fmt.Sprintf("%.3f", n.Duration.Seconds()),
+		}
+		switch {
+		case n.ExitCode == -1:
+			tc.Skipped = &JUnitMessage{Message: n.Err}
+			suite.Skipped++
+		case n.ExitCode != 0:
+			tc.Failure = &JUnitMessage{Message: fmt.Sprintf("exited with %d", n.ExitCode), Type: "ExitCode", Text: n.Err}
+			suite.Failures++
+		case n.CheckErr != "":
+			tc.Failure = &JUnitMessage{Message: n.CheckErr, Type: "Verification"}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	return &JUnitTestSuites{Suites: []JUnitTestSuite{suite}}
+}
+
+// WriteJUnitReport write the results as JUnit XML to reportJUnit.
+func WriteJUnitReport() {
+	xd, _ := xml.MarshalIndent(NewJUnitReport(cmdResults.Sorted()), "", "  ")
+	data := append([]byte(xml.Header), xd...)
+	if err := ioutil.WriteFile(reportJUnit, append(data, '\n'), 0644); err != nil {
+		logger.Printf("Failed to write junit report %s: %s", reportJUnit, err.Error())
+		return
+	}
+	logger.Printf("Writen junit report to file %s", reportJUnit)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ResolveLoadBalancer set the loadbalancer checked for the command when it is not given,
+// or, for member commands, when the owning loadbalancer of the pool is found in database.
+// The given loadbalancer is kept if the resolution fails.
+func (cmdctx *CommandContext) ResolveLoadBalancer() {
+	logPrefix := fmt.Sprintf("Command(%d/%d):", cmdctx.Seq, len(cmdList))
+	if cmdctx.ReadOnly() {
+		return
+	}
+	if cmdctx.LoadBalancer != "" && (cmdctx.ResourceType != "member" || dbConn == nil || lbaasAPIVersion != "v2") {
+		return
+	}
+
+	lb, err := cmdctx.DerivedLoadBalancer()
+	if err != nil {
+		logWarn("%s Cannot derive loadbalancer from command: %s", logPrefix, err.Error())
+		return
+	}
+	if lb != cmdctx.LoadBalancer {
+		logInfo("%s Derived loadbalancer %s from command", logPrefix, lb)
+		cmdctx.LoadBalancer = lb
+	}
+}
+
+// DerivedLoadBalancer find the loadbalancer operated by the command from its own arguments,
+// for commands without --loadbalancer given. Parents of other objects are resolved from database.
+func (cmdctx *CommandContext) DerivedLoadBalancer() (string, error) {
+	if lbaasAPIVersion != "v2" {
+		return "", fmt.Errorf("deriving loadbalancer supports neutron lbaas v2 only")
+	}
+	if lb := ArgValue(cmdctx.Command, "--loadbalancer"); lb != "" {
+		return lb, nil
+	}
+
+	args := PositionalArgs(cmdctx.Command)
+	if cmdctx.ResourceType == "loadbalancer" {
+		if cmdctx.OperationType == "create" {
+			args = []string{ArgValue(cmdctx.Command, "--name")}
+		}
+		if len(args) == 0 || args[0] == "" {
+			return "", fmt.Errorf("no loadbalancer in command")
+		}
+		return args[0], nil
+	}
+
+	if listener := ArgValue(cmdctx.Command, "--listener"); listener != "" {
+		return LoadBalancerOf("listener", listener)
+	}
+	if pool := ArgValue(cmdctx.Command, "--pool"); pool != "" {
+		return LoadBalancerOf("pool", pool)
+	}
+
+	switch cmdctx.ResourceType {
+	case "member":
+		// lbaas-member-create ... POOL, lbaas-member-update MEMBER POOL
+		if len(args) == 0 {
+			return "", fmt.Errorf("no pool in command")
+		}
+		return LoadBalancerOf("pool", args[len(args)-1])
+	case "l7rule":
+		// lbaas-l7rule-create ... L7POLICY, lbaas-l7rule-update L7RULE L7POLICY
+		if len(args) == 0 {
+			return "", fmt.Errorf("no l7policy in command")
+		}
+		return LoadBalancerOf("l7policy", args[len(args)-1])
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("no %s in command", cmdctx.ResourceType)
+	}
+	return LoadBalancerOf(cmdctx.ResourceType, args[0])
+}
+
+// LoadBalancerOf get the id of the loadbalancer the object, by id or name, belongs to from database.
+func LoadBalancerOf(objectType string, objectIDName string) (string, error) {
+	if dbConn == nil {
+		return "", fmt.Errorf("--mysql-uri is required to find the loadbalancer of %s %s", objectType, objectIDName)
+	}
+
+	column := "loadbalancer_id"
+	table := lbaasSchema.Tables[objectType]
+	switch objectType {
+	case "pool":
+		return PoolLoadBalancerFromDB(objectIDName)
+	case "listener":
+	case "healthmonitor":
+		id, err := singleColumn(table, "id", objectIDName)
+		if err != nil {
+			return "", err
+		}
+		return singleColumnBy(lbaasSchema.Tables["pool"], column, "healthmonitor_id", id)
+	case "l7policy":
+		listener, err := singleColumn(table, "listener_id", objectIDName)
+		if err != nil {
+			return "", err
+		}
+		return LoadBalancerOf("listener", listener)
+	default:
+		return "", fmt.Errorf("unknown object type %s", objectType)
+	}
+	return singleColumn(table, column, objectIDName)
+}
+
+// PoolLoadBalancerFromDB walk lbaas_pools -> lbaas_listeners -> lbaas_loadbalancers to find
+// the owning loadbalancer of the pool, by id or name. The pool's own loadbalancer_id is preferred,
+// the listener using it as the default pool is taken for the pools without.
+func PoolLoadBalancerFromDB(pool string) (string, error) {
+	values := []string{}
+	query := dbConn.Table("lbaas_pools AS p").
+		Joins("LEFT JOIN lbaas_listeners AS l ON l.default_pool_id = p.id").
+		Joins("JOIN lbaas_loadbalancers AS lb ON lb.id = COALESCE(p.loadbalancer_id, l.loadbalancer_id)").
+		Where("p.id = ? OR p.name = ?", pool, pool)
+	if projectID != "" {
+		query = query.Where("p.project_id = ?", projectID)
+	}
+	if err := query.Distinct().Pluck("lb.id", &values).Error; err != nil {
+		return "", err
+	}
+	if len(values) != 1 {
+		return "", fmt.Errorf("pool %s belongs to %d loadbalancers", pool, len(values))
+	}
+	return values[0], nil
+}
+
+// singleColumn get the column of the only object with the id or name.
+func singleColumn(table string, column string, objectIDName string) (string, error) {
+	values := []string{}
+	query := dbConn.Table(table).Where("id = ? OR name = ?", objectIDName, objectIDName)
+	if projectID != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", lbaasSchema.ProjectColumn), projectID)
+	}
+	if err := query.Pluck(column, &values).Error; err != nil {
+		return "", err
+	}
+	if len(values) != 1 {
+		return "", fmt.Errorf("%s %s has %d records", table, objectIDName, len(values))
+	}
+	return values[0], nil
+}
+
+// singleColumnBy get the column of the only row where by equals value.
+func singleColumnBy(table string, column string, by string, value string) (string, error) {
+	values := []string{}
+	if err := dbConn.Table(table).Where(fmt.Sprintf("%s = ?", by), value).Pluck(column, &values).Error; err != nil {
+		return "", err
+	}
+	if len(values) != 1 {
+		return "", fmt.Errorf("%s with %s %s has %d records", table, by, value, len(values))
+	}
+	return values[0], nil
+}
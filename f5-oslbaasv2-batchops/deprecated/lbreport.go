@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// finalLBStatuses are the provisioning and operating statuses of the loadbalancers fetched at the end of the run.
+var finalLBStatuses = map[string][2]string{}
+
+// LoadBalancerStats is the breakdown of the results of a loadbalancer.
+type LoadBalancerStats struct {
+	LoadBalancer       string `json:"loadbalancer"`
+	Commands           int    `json:"commands"`
+	Failures           int    `json:"failures"`
+	TotalDurationMs    int64  `json:"total_duration_ms"`
+	AverageDurationMs  int64  `json:"average_duration_ms"`
+	ReadyWaitMs        int64  `json:"ready_wait_ms"`
+	ProvisioningStatus string `json:"provisioning_status,omitempty"`
+	OperatingStatus    string `json:"operating_status,omitempty"`
+}
+
+// LoadBalancerBreakdown group the results by loadbalancer, the ones with the most failures then the longest
+// total duration first. Failures are counted as in the summary. The commands without loadbalancer are left out.
+func LoadBalancerBreakdown(results []*CommandContext) []*LoadBalancerStats {
+	byLB := map[string]*LoadBalancerStats{}
+	stats := []*LoadBalancerStats{}
+	for _, n := range results {
+		if n.LoadBalancer == "" {
+			continue
+		}
+		s, ok := byLB[n.LoadBalancer]
+		if !ok {
+			s = &LoadBalancerStats{LoadBalancer: n.LoadBalancer}
+			if st, ok := finalLBStatuses[n.LoadBalancer]; ok {
+				s.ProvisioningStatus, s.OperatingStatus = st[0], st[1]
+			}
+			byLB[n.LoadBalancer] = s
+			stats = append(stats, s)
+		}
+		s.Commands++
+		if n.ExitCode != 0 || n.CheckErr != "" {
+			s.Failures++
+		}
+		s.TotalDurationMs += n.Duration.Milliseconds()
+		s.ReadyWaitMs += n.WaitDuration.Milliseconds()
+	}
+	for _, s := range stats {
+		s.AverageDurationMs = s.TotalDurationMs / int64(s.Commands)
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Failures != stats[j].Failures {
+			return stats[i].Failures > stats[j].Failures
+		}
+		return stats[i].TotalDurationMs > stats[j].TotalDurationMs
+	})
+	return stats
+}
+
+// FetchFinalLBStatuses show each loadbalancer of the results once, for the final statuses in the breakdown.
+// The ones failed to show, like the deleted ones, are recorded as NOT_FOUND.
+func FetchFinalLBStatuses(results []*CommandContext) {
+	for _, n := range results {
+		if _, ok := finalLBStatuses[n.LoadBalancer]; ok || n.LoadBalancer == "" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		obj, err := ShowFromCmd(ctx, lbaasSchema.LoadBalancerType, n.LoadBalancer)
+		cancel()
+		if err != nil {
+			logInfo("Failed to fetch the final status of loadbalancer %s: %s", n.LoadBalancer, err.Error())
+			finalLBStatuses[n.LoadBalancer] = [2]string{"NOT_FOUND", ""}
+			continue
+		}
+		status, ok := obj["provisioning_status"]
+		if !ok {
+			// lbaas v1 pools have status only.
+			status = obj["status"]
+		}
+		operating, _ := obj["operating_status"].(string)
+		finalLBStatuses[n.LoadBalancer] = [2]string{fmt.Sprint(status), operating}
+	}
+}
+
+// PrintLoadBalancerBreakdown print the results by loadbalancer, the problem ones at the top.
+func PrintLoadBalancerBreakdown() {
+	stats := LoadBalancerBreakdown(cmdResults.Sorted())
+	if len(stats) == 0 {
+		return
+	}
+	fmt.Println(Colorize(colorBold, "Loadbalancer Breakdown:"))
+	fmt.Printf("%-36s %8s %8s %10s %8s %10s %s\n", "LOADBALANCER", "COMMANDS", "FAILURES", "TOTAL ms", "AVG ms", "WAIT ms", "STATUS")
+	for _, s := range stats {
+		status := s.ProvisioningStatus
+		if s.OperatingStatus != "" {
+			status += "/" + s.OperatingStatus
+		}
+		line := fmt.Sprintf("%-36s %8d %8d %10d %8d %10d %s", s.LoadBalancer, s.Commands, s.Failures,
+			s.TotalDurationMs, s.AverageDurationMs, s.ReadyWaitMs, status)
+		if s.Failures > 0 {
+			line = Colorize(colorRed, line)
+		}
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
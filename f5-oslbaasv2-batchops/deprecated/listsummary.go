@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	summaryColumns string
+
+	// summaryColumnList is the parsed --summary-columns.
+	summaryColumnList []string
+)
+
+// ListSummary is the --summary-columns of the objects listed by a list command.
+type ListSummary struct {
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+	// Missing are the columns none of the objects has, like the ones not listed without --show-details.
+	Missing []string `json:"missing,omitempty"`
+	Err     string   `json:"error,omitempty"`
+}
+
+// ParseSummaryColumns split --summary-columns, like id,name,provisioning_status, dropping the empty ones.
+func ParseSummaryColumns(s string) []string {
+	columns := []string{}
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			columns = append(columns, n)
+		}
+	}
+	return columns
+}
+
+// SummarizeList tabulate the --summary-columns of the objects in the json output of the list command.
+// The columns an object has not are shown as "-", the output not a json list is noted in the summary.
+func (cmdctx *CommandContext) SummarizeList() {
+	summary := &ListSummary{Columns: summaryColumnList, Rows: [][]string{}}
+	cmdctx.ListSummary = summary
+
+	var objs []map[string]interface{}
+	if err := json.Unmarshal([]byte(cmdctx.RawOut), &objs); err != nil {
+		summary.Err = fmt.Sprintf("output is not a json list: %s", err.Error())
+		return
+	}
+	found := map[string]bool{}
+	for _, obj := range objs {
+		row := make([]string, len(summary.Columns))
+		for i, c := range summary.Columns {
+			v, ok := obj[c]
+			found[c] = found[c] || ok
+			row[i] = summaryValue(v)
+		}
+		summary.Rows = append(summary.Rows, row)
+	}
+	if len(objs) == 0 {
+		return
+	}
+	for _, c := range summary.Columns {
+		if !found[c] {
+			summary.Missing = append(summary.Missing, c)
+		}
+	}
+}
+
+// summaryValue format the field as a table cell, the absent or empty ones as "-".
+func summaryValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		if v == "" {
+			return "-"
+		}
+		return v
+	default:
+		jd, _ := json.Marshal(v)
+		return string(jd)
+	}
+}
+
+// PrintListSummaries print the --summary-columns table of each list command.
+func PrintListSummaries() {
+	printed := false
+	for _, n := range cmdResults.Sorted() {
+		if n.ListSummary == nil {
+			continue
+		}
+		if !printed {
+			fmt.Println(Colorize(colorBold, "List Summaries:"))
+			printed = true
+		}
+		fmt.Printf("%d: %s\n", n.Seq, n.Command)
+		summary := n.ListSummary
+		if summary.Err != "" {
+			fmt.Println(Colorize(colorYellow, "    "+summary.Err))
+			continue
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "    %s\n", strings.ToUpper(strings.Join(summary.Columns, "\t")))
+		for _, row := range summary.Rows {
+			fmt.Fprintf(w, "    %s\n", strings.Join(row, "\t"))
+		}
+		w.Flush()
+		fmt.Printf("    (%d objects)\n", len(summary.Rows))
+		if len(summary.Missing) > 0 {
+			fmt.Println(Colorize(colorYellow, fmt.Sprintf("    columns not in the output: %s", strings.Join(summary.Missing, ", "))))
+		}
+	}
+	if printed {
+		fmt.Println()
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	lockDir  string
+	lockWait time.Duration
+	lockTTL  time.Duration
+
+	lockInterval = 5 * time.Second
+	lockRegexp   = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+	// lockPaths the lock files held by this run.
+	lockPaths = []string{}
+	lockMutex sync.Mutex
+)
+
+// LockInfo is the content of the lock file of a loadbalancer.
+type LockInfo struct {
+	PID       int       `json:"pid"`
+	Hostname  string    `json:"hostname"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// LockPath is the lock file of the loadbalancer in --lock-dir, of the cloud of --openrc if any.
+func LockPath(lb string) string {
+	if cloudName != "" {
+		lb = cloudName + "_" + lb
+	}
+	return filepath.Join(lockDir, lockRegexp.ReplaceAllString(lb, "_")+".lock")
+}
+
+// LockedLoadBalancers get the distinct loadbalancers named in the commands, sorted.
+func LockedLoadBalancers(commands []string) []string {
+	found := map[string]bool{}
+	for _, n := range commands {
+		_, _, line := SplitDepAnnotations(n)
+		_, line, err := SplitEnvAnnotation(line)
+		if err != nil {
+			continue
+		}
+		lbAndCmd := strings.SplitN(line, "|", 2)
+		lb := lbAndCmd[0]
+		if lb == "" && len(lbAndCmd) == 2 {
+			lb = ArgValue(lbAndCmd[1], "--loadbalancer")
+		}
+		if lb != "" {
+			found[lb] = true
+		}
+	}
+	lbs := []string{}
+	for lb := range found {
+		lbs = append(lbs, lb)
+	}
+	sort.Strings(lbs)
+	return lbs
+}
+
+// Stale tell if the lock is left by a dead process on this host, or older than --lock-ttl.
+func (info LockInfo) Stale(hostname string) bool {
+	if lockTTL > 0 && time.Since(info.StartedAt) > lockTTL {
+		return true
+	}
+	if info.Hostname != hostname || info.PID <= 0 {
+		return false
+	}
+	return syscall.Kill(info.PID, 0) == syscall.ESRCH
+}
+
+// tryLock create the lock file of the loadbalancer, breaking a stale one.
+// Returns the holder of the lock if it is held by another run.
+func tryLock(lb string, info LockInfo) (*LockInfo, error) {
+	path := LockPath(lb)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			jd, _ := json.Marshal(info)
+			_, err = f.Write(jd)
+			f.Close()
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			lockMutex.Lock()
+			lockPaths = append(lockPaths, path)
+			lockMutex.Unlock()
+			return nil, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		var holder LockInfo
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// the lock being written is taken as fresh.
+		if json.Unmarshal(data, &holder) != nil {
+			holder = LockInfo{StartedAt: time.Now()}
+		}
+		if !holder.Stale(info.Hostname) {
+			return &holder, nil
+		}
+		logger.Printf("Breaking stale lock %s of pid %d on %s since %s", path, holder.PID, holder.Hostname,
+			holder.StartedAt.Format(time.RFC3339))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// AcquireLocks lock the loadbalancers in --lock-dir for the batch runs not to interleave on them.
+// A lock held by another run is waited up to --lock-wait; the locks taken are released on failure.
+func AcquireLocks(lbs []string) error {
+	if err := os.MkdirAll(lockDir, 0755); err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	info := LockInfo{PID: os.Getpid(), Hostname: hostname, StartedAt: time.Now()}
+
+	deadline := time.Now().Add(lockWait)
+	for _, lb := range lbs {
+		for {
+			holder, err := tryLock(lb, info)
+			if err != nil {
+				ReleaseLocks()
+				return fmt.Errorf("failed to lock loadbalancer %s: %s", lb, err.Error())
+			}
+			if holder == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				ReleaseLocks()
+				return fmt.Errorf("loadbalancer %s is locked by pid %d on %s since %s, see %s",
+					lb, holder.PID, holder.Hostname, holder.StartedAt.Format(time.RFC3339), LockPath(lb))
+			}
+			logger.Printf("Loadbalancer %s is locked by pid %d on %s, waiting", lb, holder.PID, holder.Hostname)
+			time.Sleep(lockInterval)
+		}
+	}
+	return nil
+}
+
+// ReleaseLocks remove the lock files held by this run.
+func ReleaseLocks() {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+	for _, n := range lockPaths {
+		if err := os.Remove(n); err != nil && !os.IsNotExist(err) {
+			logger.Printf("Failed to remove lock %s: %s", n, err.Error())
+		}
+	}
+	lockPaths = []string{}
+}
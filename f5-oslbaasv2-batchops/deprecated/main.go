@@ -1,22 +1,32 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"reflect"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"f5-oslbaasv2-batchops/pkg/batch"
+	"f5-oslbaasv2-batchops/pkg/status"
+	"f5-oslbaasv2-batchops/pkg/template"
+	"f5-oslbaasv2-batchops/pkg/version"
+
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -34,415 +44,1440 @@ type NeutronResponse struct {
 	ID                 string `json:"id"`
 	Name               string `json:"name"`
 	ProvisioningStatus string `json:"provisioning_status"`
+	ProjectID          string `json:"project_id"`
+	Status             string `json:"status" gorm:"-"`
+	OperatingStatus    string `json:"operating_status" gorm:"-"`
 }
 
 // CommandContext saved command information and analytics data.
 type CommandContext struct {
-	Seq           int           `json:"seqnum"`
-	Command       string        `json:"command"`
-	ObjectID      string        `json:"object_id"`
-	RawOut        string        `json:"output"`
-	Err           string        `json:"error"`
-	CLIRequests   []string      `json:"cli_requests"`
-	ExitCode      int           `json:"exitcode"`
-	Duration      time.Duration `json:"duration"`
-	ResourceType  string        `json:"resource_type"`
-	OperationType string        `json:"operation_type"`
-	LoadBalancer  string        `json:"loadbalancer"`
+	batch.CommandContext
+
+	RawOutBytes  int               `json:"output_bytes,omitempty"`
+	Parsed       interface{}       `json:"parsed,omitempty"`
+	ParseErr     string            `json:"parse_error,omitempty"`
+	Cloud        string            `json:"cloud,omitempty"`
+	Label        string            `json:"label,omitempty"`
+	Needs        []string          `json:"needs,omitempty"`
+	Env          map[string]string `json:"env,omitempty"`
+	AuditHash    string            `json:"audit_hash,omitempty"`
+	SkipReason   string            `json:"skip_reason,omitempty"`
+	CheckErr     string            `json:"check_error,omitempty"`
+	FailureClass string            `json:"failure_class,omitempty"`
+	RawExitCode  int               `json:"raw_exitcode,omitempty"`
+	HTTPStatus   int               `json:"http_status,omitempty"`
+	Retries      int               `json:"retries,omitempty"`
+	StartupMs    int64             `json:"startup_ms,omitempty"`
+	APICallMs    int64             `json:"api_call_ms,omitempty"`
+	Probe        *ProbeResult      `json:"probe,omitempty"`
+	BIGIPDrift   string            `json:"bigip_drift,omitempty"`
+
+	// bigipObject is the object shown before it is deleted, for --bigip-host.
+	bigipObject map[string]interface{}
+
+	Before map[string]interface{} `json:"before,omitempty"`
+	After  map[string]interface{} `json:"after,omitempty"`
+	Diff   map[string]FieldDiff   `json:"diff,omitempty"`
+
+	// TemplatePosition is the 1-based position of the generated command in the template expansion order.
+	TemplatePosition int `json:"template_position,omitempty"`
+	// OperatingStatus is the last operating_status checked with --wait-operating-status.
+	OperatingStatus string `json:"operating_status,omitempty"`
+	// Artifacts are the files of the command with --artifacts-dir.
+	Artifacts *CommandArtifacts `json:"artifacts,omitempty"`
+	// ListSummary is the --summary-columns table of a list command.
+	ListSummary *ListSummary `json:"list_summary,omitempty"`
 }
 
 var (
 	logger  = log.New(os.Stdout, "", log.LstdFlags)
-	usage   = fmt.Sprintf("Usage: \n\n    %s [command arguments] -- <neutron command and arguments>[ ++ variable-definition]\n\n", os.Args[0])
+	usage   = fmt.Sprintf("Usage: \n\n    %s [mode] [command arguments] -- <neutron command and arguments>[ ++ variable-definition]\n\n", os.Args[0])
 	example = fmt.Sprintf("Example:\n\n    %s --output-filepath ./out.json \\\n    "+
 		"-- loadbalancer-create --name lb%s %s \\\n    ++ x:1-5 y:private-subnet,public-subnet\n\n", os.Args[0], "{x}", "{y}")
-	varRegexp      = regexp.MustCompile(`%\{[a-zA-Z_][a-zA-Z0-9_]*\}`)
-	cliTraceRegexp = regexp.MustCompile(`\w+ call to .* used request id req-.*`)
 
 	cmdList = []string{}
 
-	outputFilePath string
-	loadbalancer   string
-	outputFile     *os.File
+	outputFilePath    string
+	outputFormat      string
+	seqFilePath       string
+	commandsFile      string
+	compactOutput     bool
+	prettyOutput      bool
+	dedupe            bool
+	sortReport        string
+	excludeSuccessful bool
+	excludeSkipped    bool
+	loadbalancer      string
+	outputFile        OutputSinks
+	// recordsWritten counts the records streamed by WriteRecord in the jsonl format.
+	recordsWritten int32
 	mysqluri       string
+	projectID      string
 	checkDone      bool
 	dbConn         *gorm.DB = nil
 
-	cmdResults = []*CommandContext{}
+	cmdResults = NewResultCollector()
 	cmdPrefix  = "neutron --debug "
 
-	chsig = make(chan os.Signal)
+	// neutronFormat is the --format of the neutron commands.
+	neutronFormat = "json"
+
+	chsig = make(chan os.Signal, 1)
+
+	// draining is set by the first signal to stop starting commands; drained is closed when
+	// the running command is finished.
+	draining     int32
+	drained      = make(chan struct{})
+	drainTimeout = 30 * time.Second
+	// finishing is set by the path finalizing the run, main or signalProcess, for the other to leave it.
+	finishing int32
+	// killTimeout is the time for the killed command to be recorded before quitting.
+	killTimeout = 5 * time.Second
+
+	// waitCtx is canceled by the first signal to stop the status checks, commandCtx when quitting
+	// to kill the running command.
+	waitCtx, cancelWait       = context.WithCancel(context.Background())
+	commandCtx, cancelCommand = context.WithCancel(context.Background())
 
 	maxCheckTimes = 64
+
+	// interCommandDelay paces commands, create/update/delete are already paced by the readiness polling.
+	interCommandDelay = time.Second
+	noSleep           = false
+
+	// failoverThresholdMs the database query time to fail over to neutron command.
+	failoverThresholdMs int64 = 5000
+	dbRecoverQueries          = 5
+	// dbFailover switches the loadbalancer status checks between the database and neutron command.
+	dbFailover = status.NewFailover(status.FailoverOptions{})
+
+	// maxCommands guards against runaway templates.
+	maxCommands = 5000
+	assumeYes   = false
+
+	envValidation = ""
+
+	quiet    = false
+	verbose  = false
+	logFile  = ""
+	logLevel = "info"
+	// logLevels in ascending severity, errors are always logged.
+	logLevels = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+	helpAll     = false
+	showVersion = false
+	// flagEnvVars environment variables the flags default from.
+	flagEnvVars = map[string]string{
+		"os-project-id": "OS_PROJECT_ID, OS_TENANT_ID",
+		"no-color":      "NO_COLOR",
+		"db-username":   "BATCHOPS_DB_USERNAME",
+		"db-password":   "BATCHOPS_DB_PASSWORD",
+		"db-host":       "BATCHOPS_DB_HOST",
+		"db-port":       "BATCHOPS_DB_PORT",
+		"db-name":       "BATCHOPS_DB_NAME",
+	}
+	// flagModeAliases the flags selecting a mode.
+	flagModeAliases = map[string]string{
+		"generate-only": "generate",
+	}
+	// flagExamples example values of the flags.
+	flagExamples = map[string]string{
+		"output-filepath":          "./out.json",
+		"output-format":            "jsonl",
+		"max-check-times":          "128",
+		"inter-command-delay":      "500ms",
+		"loadbalancer":             "lb1",
+		"mysql-uri":                "neutron:password@tcp(1.2.3.4:3306)/ovs_neutron",
+		"bulk-status-file":         "./objects.csv",
+		"unstick-lb":               "7b7743eb-d70f-417b-83c6-9bb9b5f8e5df",
+		"unstick-status":           "ERROR",
+		"unstick-min-age":          "30m",
+		"os-project-id":            "38ac07a46dad448cb93bec736ba89f1c",
+		"command-list-to-graphviz": "./commands.dot",
+	}
+
+	mode  = "run"
+	modes = map[string]string{
+		"run":          "execute the neutron command template, the default",
+		"runs":         "list the past runs stored by --store-results",
+		"report":       "print the report of the results stored by --store-results, within --report-since and --report-until",
+		"scan":         "list lbaas objects stuck in PENDING_* or ERROR from database",
+		"bulk-status":  "get provisioning status of objects listed in --bulk-status-file from database",
+		"unstick":      "reset a loadbalancer stuck in PENDING_* in database, with --unstick-lb",
+		"export":       "write the object tree of --loadbalancer to --output-filepath",
+		"import":       "create the object tree in --scenario-file",
+		"verify-audit": "verify the audit hashes in --verify-file with --audit-hmac-key",
+		"generate":     "print the commands generated from the template to stdout without execution",
+		"audit":        "report the drift between the database and the BIG-IP of --loadbalancer or --os-project-id",
+	}
+
+	// lbaasAPIVersion v1 uses lb-* subcommands and tables, and has no loadbalancer object:
+	// the pool is the object checked for readiness.
+	lbaasAPIVersion = "v2"
+	lbaasSchema     = status.V2
 )
 
 func main() {
 
 	HandleArguments()
 
+	switch mode {
+	case "scan":
+		os.Exit(ScanStuckObjects())
+	case "export":
+		os.Exit(ExportScenario())
+	case "bulk-status":
+		os.Exit(BulkStatus())
+	case "verify-audit":
+		os.Exit(VerifyAudit())
+	case "runs":
+		os.Exit(ListRuns())
+	case "report":
+		os.Exit(ReportResults())
+	case "unstick":
+		os.Exit(UnstickLoadbalancer())
+	case "generate":
+		os.Exit(GenerateCommands())
+	case "audit":
+		os.Exit(AuditBIGIP())
+	}
+
+	if err := ValidateCommands(cmdList); err != nil {
+		exitf(exitUsage, "Invalid commands: %s", err.Error())
+	}
+	if err := CheckOperationPolicy(cmdList); err != nil {
+		exitf(exitUsage, "%s", err.Error())
+	}
+
+	if validateRefs {
+		if err := ValidateRefs(); err != nil {
+			exitf(exitUsage, "%s", err.Error())
+		}
+	}
+
+	if len(cloudOpenRCs) > 0 {
+		os.Exit(RunClouds())
+	}
+
 	signal.Notify(chsig, syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGKILL)
 	go signalProcess()
 
-	if !strings.Contains(strings.Join(os.Environ(), ","), "OS_USERNAME=") {
-		fmt.Println("No OS_USERNAME environment found. Execute `source <path/to/openrc>` first!")
+	if openrcPath != "" {
+		if err := LoadOpenRC(); err != nil {
+			exitf(exitEnv, "Failed to parse openrc file %s: %s", openrcPath, err.Error())
+		}
+		if openrcWatch {
+			stop, err := WatchOpenRC()
+			if err != nil {
+				exitf(exitEnv, "Failed to watch openrc file %s: %s", openrcPath, err.Error())
+			}
+			stopOpenRCWatch = stop
+		}
+	}
+
+	if _, ok := LookupEnv("OS_USERNAME"); !ok {
+		exitf(exitEnv, "No OS_USERNAME environment found. Execute `source <path/to/openrc>` first!")
+	}
+
+	if envValidation != "" {
+		if missing := MissingEnvVars(strings.Split(envValidation, ",")); len(missing) > 0 {
+			exitf(exitEnv, "Missing environment variables: %s. Execute `source <path/to/openrc>` first!", strings.Join(missing, ", "))
+		}
+	}
+
+	if checkEndpoint {
+		if err := CheckEndpointReachable(); err != nil {
+			exitf(exitEnv, "%s", err.Error())
+		}
+	}
+
+	if backend == "api" {
+		ae, err := NewAPIExecutor()
+		if err != nil {
+			exitf(exitEnv, "Failed to connect the API: %s", err.Error())
+		}
+		executor = ae
+		logger.Printf("%20s: %s", "Neutron API", ae.endpoint)
+	} else {
+		neutron, err := exec.LookPath("neutron")
+		if err != nil {
+			exitf(exitEnv, "%s", err.Error())
+		}
+		logger.Printf("%20s: %s", "Neutron Command", neutron)
+		executor = batch.NewExecExecutor(batch.ExecOptions{Env: CommandEnvOf, Profiling: neutronProfiling})
+	}
+
+	if len(cmdList) > maxCommands && !assumeYes {
+		exitf(exitUsage, "%d commands generated, more than --max-commands %d. "+
+			"Add --yes or a higher --max-commands to proceed.", len(cmdList), maxCommands)
+	}
+
+	if !assumeYes && IsTerminal(os.Stdin) && !ConfirmDeletes() {
+		logger.Printf("Aborted.")
+		os.Exit(1)
+	}
+	if confirmBatch && !ConfirmBatch() {
+		logger.Printf("Aborted.")
 		os.Exit(1)
 	}
 
-	neutron, err := exec.LookPath("neutron")
-	if err != nil {
-		logger.Fatal(err)
+	if checkpointInterval > 0 {
+		if err := ResumeCheckpoint(); err != nil {
+			exitf(exitUsage, "Failed to resume checkpoint: %s", err.Error())
+		}
+	}
+
+	if seqFilePath != "" {
+		WriteSeqFile()
+	}
+	if graphvizPath != "" {
+		WriteCommandListGraphviz()
+	}
+
+	if lockDir != "" {
+		if err := AcquireLocks(LockedLoadBalancers(cmdList)); err != nil {
+			logger.Printf("Failed to lock: %s", err.Error())
+			os.Exit(1)
+		}
 	}
-	logger.Printf("%20s: %s", "Neutron Command", neutron)
 
-	ExecuteNeutronCommands()
+	if stalePendingThreshold > 0 && lbaasAPIVersion == "v2" {
+		if err := CheckStalePending(LockedLoadBalancers(cmdList)); err != nil {
+			exitf(exitEnv, "%s", err.Error())
+		}
+	}
+
+	runMeta = NewRunMetadata()
+	logger.Printf("%20s: %s", "Run ID", runMeta.RunID)
+
+	if artifactsDir != "" {
+		if err := CreateRunArtifactsDir(); err != nil {
+			exitf(1, "Failed to create artifacts dir: %s", err.Error())
+		}
+	}
+
+	if metricsListen != "" {
+		StartMetricsServer()
+	}
+
+	if showProgress && IsTerminal(os.Stdout) {
+		progress = NewProgress(os.Stdout, len(cmdList))
+		if logFile == "" {
+			logger.SetOutput(progress)
+		}
+	}
+
+	ExecuteNeutronCommands(waitCtx)
+	stopOpenRCWatch()
+	if !atomic.CompareAndSwapInt32(&finishing, 0, 1) {
+		// signalProcess writes the results and exits.
+		close(drained)
+		select {}
+	}
+	if stepQuit {
+		QuitWithPartialResults(0)
+	}
+	if runMeta.AbortReason != "" {
+		QuitWithPartialResults(1)
+	}
+	progress.Stop()
+	FetchFinalLBStatuses(cmdResults.Sorted())
 	WriteResult()
+	if runArtifactsDir != "" {
+		WriteRunArtifact()
+	}
+	ReleaseLocks()
+	if checkpointInterval > 0 {
+		RemoveCheckpoint()
+	}
+	if reportHTML != "" {
+		WriteHTMLReport()
+	}
+	if reportJUnit != "" {
+		WriteJUnitReport()
+	}
+	if histogramOutput != "" {
+		WriteHistogramOutput()
+	}
+	if summaryFilePath != "" {
+		WriteSummary()
+	}
 	PrintReport()
+	StopMetrics()
+	Notify("completed")
 }
 
+// signalProcess drain on the first signal: no more commands are started, the status checks stop,
+// and the running command is waited up to --drain-timeout. A second signal quits immediately.
+// The signals after the run has finished are ignored, main writing the results.
 func signalProcess() {
-	<-chsig
-	logger.Printf("Signal received, quit. Partial results are output to %s", outputFilePath)
+	for range chsig {
+		if atomic.CompareAndSwapInt32(&finishing, 0, 1) {
+			break
+		}
+		logger.Printf("Signal received while finishing the run, ignored")
+	}
+	atomic.StoreInt32(&draining, 1)
+	cancelWait()
+	logger.Printf("Signal received, finishing the running command in %s, signal again to quit immediately", drainTimeout)
+	select {
+	case <-drained:
+	case <-chsig:
+		logger.Printf("Signal received again, quit immediately")
+	case <-time.After(drainTimeout):
+		logger.Printf("The running command is not finished in %s, quit", drainTimeout)
+	}
+
+	// kill the running command, and wait its result recorded.
+	cancelCommand()
+	select {
+	case <-drained:
+	case <-time.After(killTimeout):
+	}
+	QuitWithPartialResults(0)
+}
+
+// QuitWithPartialResults write the results, reports and checkpoint of the commands run so far, and exit with the code.
+func QuitWithPartialResults(code int) {
+	progress.Stop()
+	logger.Printf("Quit. Partial results are output to %s", outputFilePaths.String())
+	if checkpointInterval > 0 {
+		WriteCheckpoint()
+	}
 	WriteResult()
+	if runArtifactsDir != "" {
+		WriteRunArtifact()
+	}
+	if reportHTML != "" {
+		WriteHTMLReport()
+	}
+	if reportJUnit != "" {
+		WriteJUnitReport()
+	}
+	if summaryFilePath != "" {
+		WriteSummary()
+	}
 	PrintReport()
+	StopMetrics()
+	ReleaseLocks()
+	Notify("aborted")
+
+	os.Exit(code)
+}
+
+// WriteRecord append one finished command to the output file when streaming.
+func WriteRecord(cmdctx *CommandContext) {
+	if outputFormat != "jsonl" || !cmdctx.Outputable() {
+		return
+	}
+
+	jd, _ := json.Marshal(cmdctx)
+	if _, e := outputFile.WriteString(string(jd) + "\n"); e != nil {
+		logger.Printf("Error happens while writing record %d: %s", cmdctx.Seq, e.Error())
+	} else {
+		atomic.AddInt32(&recordsWritten, 1)
+	}
+	// flush for the stream processors; not supported by pipes and ttys.
+	_ = outputFile.Sync()
+}
 
-	os.Exit(0)
+// Outputable tells whether the command should be written to the output file.
+// Skipped commands, which are not ready to run, exit with -1.
+func (cmdctx *CommandContext) Outputable() bool {
+	if excludeSuccessful && cmdctx.ExitCode == 0 {
+		return false
+	}
+	if excludeSkipped && cmdctx.ExitCode == -1 {
+		return false
+	}
+	if jsonPathFilter != nil && !jsonPathFilter.Match(cmdctx) {
+		return false
+	}
+	return true
 }
 
 // WriteResult to files
 func WriteResult() {
 	defer outputFile.Close()
 
-	jd, _ := json.MarshalIndent(cmdResults, "", "  ")
+	if outputFormat == "jsonl" {
+		logger.Printf("Writen %d executions to file %s", atomic.LoadInt32(&recordsWritten), outputFilePaths.String())
+		return
+	}
+
+	outputs := []*CommandContext{}
+	for _, n := range cmdResults.Sorted() {
+		if n.Outputable() {
+			outputs = append(outputs, n)
+		}
+	}
+
+	runMeta.FinishedAt = time.Now()
+	var v interface{} = RunOutput{runMeta, outputs}
+	if outputFormat == "legacy" {
+		v = outputs
+	}
+	var jd []byte
+	if compactOutput {
+		jd, _ = json.Marshal(v)
+	} else {
+		jd, _ = json.MarshalIndent(v, "", "  ")
+	}
 	n, e := outputFile.WriteString(string(jd))
-	logger.Printf("Writen executions to file %s: data-len:%d", outputFilePath, n)
+	logger.Printf("Writen executions to file %s: data-len:%d", outputFilePaths.String(), n)
 	if e != nil {
+		ReleaseLocks()
 		logger.Fatalf("Error happens while writing: %s", e.Error())
 	}
 }
 
 // PrintReport print a summary to the executions.
 func PrintReport() {
+	results := cmdResults.Sorted()
 
 	fmt.Println()
-	fmt.Println("---------------------- Execution Report ----------------------")
+	fmt.Println(Colorize(colorBold, "---------------------- Execution Report ----------------------"))
 	fmt.Println()
-	for _, n := range cmdResults {
-		fmt.Printf("%d: %s | Exited: %d | duration: %d ms\n",
-			n.Seq, n.Command, n.ExitCode, n.Duration.Milliseconds())
+	if colorEnabled {
+		PrintColoredResults(SortedForReport(results, sortReport))
+	} else {
+		for _, n := range SortedForReport(results, sortReport) {
+			fmt.Printf("%d: %s | Exited: %d | started: %s | duration: %d ms | waited: %d ms\n",
+				n.Seq, n.Command, n.ExitCode, n.StartedAt.Format("2006-01-02 15:04:05.000"), n.Duration.Milliseconds(),
+				n.WaitDuration.Milliseconds())
+		}
 	}
 	fmt.Println()
-	fmt.Println("Failed Command List:")
-	for _, n := range cmdResults {
+	wait, execution := WaitTotals(results)
+	fmt.Printf("Total waited for ready: %d ms, executed: %d ms\n", wait.Milliseconds(), execution.Milliseconds())
+	fmt.Println()
+	PrintLatencyPercentiles()
+	fmt.Println()
+	PrintDurationHistograms()
+	fmt.Println()
+	PrintLoadBalancerBreakdown()
+	PrintListSummaries()
+	fmt.Println(Colorize(colorBold, "Failed Command List:"))
+	for _, n := range results {
 		if n.ExitCode != 0 {
-			fmt.Println(n.Command)
+			class := n.FailureClass
+			if class == "" {
+				class = "NotRun"
+			}
+			fmt.Println(Colorize(colorRed, fmt.Sprintf("[%s] %s", class, n.Command)))
+			if len(n.RequestIDs) > 0 {
+				fmt.Printf("    request ids: %s\n", strings.Join(n.RequestIDs, ", "))
+			}
+		}
+	}
+	if probeMode != "" {
+		fmt.Println()
+		fmt.Println(Colorize(colorBold, "Data Path Failure List:"))
+		for _, n := range results {
+			if n.Probe != nil && !n.Probe.OK {
+				fmt.Println(Colorize(colorRed, fmt.Sprintf("%s | %s: %s", n.Command, n.Probe.Target, n.Probe.Err)))
+			}
+		}
+	}
+	if bigipHost != "" {
+		fmt.Println()
+		fmt.Println(Colorize(colorBold, "BIG-IP Drift List:"))
+		for _, n := range results {
+			if n.BIGIPDrift != "" {
+				fmt.Println(Colorize(colorRed, fmt.Sprintf("%s | %s", n.Command, n.BIGIPDrift)))
+			}
+		}
+	}
+	if captureDiff {
+		fmt.Println()
+		fmt.Println(Colorize(colorBold, "No-op Update List:"))
+		for _, n := range NoopUpdates(results) {
+			fmt.Println(Colorize(colorYellow, n.Command))
 		}
 	}
 	fmt.Println()
-	fmt.Println("-----------------------Execution Report End ---------------------")
+	fmt.Println(Colorize(colorBold, "-----------------------Execution Report End ---------------------"))
 	fmt.Println()
 }
 
-// Execute will execute neutron lbaas-xxxx command and fill with result.
-func (cmdctx *CommandContext) Execute() {
-	cmdArgs := strings.Split(cmdctx.Command, " ")
-	cmdArgs = append(cmdArgs, "--format", "json")
-	var out, err bytes.Buffer
-
-	timeoutctx, cancel := context.WithTimeout(context.Background(), time.Duration(30)*time.Minute)
-	defer cancel()
-	c := exec.CommandContext(timeoutctx, cmdArgs[0], cmdArgs[1:]...)
+// SortedForReport order a copy of the results by seq, duration(descending) or status(failures first).
+func SortedForReport(results []*CommandContext, by string) []*CommandContext {
+	sorted := make([]*CommandContext, len(results))
+	copy(sorted, results)
+	switch by {
+	case "duration":
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Duration > sorted[j].Duration })
+	case "status":
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].ExitCode != 0 && sorted[j].ExitCode == 0
+		})
+	default:
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Seq < sorted[j].Seq })
+	}
+	return sorted
+}
 
-	c.Env = os.Environ()
-	c.Stdout = &out
-	c.Stderr = &err
+// MarshalJSON output the duration in milliseconds, the same as the report.
+func (cmdctx *CommandContext) MarshalJSON() ([]byte, error) {
+	type plain CommandContext
+	return json.Marshal(struct {
+		*plain
+		Duration     int64 `json:"duration"`
+		WaitDuration int64 `json:"wait_duration"`
+	}{(*plain)(cmdctx), cmdctx.Duration.Milliseconds(), cmdctx.WaitDuration.Milliseconds()})
+}
 
-	fs := time.Now()
-	e := c.Start()
-	if e != nil {
-		err.WriteString(e.Error())
-	} else {
-		e = c.Wait()
-		if e != nil {
-			err.WriteString(e.Error())
-			cmdctx.Err = err.String()
-		} else {
-			cmdctx.RawOut = out.String()
-			var resp NeutronResponse
-			if json.Unmarshal(out.Bytes(), &resp) == nil {
-				cmdctx.ObjectID = resp.ID
-			}
-		}
+// UnmarshalJSON read the duration in milliseconds, as written by MarshalJSON.
+func (cmdctx *CommandContext) UnmarshalJSON(data []byte) error {
+	type plain CommandContext
+	v := struct {
+		*plain
+		Duration     int64 `json:"duration"`
+		WaitDuration int64 `json:"wait_duration"`
+	}{plain: (*plain)(cmdctx)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
 	}
-	cmdctx.CLIRequests = cliTraceRegexp.FindAllString(err.String(), -1)
+	cmdctx.Duration = time.Duration(v.Duration) * time.Millisecond
+	cmdctx.WaitDuration = time.Duration(v.WaitDuration) * time.Millisecond
+	return nil
+}
 
-	fe := time.Now()
-	cmdctx.ExitCode = c.ProcessState.ExitCode()
-	cmdctx.Duration = fe.Sub(fs)
+// Execute will execute neutron lbaas-xxxx command and fill with result.
+func (cmdctx *CommandContext) Execute(ctx context.Context) {
+	runner().Execute(ctx, &cmdctx.CommandContext)
+
+	cmdctx.FailureClass = ""
+	if cmdctx.ExitCode != 0 {
+		cmdctx.FailureClass = ClassifyFailure(cmdctx.Stderr, cmdctx.Stdout)
+	}
+	if ar, ok := executor.(APIResponder); ok {
+		cmdctx.HTTPStatus, _ = ar.LastResponse()
+	}
+	if fbt, ok := executor.(batch.FirstByteTimer); ok && neutronProfiling {
+		cmdctx.Profile(cmdctx.StartedAt, fbt.FirstByteAt(), cmdctx.FinishedAt)
+	}
 }
 
-// NewCommandContext ...
+// NewCommandContext parse the cmdList entry, with its annotations, of the lbaas api version.
+// The entries are checked by ValidateCommands when the commands are generated or read; an invalid
+// one gets the context of its raw command line with the parse error in Err.
 func NewCommandContext(commandline string) *CommandContext {
-	lbAndCmd := strings.Split(commandline, "|")
-
-	fullCmd := fmt.Sprintf("%s%s", cmdPrefix, lbAndCmd[1])
+	cmdctx, err := ParseCommandContext(commandline)
+	if err != nil {
+		return &CommandContext{CommandContext: batch.CommandContext{Command: commandline, Err: err.Error(), ExitCode: -1}}
+	}
+	return cmdctx
+}
 
-	cmdctx := CommandContext{
-		Command: fullCmd,
+// ParseCommandContext parse the cmdList entry, with its annotations, of the lbaas api version.
+// Returns the error if it has no lbaas subcommand of the version.
+func ParseCommandContext(commandline string) (*CommandContext, error) {
+	// the annotations are validated when the commands are generated or read.
+	label, needs, commandline := SplitDepAnnotations(commandline)
+	env, commandline, _ := SplitEnvAnnotation(commandline)
+
+	parsed, err := batch.NewCommandContext(commandline, batch.ParseOptions{
+		Prefix:           cmdPrefix,
+		SubcommandPrefix: lbaasSchema.SubcommandPrefix,
+	})
+	if err != nil {
+		return nil, err
 	}
-	cmdctx.LoadBalancer = lbAndCmd[0]
+	cmdctx := CommandContext{CommandContext: *parsed}
+	cmdctx.Cloud = cloudName
+	cmdctx.Label = label
+	if len(needs) > 0 {
+		cmdctx.Needs = needs
+	}
+	cmdctx.EnvOverrides = env
+	cmdctx.Env = RedactedEnv(env)
 
-	args := strings.Split(cmdctx.Command, " ")
-	subcmd := ""
-	for _, arg := range args {
-		if strings.HasPrefix(arg, "lbaas-") {
-			subcmd = arg
-			break
+	return &cmdctx, nil
+}
+
+// ValidateCommands check each command has an lbaas subcommand of the version. Returns the error
+// of the first invalid one.
+func ValidateCommands(commands []string) error {
+	for i, n := range commands {
+		if _, err := ParseCommandContext(n); err != nil {
+			return fmt.Errorf("command %d: %s", i+1, err.Error())
 		}
 	}
-	subs := strings.Split(subcmd, "-")
-	cmdctx.ResourceType = subs[1]
-	cmdctx.OperationType = subs[2]
+	return nil
+}
 
-	return &cmdctx
+// logDebug log the details like command argv and output, with --log-level debug or --verbose.
+func logDebug(format string, v ...interface{}) {
+	if logLevels[logLevel] <= logLevels["debug"] {
+		logger.Printf(format, v...)
+	}
+}
+
+// logInfo log the routine progress, suppressed by --quiet.
+func logInfo(format string, v ...interface{}) {
+	if logLevels[logLevel] <= logLevels["info"] {
+		logger.Printf(format, v...)
+	}
+}
+
+// logWarn log the recoverable failures, suppressed by --log-level error.
+func logWarn(format string, v ...interface{}) {
+	if logLevels[logLevel] <= logLevels["warn"] {
+		logger.Printf(format, v...)
+	}
 }
 
 // ExecuteNeutronCommands Execute the generated commands analyze result.
-func ExecuteNeutronCommands() {
+func ExecuteNeutronCommands(ctx context.Context) {
 	for i, n := range cmdList {
+		if i < resumedCount {
+			continue
+		}
+		if atomic.LoadInt32(&draining) == 1 {
+			logger.Printf("Draining, %d command(s) not started", len(cmdList)-i)
+			break
+		}
+		if runMeta.AbortReason != "" {
+			logger.Printf("Abort: %s, %d command(s) not started", runMeta.AbortReason, len(cmdList)-i)
+			break
+		}
 		cmdctx := NewCommandContext(n)
 		cmdctx.Seq = i + 1
-
-		logger.Println()
-		logger.Printf("Command(%d/%d): Prepare to run '%s'", i+1, len(cmdList), cmdctx.Command)
-		if err := cmdctx.WaitForReady(); err != nil {
+		cmdctx.TemplatePosition = TemplatePosition(n)
+
+		progress.Start(cmdctx)
+		metrics.InFlight.Inc()
+		logInfo("")
+		logInfo("Command(%d/%d): Prepare to run '%s'", i+1, len(cmdList), cmdctx.Command)
+		cmdctx.ResolveLoadBalancer()
+		if cmdctx.SkipForFailedNeeds() {
+			logInfo("Command(%d/%d): %s", i+1, len(cmdList), cmdctx.Err)
+			RecordResult(cmdctx)
+			continue
+		}
+		if skipOnParentFailure && cmdctx.SkipForParentFailure() {
+			logInfo("Command(%d/%d): %s", i+1, len(cmdList), cmdctx.Err)
+			RecordResult(cmdctx)
+			continue
+		}
+		if stepMode {
+			switch StepCommand(cmdctx) {
+			case "skip":
+				logInfo("Command(%d/%d): Skipped in step mode", i+1, len(cmdList))
+				cmdctx.ExitCode = -1
+				cmdctx.Err = "skipped in step mode"
+				cmdctx.SkipReason = "skipped-step"
+				RecordResult(cmdctx)
+				continue
+			case "quit":
+				logger.Printf("Quit in step mode, %d command(s) not started", len(cmdList)-i)
+				metrics.InFlight.Dec()
+				stepQuit = true
+				return
+			}
+		}
+		if err := cmdctx.WaitForReady(ctx); err != nil {
 			logger.Printf("Command(%d/%d): Not ready to run this command: %s", i+1, len(cmdList), err.Error())
+			cmdctx.ExitCode = -1
+			cmdctx.Err = err.Error()
+			RecordResult(cmdctx)
 			continue
 		}
 
-		logger.Printf("Command(%d/%d): Start '%s'", i+1, len(cmdList), cmdctx.Command)
-		cmdctx.Execute()
+		if (skipExisting || recreate) && cmdctx.OperationType == "create" {
+			if skipped := cmdctx.HandleExisting(ctx); skipped {
+				RecordResult(cmdctx)
+				continue
+			}
+		}
+
+		if captureDiff && cmdctx.OperationType == "update" {
+			cmdctx.CaptureBefore()
+		}
+		if bigipHost != "" && cmdctx.OperationType == "delete" && cmdctx.BIGIPVerifiable() {
+			cmdctx.CaptureBIGIPObject()
+		}
 
-		logger.Printf("Command(%d/%d): exits with: %d, object id: %s, executing time: %d ms",
+		logInfo("Command(%d/%d): Start '%s'", i+1, len(cmdList), cmdctx.Command)
+		cmdctx.Execute(commandCtx)
+		throttle.Observe(cmdctx)
+		for cmdctx.ExitCode > 0 && cmdctx.Retries < commandRetries && Transient(cmdctx.FailureClass) {
+			cmdctx.Retries++
+			logWarn("Command(%d/%d): %s failure, retry %d/%d", cmdctx.Seq, len(cmdList), cmdctx.FailureClass, cmdctx.Retries, commandRetries)
+			if throttle != nil && cmdctx.FailureClass == "RateLimited" {
+				_ = batch.SleepContext(ctx, throttle.Delay)
+			}
+			if err := cmdctx.WaitForReady(ctx); err != nil {
+				logger.Printf("Command(%d/%d): Not ready to retry this command: %s", cmdctx.Seq, len(cmdList), err.Error())
+				break
+			}
+			cmdctx.Execute(commandCtx)
+			throttle.Observe(cmdctx)
+		}
+		if stderrDir != "" {
+			cmdctx.WriteStderrFile()
+		}
+		if idempotent && cmdctx.ExitCode > 0 && cmdctx.AlreadyDone() {
+			logWarn("Command(%d/%d): %s already done, exit code %d counted as success",
+				cmdctx.Seq, len(cmdList), cmdctx.OperationType, cmdctx.ExitCode)
+			cmdctx.RawExitCode = cmdctx.ExitCode
+			cmdctx.ExitCode = 0
+		}
+		if parseOutput && cmdctx.ExitCode == 0 {
+			cmdctx.ParseOutput()
+		}
+
+		logInfo("Command(%d/%d): exits with: %d, object id: %s, executing time: %d ms",
 			cmdctx.Seq, len(cmdList), cmdctx.ExitCode, cmdctx.ObjectID, cmdctx.Duration.Milliseconds())
-		time.Sleep(time.Duration(1) * time.Second)
+		logDebug("Command(%d/%d): Output: %s", cmdctx.Seq, len(cmdList), cmdctx.RawOut)
+		logDebug("Command(%d/%d): CLI requests: %v", cmdctx.Seq, len(cmdList), cmdctx.CLIRequests)
+		_ = batch.SleepContext(ctx, InterCommandDelay())
 
 		// check the command execution.
 		if cmdctx.ExitCode == 0 {
 			if checkDone {
-				cmdctx.WaitForDone()
+				if done, err := cmdctx.WaitForDone(ctx); !done && err != nil {
+					cmdctx.CheckErr = err.Error()
+				}
+			}
+			if waitOperatingStatus != "" && cmdctx.CheckErr == "" {
+				if err := cmdctx.WaitForOperatingStatus(ctx); err != nil {
+					cmdctx.CheckErr = err.Error()
+				}
 			}
 		} else {
 			logger.Printf("Command(%d/%d): Error output: %s", cmdctx.Seq, len(cmdList), cmdctx.Err)
 		}
-		cmdResults = append(cmdResults, cmdctx)
+		if cmdctx.Before != nil && cmdctx.ExitCode == 0 {
+			cmdctx.CaptureAfter()
+		}
+		if probeMode != "" && cmdctx.ExitCode == 0 && cmdctx.CheckErr == "" && cmdctx.Probeable() {
+			cmdctx.RunProbe()
+		}
+		if bigipHost != "" && cmdctx.ExitCode == 0 && cmdctx.CheckErr == "" && cmdctx.BIGIPVerifiable() {
+			cmdctx.VerifyBIGIP()
+		}
+		if len(assertions) > 0 && cmdctx.ExitCode == 0 {
+			cmdctx.Assert(assertions)
+			if cmdctx.ExitCode != 0 {
+				logger.Printf("Command(%d/%d): %s", cmdctx.Seq, len(cmdList), cmdctx.Err)
+			}
+		}
+		RecordResult(cmdctx)
 	}
 }
 
-// DBProvisioningStatusOf get object provisioning status
-func DBProvisioningStatusOf(objectType string, objectIDName string, isID bool) (string, error) {
-	table := "unknown"
-	switch objectType {
-	case "loadbalancer":
-		table = "lbaas_loadbalancers"
-	case "pool":
-		table = "lbaas_pools"
-	case "listener":
-		table = "lbaas_listeners"
-	case "healthmonitor":
-		table = "lbaas_healthmonitors"
-	case "member":
-		table = "lbaas_members"
-	case "l7policy":
-		table = "lbaas_l7policies"
+// WriteSeqFile write the mapping of seqnum to command before execution.
+func WriteSeqFile() {
+	seqs := map[int]string{}
+	for i, n := range cmdList {
+		seqs[i+1] = NewCommandContext(n).Command
 	}
+	jd, _ := json.MarshalIndent(seqs, "", "  ")
+	if err := ioutil.WriteFile(seqFilePath, jd, 0644); err != nil {
+		logger.Fatalf("Failed to write seq file %s: %s", seqFilePath, err.Error())
+	}
+	logger.Printf("%20s: %s", "Seq File", seqFilePath)
+}
 
-	entries := []NeutronResponse{}
-	tag := "id"
-	if !isID {
-		tag = "name"
+// RecordResult save the finished command to the results.
+func RecordResult(cmdctx *CommandContext) {
+	if onFailureHook != "" && cmdctx.ExitCode != 0 {
+		RunFailureHook(cmdctx)
+	}
+	if len(summaryColumnList) > 0 && cmdctx.OperationType == "list" && cmdctx.ExitCode == 0 {
+		cmdctx.SummarizeList()
+	}
+	if runArtifactsDir != "" {
+		cmdctx.WriteArtifacts()
+	}
+	cmdctx.TruncateOutput(maxRawOutputBytes)
+	if auditHash {
+		cmdctx.AuditHash = cmdctx.ComputeAuditHash(auditHMACKey)
+	}
+	if skipOnParentFailure {
+		cmdctx.TrackParentFailure()
 	}
-	rlt := dbConn.Table(table).Where(fmt.Sprintf("%s = ?", tag), objectIDName).Find(&entries)
-	if rlt.Error != nil {
-		return "", rlt.Error
+	cmdctx.TrackCompletion()
+	cmdctx.WarnLongWait()
+	if reason := cmdctx.TrackFailures(); reason != "" && runMeta.AbortReason == "" {
+		runMeta.AbortReason = reason
 	}
-	if rlt.RowsAffected != 1 {
-		return "", fmt.Errorf("%s %s has %d records", objectType, objectIDName, rlt.RowsAffected)
+	cmdResults.Add(cmdctx)
+	progress.Finish(cmdctx)
+	metrics.InFlight.Dec()
+	ObserveCommand(cmdctx)
+	WriteRecord(cmdctx)
+	CheckpointResult()
+	if resultsDB != nil {
+		StoreResult(cmdctx)
 	}
+	if cleanupFile != "" && cmdctx.OperationType == "create" && cmdctx.ExitCode == 0 {
+		WriteCleanupFile()
+	}
+}
 
-	return entries[0].ProvisioningStatus, nil
+// UseLBaaSAPIVersion switch the subcommands, tables and columns to the lbaas api version.
+func UseLBaaSAPIVersion(version string) error {
+	schema, err := status.SchemaOf(version)
+	if err != nil {
+		return err
+	}
+	lbaasSchema = schema
+	return nil
 }
 
-// LBStatusFromCmd ...
-func LBStatusFromCmd(lbIDName string) (string, error) {
-	chkctx := CommandContext{
-		Command: fmt.Sprintf("neutron lbaas-loadbalancer-show %s", lbIDName),
+// neutronColumns select the columns of NeutronResponse of the object type in the lbaas api version's schema.
+func neutronColumns(objectType string) string {
+	return lbaasSchema.Columns(objectType)
+}
+
+// dbSource get the provisioning status from the --mysql-uri database, in --os-project-id.
+func dbSource() *status.DBSource {
+	return status.NewDBSource(dbConn, status.DBOptions{Schema: lbaasSchema, ProjectID: projectID})
+}
+
+// cliSource get the provisioning status by the neutron show command.
+func cliSource() *status.CLISource {
+	return status.NewCLISource(status.CLIOptions{Runner: runner(), Schema: lbaasSchema, Format: neutronFormat})
+}
+
+// LBStatus get the loadbalancer status from database if configured, otherwise from neutron command.
+// While database is failed over for slowness, neutron command is used and database is probed aside.
+func LBStatus(ctx context.Context, lbIDName string) (string, error) {
+	if dbConn == nil {
+		return cliSource().ProvisioningStatus(ctx, lbaasSchema.LoadBalancerType, lbIDName)
 	}
-	chkctx.Execute()
-	if chkctx.ExitCode != 0 {
-		return "", fmt.Errorf("%s", chkctx.Err)
+	return dbFailover.Source(dbSource(), cliSource()).ProvisioningStatus(ctx, lbaasSchema.LoadBalancerType, lbIDName)
+}
+
+// WaitForReady check the object of the readiness strategy, the loadbalancer by default, is not pending.
+func (cmdctx *CommandContext) WaitForReady(ctx context.Context) error {
+	c := checker()
+	if !c.NeedsReady(&cmdctx.CommandContext) {
+		return nil
 	}
 
-	var resp NeutronResponse
-	_ = json.Unmarshal([]byte(chkctx.RawOut), &resp)
+	fs := time.Now()
+	strategy := ReadinessStrategy{lbaasSchema.LoadBalancerType, "auto"}
+	if lbaasAPIVersion == "v2" {
+		strategy = cmdctx.ReadinessStrategy()
+	}
+	object, err := cmdctx.ReadinessObject(strategy.Object)
+	if err != nil {
+		logWarn("Command(%d/%d): No %s to check, check loadbalancer instead: %s",
+			cmdctx.Seq, len(cmdList), strategy.Object, err.Error())
+		strategy, object = ReadinessStrategy{lbaasSchema.LoadBalancerType, "auto"}, cmdctx.LoadBalancer
+	}
+	cmdctx.WaitDuration += time.Since(fs)
 
-	return resp.ProvisioningStatus, nil
+	source := batch.StatusSourceFunc(func(ctx context.Context, objectType string, idOrName string) (string, error) {
+		return ProvisioningStatusOf(ctx, objectType, idOrName, strategy.Method)
+	})
+	return c.WaitForReady(ctx, &cmdctx.CommandContext, source, strategy.Object, object, cmdctx.WaitBudget())
 }
 
-// LBStatusFromDB ...
-func LBStatusFromDB(lbIDname string) (string, error) {
-	isID, _ := regexp.MatchString(`[0-9a-f\-]{36}`, lbIDname)
-	return DBProvisioningStatusOf("loadbalancer", lbIDname, isID)
+// WaitForDone check the object of the command, with --mysql-uri, and its loadbalancer are no longer pending.
+func (cmdctx *CommandContext) WaitForDone(ctx context.Context) (bool, error) {
+	var objects batch.StatusSource
+	if dbConn != nil {
+		objects = dbSource()
+	}
+	lbs := batch.StatusSourceFunc(func(ctx context.Context, _ string, lbIDName string) (string, error) {
+		return LBStatus(ctx, lbIDName)
+	})
+	return checker().WaitForDone(ctx, &cmdctx.CommandContext, objects, lbs, cmdctx.WaitBudget())
 }
 
-// WaitForReady check the loadbalancer is not pending.
-func (cmdctx *CommandContext) WaitForReady() error {
+// HandleArguments handle user's input.
+func HandleArguments() {
+	flag.Var(&outputFilePaths, "output-filepath", "output the result, /dev/stdout if not given. Repeat or separate with commas for more files, "+
+		"and 'db' to persist the results like --store-results.")
+	flag.StringVar(&seqFilePath, "command-seq-to-command-file", "", "write the mapping of seqnum to command to this file before execution.")
+	flag.StringVar(&graphvizPath, "command-list-to-graphviz", "", "write the dependency graph of the commands by their label=/needs= annotations to this file "+
+		"in the DOT format before execution, rendered like 'dot -Tsvg'.")
+	flag.BoolVar(&checkEndpoint, "check-openstack-endpoint-reachable", false, "check OS_AUTH_URL is reachable before execution.")
+	flag.IntVar(&endpointCheckTimeout, "endpoint-check-timeout-seconds", endpointCheckTimeout, "timeout of --check-openstack-endpoint-reachable.")
+	flag.StringVar(&openrcPath, "openrc-path", "", "parse the openrc file into the environment of the neutron commands, instead of sourcing it.")
+	flag.BoolVar(&openrcWatch, "use-openrc-file-watcher", false, "re-parse --openrc-path whenever it changes during the run.")
+	flag.StringVar(&envValidation, "command-env-validation", "", "comma separated environment variables required before execution, like OS_AUTH_URL,OS_PASSWORD.")
+	flag.IntVar(&maxCommands, "max-commands", maxCommands, "abort before execution if more commands are generated, unless --yes.")
+	flag.BoolVar(&assumeYes, "yes", false, "proceed without the safety confirmations.")
+	flag.BoolVar(&assumeYes, "force", false, "the same as --yes.")
+	flag.BoolVar(&dedupe, "dedupe", false, "remove the duplicated commands generated from the template.")
+	flag.StringVar(&sortReport, "sort-report", "seq", "order of the execution report: seq, duration(descending) or status(failures first). The output file is always in seq order.")
+	flag.StringVar(&metricsListen, "metrics-listen", "", "serve Prometheus metrics on this address during execution, like :9123.")
+	flag.StringVar(&pushgatewayURL, "pushgateway-url", "", "push the metrics to this Prometheus pushgateway at completion, grouped by run_id.")
+	flag.StringVar(&notifyURL, "notify-url", "", "POST a JSON summary of the run to this url when it completes or aborts.")
+	flag.StringVar(&notifyOn, "notify-on", notifyOn, "when to notify: all, or failure(aborted or any command failed).")
+	flag.StringVar(&notifyToken, "notify-token", "", "the bearer token of --notify-url.")
+	flag.DurationVar(&notifyTimeout, "notify-timeout", notifyTimeout, "the timeout of each --notify-url request.")
+	flag.BoolVar(&neutronProfiling, "neutron-command-profiling", false, "split each command duration into startup_ms(until the first output byte) and api_call_ms.")
+	flag.StringVar(&reportHTML, "report-html", "", "write the execution report as a self-contained html file.")
+	flag.StringVar(&reportJUnit, "report-junit", "", "write the results as JUnit XML to this file, one testcase per command.")
+	flag.StringVar(&artifactsDir, "artifacts-dir", "", "write NNN-command.txt, NNN-stdout.json and NNN-stderr.txt of each command, and run.json "+
+		"with the metadata and summary, to a directory of the run in this directory.")
+	flag.BoolVar(&omitRawOutput, "omit-raw-output", false, "drop the outputs from the results, referring to the artifact files instead. Requires --artifacts-dir.")
+	flag.StringVar(&stderrDir, "neutron-command-stderr-dir", "", "write the stderr of each command to <dir>/cmd-<seq>-stderr.txt too.")
+	flag.IntVar(&commandRetries, "command-retries", 0, "retry the commands failed with a transient failure class, Conflict or RateLimited, up to this times.")
+	flag.BoolVar(&idempotent, "idempotent", false, "count create failed as already exists and delete failed as not found as success, keeping raw_exitcode.")
+	flag.BoolVar(&parseOutput, "parse-output", false, "embed the output of the successful commands as a json object in 'parsed'.")
+	flag.IntVar(&maxRawOutputBytes, "max-raw-output-bytes", -1, "truncate the raw output to this size, 0 omits it; not applied to malformed outputs. -1 is unlimited.")
+	flag.StringVar(&onFailureHook, "on-failure-hook", "", "run this shell command on each failed command, with BATCHOPS_COMMAND, BATCHOPS_EXITCODE, BATCHOPS_ERROR etc. in the environment.")
+	flag.DurationVar(&onFailureHookTimeout, "on-failure-hook-timeout", 30*time.Second, "kill the failure hook running longer than this.")
+	flag.Var(&assertExprs, "assert", "fail the successful commands whose json output has not the field=value, like protocol_port=80 or listeners.0.id=\"...\". Repeatable.")
+	flag.StringVar(&assertFile, "assert-file", "", "json file mapping the command regexps to the expected field values, like {\"lbaas-listener-create\": {\"protocol_port\": 80}}.")
+	flag.StringVar(&probeMode, "probe", "", "probe the VIP after a listener is created and verified: tcp or http.")
+	flag.DurationVar(&probeTimeout, "probe-timeout", 5*time.Second, "the timeout of each probe attempt.")
+	flag.IntVar(&probeRetries, "probe-retries", 3, "the times to retry a failed probe, one second apart.")
+	flag.BoolVar(&probeStrict, "probe-strict", false, "fail the command if the probe fails, instead of reporting a data path failure only.")
+	flag.IntVar(&probeLBPort, "probe-loadbalancer-port", 0, "probe the VIP on this port after a loadbalancer is created too, which has no listener yet.")
+	flag.Var(&readinessFlags, "readiness-strategy", "the object polled before running the commands of a resource type and the method, auto, db or cmd, "+
+		"like member=pool:db. The loadbalancer is polled by default. Repeat or separate with commas.")
+	flag.StringVar(&bigipHost, "bigip-host", "", "verify the created and deleted listeners, pools, members and healthmonitors on this BIG-IP by iControl REST.")
+	flag.StringVar(&bigipUsername, "bigip-username", "", "the BIG-IP user.")
+	flag.StringVar(&bigipPassword, "bigip-password", "", "the BIG-IP password.")
+	flag.StringVar(&bigipCredentialsFile, "bigip-credentials-file", "", "json file of the BIG-IP host, username and password, for the flags not given.")
+	flag.BoolVar(&bigipInsecure, "bigip-insecure", false, "skip verifying the BIG-IP certificate.")
+	flag.StringVar(&bigipEnvPrefix, "bigip-environment-prefix", "Project", "the environment_prefix of the f5-openstack-agent, naming the partitions and objects <prefix>_<id>.")
+	flag.Var(&allowOperations, "allow-operations", "run only the commands of these operation types, like create,update; any other aborts the run.")
+	flag.Var(&denyOperations, "deny-operations", "abort the run if any command is of these operation types, like delete.")
+	flag.BoolVar(&skipOnParentFailure, "skip-on-parent-failure", false, "skip the create and update commands of a loadbalancer after a command of it failed, "+
+		"the commands of the other loadbalancers still run.")
+	flag.DurationVar(&stalePendingThreshold, "stale-pending-threshold", stalePendingThreshold, "before running, abort if a loadbalancer of the batch has been PENDING_* longer than this, "+
+		"known with --mysql-uri, 0 to disable.")
+	flag.BoolVar(&ignoreStalePending, "ignore-stale-pending", false, "only warn the loadbalancers pending longer than --stale-pending-threshold.")
+	flag.IntVar(&maxFailures, "max-failures", 0, "abort the batch with the partial results once this many commands failed, 0 to disable.")
+	flag.IntVar(&maxConsecutiveFailures, "max-consecutive-failures", 0, "abort the batch with the partial results once this many commands failed in a row, 0 to disable.")
+	flag.BoolVar(&skipDeletesOnParentFailure, "skip-deletes-on-parent-failure", false, "skip the delete commands too with --skip-on-parent-failure.")
+	flag.BoolVar(&validateRefs, "validate-refs", false, "before running, check the loadbalancers, listeners, pools, subnets and the other objects "+
+		"referred to by the commands exist in database, except the ones created by the batch. Requires --mysql-uri.")
+	flag.BoolVar(&confirmBatch, "confirm", false, "print the commands count and a preview, and require typing yes before running.")
+	flag.BoolVar(&stepMode, "step", false, "pause before each command with its loadbalancer status: Enter to run, s to skip, q to quit with partial results.")
+	flag.BoolVar(&neutronInsecure, "neutron-insecure", false, "pass --insecure to the neutron commands, not verifying the TLS certificates of the endpoints.")
+	flag.StringVar(&neutronCACert, "neutron-cacert", "", "pass --os-cacert with this CA bundle to the neutron commands, verifying the TLS certificates of the endpoints.")
+	flag.StringVar(&lockDir, "lock-dir", filepath.Join(os.TempDir(), "f5-oslbaasv2-batchops-locks"),
+		"lock the loadbalancers named in the batch with files in this directory, for two runs not to operate the same loadbalancer; empty to disable.")
+	flag.DurationVar(&lockWait, "lock-wait", 0, "wait up to this long for the loadbalancers locked by another run, instead of refusing to start.")
+	flag.DurationVar(&lockTTL, "lock-ttl", 24*time.Hour, "break the locks older than this, as the dead pid locks on this host are; 0 to disable.")
+	flag.DurationVar(&drainTimeout, "drain-timeout", 30*time.Second, "on the first signal, wait the running command to finish up to this long before writing the results and quitting.")
+	flag.Var(&commandEnvFlags, "command-env", "override the environment of the template commands, like OS_PROJECT_NAME=%{project}. Repeatable. "+
+		"In --commands-file, prefix the line with env:NAME=value,...|.")
+	flag.StringVar(&neutronFormat, "neutron-format", "json", "the --format appended to the neutron commands: json, table or value; none appends nothing, "+
+		"for the --format and --column in the template. Object ids, --parse-output and --assert need json.")
+	flag.Var(&cloudOpenRCs, "openrc", "run the batch against the cloud of each openrc file, one by one; "+
+		"the output files are suffixed with the cloud name, which is the file name without extension. Repeatable.")
+	flag.BoolVar(&cloudsParallel, "clouds-parallel", false, "run the batch against the --openrc clouds concurrently.")
+	flag.StringVar(&cloudName, "cloud-name", "", "the cloud name recorded in the results, set for the runs of --openrc.")
+	flag.StringVar(&summaryFilePath, "summary-filepath", "", "write the counts, total duration and failed commands of the run to this file.")
+	flag.StringVar(&summaryColumns, "summary-columns", "", "tabulate these fields of the objects listed by the list commands in the report, like id,name,provisioning_status.")
+	flag.StringVar(&histogramBuckets, "histogram-buckets", histogramBuckets, "the upper bounds of the duration histogram buckets in the report and summary; --command-stats-histogram-output keeps the default ones.")
+	flag.StringVar(&histogramOutput, "command-stats-histogram-output", "", "write the latency histograms and percentiles per resource and operation type to this file.")
+	flag.StringVar(&outputFormat, "output-format", "json", "output format: json(indented run metadata and results written at the end), jsonl(one record per line written as each command completes) or legacy(indented results array written at the end)")
+	flag.BoolVar(&compactOutput, "output-format-compact", false, "write json and legacy output without indentation.")
+	flag.BoolVar(&prettyOutput, "output-format-pretty", false, "write json and legacy output indented, the default.")
+	flag.BoolVar(&excludeSuccessful, "output-exclude-successful", false, "write only the failed commands to the output file.")
+	flag.BoolVar(&excludeSkipped, "output-exclude-skipped", false, "do not write the skipped commands(exitcode -1) to the output file.")
+	flag.StringVar(&jsonPathFilterExpr, "output-jsonpath-filter", "", `write only the results matching this JSONPath filter, like '$.results[?(@.resource_type == "member" && @.exitcode != 0)]'.`)
+	flag.IntVar(&maxCheckTimes, "max-check-times", maxCheckTimes, "The max times for checking loadbalancer is ready for next step.")
+	flag.DurationVar(&checkInterval, "check-interval", checkInterval, "the interval between the status checks.")
+	flag.StringVar(&waitOperatingStatus, "wait-operating-status", "", "after the provisioning settles, wait for the operating_status of the loadbalancers, listeners, pools "+
+		"and members created or updated to be this, like ONLINE.")
+	flag.StringVar(&pendingStatesFlag, "pending-states", pendingStatesFlag, "the comma separated statuses to keep waiting for the loadbalancer and objects, like BUILD for some drivers.")
+	flag.BoolVar(&pendingStatesIgnoreCase, "pending-states-ignore-case", false, "match --pending-states case-insensitively.")
+	flag.Float64Var(&waitWarnRatio, "wait-warn-ratio", waitWarnRatio, "warn the commands waited for ready longer than this times their duration, 0 to disable.")
+	flag.Var(&waitOverrideFlags, "wait-override", "override --max-check-times and --check-interval by resource-operation, "+
+		"like loadbalancer-create=300,member-update=30:500ms.")
+	flag.DurationVar(&interCommandDelay, "inter-command-delay", interCommandDelay, "the delay after each command, 0 to disable. Readiness polling already paces create/update/delete.")
+	flag.BoolVar(&noSleep, "no-sleep", false, "disable the inter-command delay, the same as --inter-command-delay 0.")
+	flag.BoolVar(&adaptiveThrottle, "adaptive-throttle", false, "double the inter-command delay on rate-limited failures, and decrease it after sustained successes.")
+	flag.DurationVar(&throttleMaxDelay, "throttle-max-delay", throttleMaxDelay, "the max inter-command delay of --adaptive-throttle.")
+	flag.DurationVar(&throttleStep, "throttle-step", throttleStep, "the delay decreased after --throttle-successes, also the least delay after a rate-limited failure.")
+	flag.IntVar(&throttleSuccesses, "throttle-successes", throttleSuccesses, "the successes in a row to decrease the inter-command delay of --adaptive-throttle.")
+	flag.BoolVar(&showProgress, "progress", false, "show a progress line with ETA when stdout is a terminal.")
+	flag.BoolVar(&quiet, "quiet", false, "suppress the per-command progress logs, keeping warnings, errors and the report. The same as --log-level warn.")
+	flag.BoolVar(&verbose, "verbose", false, "log the full command output of each command. The same as --log-level debug.")
+	flag.StringVar(&logLevel, "log-level", logLevel, "log level: debug, info, warn or error.")
+	flag.StringVar(&logFile, "log-file", "", "write the logs to this file instead of stdout.")
+	flag.StringVar(&loadbalancer, "lb", "", "alias of --loadbalancer.")
+	flag.StringVar(&loadbalancer, "loadbalancer", "", "the loadbalancer name or id for checking execution status, may contain %{variable} like the template. With lbaas v1, the pool name or id.")
+	flag.StringVar(&backend, "backend", backend, "execute the commands with: cli(the neutron client) or api(lbaas v2 API calls translated from the commands, authenticated once).")
+	flag.StringVar(&lbaasAPIVersion, "neutron-lbaas-api-version", lbaasAPIVersion, "the neutron lbaas extension version: v1(lb-* commands) or v2(lbaas-* commands).")
+	flag.StringVar(&mysqluri, "mysql-uri", "", "database connection string")
+	flag.StringVar(&dbUsername, "db-username", "", "the database user, instead of --mysql-uri with the other --db-* flags. Defaults to $BATCHOPS_DB_USERNAME.")
+	flag.StringVar(&dbPassword, "db-password", "", "the database password, prefer --db-password-file or $BATCHOPS_DB_PASSWORD to keep it out of the process list.")
+	flag.StringVar(&dbPasswordFile, "db-password-file", "", "read the database password from this file.")
+	flag.StringVar(&dbHost, "db-host", "", "the database host. Defaults to $BATCHOPS_DB_HOST.")
+	flag.StringVar(&dbPort, "db-port", "", "the database port. Defaults to $BATCHOPS_DB_PORT or 3306.")
+	flag.StringVar(&dbName, "db-name", "", "the neutron database name, like ovs_neutron. Defaults to $BATCHOPS_DB_NAME.")
+	flag.Int64Var(&failoverThresholdMs, "check-lb-source-failover-threshold-ms", failoverThresholdMs, "check loadbalancer status with neutron command instead when database query is slower than this, 0 to disable.")
+	flag.BoolVar(&checkDone, "check-done", false, "check the object is created or not.")
+	flag.BoolVar(&auditHash, "command-audit-hash", false, "add HMAC-SHA256 audit_hash of 'seqnum|command|exitcode|duration|output' to each result, keyed by --audit-hmac-key.")
+	flag.StringVar(&auditHMACKey, "audit-hmac-key", "", "the key of the audit hash.")
+	flag.StringVar(&verifyFile, "verify-file", "", "verify-audit mode: the result file to verify.")
+	flag.BoolVar(&storeResults, "store-results", false, "insert each command result into the batchops_results table.")
+	flag.StringVar(&resultsDSN, "results-db-dsn", "", "database connection string for --store-results, defaults to --mysql-uri.")
+	flag.StringVar(&reportSince, "report-since", "", "report mode: the results started since this time, like 2006-01-02 15:04:05 or 24h(ago).")
+	flag.StringVar(&reportUntil, "report-until", "", "report mode: the results started until this time.")
+	flag.BoolVar(&captureDiff, "capture-diff", false, "show the object before and after each update command, and record the field-level diff.")
+	flag.BoolVar(&skipExisting, "skip-existing", false, "skip the create command if an object of the same type and name exists, recording the existing id.")
+	flag.BoolVar(&recreate, "recreate", false, "delete the object of the same type and name before the create command.")
+	flag.IntVar(&checkpointInterval, "command-batch-checkpoint-interval", 0, "write the results to <output-filepath>.checkpoint every N commands, the output must be a regular file, "+
+		"and resume from it by skipping the completed commands when it exists. 0 to disable.")
+	flag.StringVar(&commandsFile, "commands-file", "", "execute the commands in this file instead of the neutron command template, "+
+		"one 'loadbalancer|lbaas-...' or 'lbaas-...' command per line.")
+	flag.BoolVar(&generateOnly, "generate-only", false, "the same as generate mode.")
+	flag.StringVar(&generateFormat, "generate-format", generateFormat, "generate mode: internal('loadbalancer|lbaas-...') or neutron('neutron lbaas-...').")
+	flag.BoolVar(&generateJSON, "generate-json", false, "generate mode: print the commands as a JSON array.")
+	flag.StringVar(&cleanupFile, "cleanup-file", "", "write the delete commands of the created objects to this file, in reverse dependency order.")
+	flag.StringVar(&cleanupPath, "cleanup", "", "execute the delete commands in the file written by --cleanup-file, instead of the neutron command template.")
+	flag.StringVar(&scenarioFile, "scenario-file", "", "import mode: the scenario file written by export mode.")
+	flag.StringVar(&bulkStatusFile, "bulk-status-file", "", "bulk-status mode: file of 'type,id' lines.")
+	flag.StringVar(&unstickLB, "unstick-lb", "", "unstick mode: the loadbalancer id to reset.")
+	flag.StringVar(&unstickStatus, "unstick-status", unstickStatus, "unstick mode: the provisioning status to reset to, ACTIVE or ERROR.")
+	flag.DurationVar(&unstickMinAge, "unstick-min-age", unstickMinAge, "unstick mode: refuse to reset loadbalancers pending for less than this.")
+	flag.BoolVar(&unstickConfirmed, "i-know-what-i-am-doing", false, "unstick mode: confirm updating the neutron database directly.")
+	flag.StringVar(&projectID, "os-project-id", DefaultProjectID(), "limit database lookups to this project, defaults to $OS_PROJECT_ID or $OS_TENANT_ID.")
+	flag.BoolVar(&shuffle, "shuffle", false, "run the generated commands in a random order, seeded by --seed or the time; "+
+		"the template position of each command is recorded in the results.")
+	flag.Var(&seedFlag{}, "seed", "the seed of --shuffle, to reproduce the order of a run.")
+	flag.BoolVar(&printSchema, "print-schema", false, "print the JSON schema of the output file of --output-format, and exit.")
+	flag.BoolVar(&noColor, "no-color", false, "do not color the report on terminals, the same as NO_COLOR.")
+	flag.DurationVar(&reportSLA, "report-sla", 0, "on terminals, show the successful commands slower than this in yellow in the report, 0 to disable.")
+	flag.BoolVar(&showVersion, "version", false, "print the version, git commit and build date, and exit.")
+	flag.BoolVar(&helpAll, "help-all", false, "show all the command arguments with defaults, environment variables and examples.")
+
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if _, ok := modes[args[0]]; ok {
+			mode = args[0]
+			args = args[1:]
+		}
+	}
 
-	logPrefix := fmt.Sprintf("Command(%d/%d):", cmdctx.Seq, len(cmdList))
+	flag.Usage = PrintUsage
+	_ = flag.CommandLine.Parse(args)
 
-	if cmdctx.OperationType == "show" || cmdctx.OperationType == "list" ||
-		(cmdctx.ResourceType == "loadbalancer" && cmdctx.OperationType == "create") {
-		return nil
+	if helpAll {
+		PrintHelpAll()
+		os.Exit(0)
+	}
+	if noColor {
+		colorEnabled = false
+	}
+	if showVersion {
+		fmt.Println(version.String(filepath.Base(os.Args[0])))
+		os.Exit(0)
+	}
+	if printSchema {
+		if outputFormat != "json" && outputFormat != "jsonl" && outputFormat != "legacy" {
+			exitf(exitUsage, "Invalid output format: %s, should be json, jsonl or legacy", outputFormat)
+		}
+		PrintSchema()
+		os.Exit(0)
 	}
 
-	logger.Printf("%s Confirm %s is not pending", logPrefix, cmdctx.LoadBalancer)
+	if generateOnly {
+		mode = "generate"
+	}
+	if mode == "generate" {
+		// keep stdout for the generated commands.
+		logger.SetOutput(os.Stderr)
+		if generateFormat != "internal" && generateFormat != "neutron" {
+			exitf(exitUsage, "Invalid generate format: %s, should be internal or neutron", generateFormat)
+		}
+	}
 
-	maxErrTries := 3
-	errTried := 0
-	for retries := maxCheckTimes; retries > 0; retries-- {
-		var status string
-		var err error
-		if dbConn != nil {
-			status, err = LBStatusFromDB(cmdctx.LoadBalancer)
-		} else {
-			status, err = LBStatusFromCmd(cmdctx.LoadBalancer)
+	if logFile != "" {
+		lf, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			logger.Fatalf("Failed to open log file %s: %s", logFile, err.Error())
 		}
+		logger.SetOutput(lf)
+	}
+	logger.Printf("%20s: %s", "Version", version.String(filepath.Base(os.Args[0])))
 
+	if skipExisting && recreate {
+		exitf(exitUsage, "--skip-existing and --recreate are exclusive")
+	}
+
+	if quiet && verbose {
+		exitf(exitUsage, "--quiet and --verbose are exclusive")
+	}
+	if quiet {
+		logLevel = "warn"
+	}
+	if verbose {
+		logLevel = "debug"
+	}
+	if _, ok := logLevels[logLevel]; !ok {
+		exitf(exitUsage, "Invalid log level: %s, should be debug, info, warn or error", logLevel)
+	}
+
+	if auditHash && auditHMACKey == "" {
+		exitf(exitUsage, "--command-audit-hash requires --audit-hmac-key")
+	}
+
+	if jsonPathFilterExpr != "" {
+		filter, err := ParseJSONPathFilter(jsonPathFilterExpr)
 		if err != nil {
-			logger.Printf("%s Checking loadbalancer(%s) status failed: %s",
-				logPrefix, cmdctx.LoadBalancer, err.Error())
-			errTried++
-			if errTried >= maxErrTries {
-				return fmt.Errorf("Loadbalancer %s status check fails for %d times, last failure: %s",
-					cmdctx.LoadBalancer, maxErrTries, err.Error())
-			}
-		} else {
-			errTried = 0
+			exitf(exitUsage, "Invalid --output-jsonpath-filter: %s", err.Error())
+		}
+		jsonPathFilter = filter
+	}
+
+	for _, n := range assertExprs {
+		a, err := ParseAssertion(n)
+		if err != nil {
+			exitf(exitUsage, "Invalid --assert: %s", err.Error())
+		}
+		assertions = append(assertions, a)
+	}
+	if assertFile != "" {
+		asserts, err := LoadAssertFile(assertFile)
+		if err != nil {
+			exitf(exitUsage, "Invalid --assert-file %s: %s", assertFile, err.Error())
 		}
+		assertions = append(assertions, asserts...)
+	}
 
-		logger.Printf("%s Checked loadbalancer %s status %s",
-			logPrefix, cmdctx.LoadBalancer, status)
+	if probeMode != "" && probeMode != "tcp" && probeMode != "http" {
+		exitf(exitUsage, "Invalid --probe: %s, should be tcp or http", probeMode)
+	}
 
-		if strings.HasPrefix(status, "PENDING_") {
-			time.Sleep(time.Duration(1) * time.Second)
-			continue
-		} else {
-			return nil
+	for _, n := range readinessFlags {
+		resourceType, strategy, err := ParseReadinessStrategy(n)
+		if err != nil {
+			exitf(exitUsage, "Invalid --readiness-strategy: %s", err.Error())
 		}
+		readinessStrategies[resourceType] = strategy
 	}
 
-	return fmt.Errorf("Loadbalancer %s is still PENDING after %d times' check", cmdctx.LoadBalancer, maxCheckTimes)
-}
+	if bigipCredentialsFile != "" {
+		if err := LoadBIGIPCredentials(bigipCredentialsFile); err != nil {
+			exitf(exitUsage, "Failed to load --bigip-credentials-file %s: %s", bigipCredentialsFile, err.Error())
+		}
+	}
+	if bigipHost != "" && bigipUsername == "" {
+		exitf(exitUsage, "--bigip-host requires --bigip-username and --bigip-password, or --bigip-credentials-file")
+	}
 
-// WaitForDone ...
-func (cmdctx *CommandContext) WaitForDone() (bool, error) {
-	fs := time.Now()
-	defer func() {
-		fe := time.Now()
-		logger.Printf("Command(%d/%d): Checked time: %d ms", cmdctx.Seq, len(cmdList), fe.Sub(fs).Milliseconds())
-	}()
-
-	if cmdctx.OperationType == "create" || cmdctx.OperationType == "update" || cmdctx.OperationType == "delete" {
-		if cmdctx.LoadBalancer == "" {
-			logger.Printf("Command(%d/%d): No loadbalancer appointed, no check to do.", cmdctx.Seq, len(cmdList))
-			return true, nil
-		} else if cmdctx.ResourceType == "loadbalancer" && cmdctx.OperationType == "delete" {
-			logger.Printf("Command(%d/%d): Loadbalancer deleted, no check to do.", cmdctx.Seq, len(cmdList))
-			return true, nil
-		} else {
-			logger.Printf("Command(%d/%d): Check loadbalancer %s status", cmdctx.Seq, len(cmdList), cmdctx.LoadBalancer)
-			for maxTries := maxCheckTimes; maxTries > 0; maxTries-- {
-				var status string
-				var err error
-
-				// Check created object's status
-				if dbConn != nil && cmdctx.ObjectID != "" {
-					status, err = DBProvisioningStatusOf(cmdctx.ResourceType, cmdctx.ObjectID, true)
-					if err != nil {
-						logger.Printf("Command(%d/%d): Failed to fetch object %s status: %s",
-							cmdctx.Seq, len(cmdList), cmdctx.ObjectID, err.Error())
-						break
-					}
-					logger.Printf("Command(%d/%d): Object(%s) %s staus is %s",
-						cmdctx.Seq, len(cmdList), cmdctx.ResourceType, cmdctx.ObjectID, status)
-					if strings.HasPrefix(status, "PENDING_") {
-						time.Sleep(time.Duration(1) * time.Second)
-						continue
-					}
-				}
+	for _, n := range commandEnvFlags {
+		if !strings.Contains(n, "=") || strings.ContainsAny(n, ",|") {
+			exitf(exitUsage, "Invalid --command-env %s, expect NAME=value without ',' or '|'", n)
+		}
+	}
 
-				// Check belonged loadbalancer's status
-				if dbConn != nil {
-					status, err = LBStatusFromDB(cmdctx.LoadBalancer)
-				} else {
-					status, err = LBStatusFromCmd(cmdctx.LoadBalancer)
-				}
-				if err != nil {
-					logger.Printf("Command(%d/%d): Checked loadbalancer %s Failed: %s",
-						cmdctx.Seq, len(cmdList), cmdctx.LoadBalancer, err.Error())
-					break
-				}
+	if len(cloudOpenRCs) > 0 && (openrcPath != "" || mode != "run") {
+		exitf(exitUsage, "--openrc runs the batch against each cloud, exclusive with --openrc-path and the modes")
+	}
 
-				logger.Printf("Command(%d/%d): Loadbalancer %s staus is %s",
-					cmdctx.Seq, len(cmdList), cmdctx.LoadBalancer, status)
-				if strings.HasPrefix(status, "PENDING_") {
-					time.Sleep(time.Duration(1) * time.Second)
-					continue
-				} else {
-					return true, nil
-				}
-			}
-			return false, fmt.Errorf("LB: %s left PENDING", cmdctx.LoadBalancer)
+	if neutronCACert != "" {
+		if _, err := NeutronTLSConfig(); err != nil {
+			exitf(exitUsage, "Invalid --neutron-cacert: %s", err.Error())
 		}
-	} else { // 'show' 'list' no need to check
-		return true, nil
 	}
-}
 
-// HandleArguments handle user's input.
-func HandleArguments() {
-	flag.StringVar(&outputFilePath, "output-filepath", "/dev/stdout", "output the result")
-	flag.IntVar(&maxCheckTimes, "max-check-times", maxCheckTimes, "The max times for checking loadbalancer is ready for next step.")
-	flag.StringVar(&loadbalancer, "loadbalancer", "", "the loadbalancer name or id for checking execution status.")
-	flag.StringVar(&mysqluri, "mysql-uri", "", "database connection string")
-	flag.BoolVar(&checkDone, "check-done", false, "check the object is created or not.")
+	if mysqluri == "" {
+		uri, err := DBURIFromFlags()
+		if err != nil {
+			exitf(exitUsage, "Invalid database flags: %s", err.Error())
+		}
+		mysqluri = uri
+	} else if dbUsername+dbPassword+dbPasswordFile+dbHost+dbPort+dbName != "" {
+		exitf(exitUsage, "--mysql-uri and the --db-* flags are exclusive")
+	}
+	if validateRefs && (mysqluri == "" || lbaasAPIVersion != "v2") {
+		exitf(exitUsage, "--validate-refs checks the objects in database, requires --mysql-uri and neutron lbaas v2")
+	}
 
-	flag.Usage = PrintUsage
-	flag.Parse()
+	if seedSet && !shuffle {
+		exitf(exitUsage, "--seed requires --shuffle")
+	}
+
+	if (confirmBatch || stepMode) && !IsTerminal(os.Stdin) {
+		exitf(exitUsage, "--confirm and --step read the answers from the terminal, stdin is not a terminal")
+	}
+	if stepMode && cloudsParallel {
+		exitf(exitUsage, "--step runs the commands one by one, exclusive with --clouds-parallel")
+	}
+
+	if openrcWatch && openrcPath == "" {
+		exitf(exitUsage, "--use-openrc-file-watcher requires --openrc-path")
+	}
+
+	if omitRawOutput && artifactsDir == "" {
+		exitf(exitUsage, "--omit-raw-output requires --artifacts-dir")
+	}
+	if stderrDir != "" {
+		if err := os.MkdirAll(stderrDir, 0755); err != nil {
+			logger.Fatalf("Failed to create stderr dir %s: %s", stderrDir, err.Error())
+		}
+	}
+
+	if compactOutput && prettyOutput {
+		exitf(exitUsage, "--output-format-compact and --output-format-pretty are exclusive")
+	}
+
+	if notifyOn != "all" && notifyOn != "failure" {
+		exitf(exitUsage, "Invalid notify on: %s, should be all or failure", notifyOn)
+	}
+
+	if sortReport != "seq" && sortReport != "duration" && sortReport != "status" {
+		exitf(exitUsage, "Invalid report order: %s, should be seq, duration or status", sortReport)
+	}
+
+	if err := UseLBaaSAPIVersion(lbaasAPIVersion); err != nil {
+		exitf(exitUsage, "%s", err.Error())
+	}
+	if backend != "cli" && backend != "api" {
+		exitf(exitUsage, "Invalid backend: %s, should be cli or api", backend)
+	}
+	if neutronFormat != "json" && neutronFormat != "table" && neutronFormat != "value" && neutronFormat != "none" {
+		exitf(exitUsage, "Invalid neutron format: %s, should be json, table, value or none", neutronFormat)
+	}
+	summaryColumnList = ParseSummaryColumns(summaryColumns)
+	if buckets, err := ParseHistogramBuckets(histogramBuckets); err != nil {
+		exitf(exitUsage, "Invalid --histogram-buckets: %s", err.Error())
+	} else {
+		latencyBuckets = buckets
+	}
+	if states, err := ParsePendingStates(pendingStatesFlag); err != nil {
+		exitf(exitUsage, "Invalid --pending-states: %s", err.Error())
+	} else {
+		pendingStates = states
+	}
+	for _, n := range waitOverrideFlags {
+		key, budget, err := ParseWaitOverride(n)
+		if err != nil {
+			exitf(exitUsage, "Invalid --wait-override: %s", err.Error())
+		}
+		waitOverrides[key] = budget
+	}
+	if backend == "api" && neutronFormat != "json" {
+		exitf(exitUsage, "api backend outputs json only, --neutron-format should be json")
+	}
+	if backend == "api" && lbaasAPIVersion != "v2" {
+		exitf(exitUsage, "api backend supports neutron lbaas v2 only")
+	}
+	if lbaasAPIVersion == "v1" && waitOperatingStatus != "" {
+		exitf(exitUsage, "--wait-operating-status supports neutron lbaas v2 only")
+	}
+	if lbaasAPIVersion == "v1" && mode != "run" && mode != "bulk-status" {
+		exitf(exitUsage, "%s mode supports neutron lbaas v2 only", mode)
+	}
+
+	if noSleep {
+		interCommandDelay = 0
+	}
+	if maxFailures < 0 || maxConsecutiveFailures < 0 {
+		exitf(exitUsage, "--max-failures and --max-consecutive-failures should not be negative")
+	}
+	if adaptiveThrottle {
+		if throttleStep <= 0 || throttleMaxDelay <= 0 || throttleSuccesses <= 0 {
+			exitf(exitUsage, "--throttle-step, --throttle-max-delay and --throttle-successes should be positive")
+		}
+		throttle = NewThrottle(interCommandDelay, throttleMaxDelay, throttleStep, throttleSuccesses)
+	}
 
-	if mysqluri != "" {
+	if outputFormat != "json" && outputFormat != "jsonl" && outputFormat != "legacy" {
+		exitf(exitUsage, "Invalid output format: %s, should be json, jsonl or legacy", outputFormat)
+	}
+
+	if mysqluri != "" && mode != "generate" {
 		// mysql conn string example: neutron:abd2aebadeff3e32@tcp(1.2.3.4:3306)/ovs_neutron
-		matched, _ := regexp.MatchString(`\w+:\w+@tcp\([0-9\.]+:\d+\)/\w+`, mysqluri)
+		matched, _ := regexp.MatchString(`\w+:.+@tcp\([\w\.\-]+:\d+\)/\w+`, mysqluri)
 		if !matched {
-			logger.Fatalf("Invalid mysql uri provided: %s", mysqluri)
+			exitf(exitUsage, "Invalid mysql uri provided: %s", MaskDSN(mysqluri))
+		}
+		uri, err := WithParseTime(mysqluri)
+		if err != nil {
+			exitf(exitUsage, "Invalid mysql uri provided: %s", err.Error())
 		}
+		mysqluri = uri
 		conn, err := gorm.Open(mysql.Open(mysqluri), &gorm.Config{})
 		if err != nil {
-			logger.Fatal(err)
+			exitf(exitDB, "Failed to connect the database: %s", MaskDSNError(err, mysqluri).Error())
 		}
 		dbConn = conn
-		logger.Printf("%20s: %s", "MySQL URI", mysqluri)
+		dbFailover = status.NewFailover(status.FailoverOptions{
+			Threshold:      time.Duration(failoverThresholdMs) * time.Millisecond,
+			RecoverQueries: dbRecoverQueries,
+			Logger:         levelLogger{},
+		})
+		logger.Printf("%20s: %s", "MySQL URI", MaskDSN(mysqluri))
+		if projectID != "" {
+			logger.Printf("%20s: %s", "Project ID", projectID)
+		}
 	}
 
-	of, e := os.OpenFile(outputFilePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, os.ModeAppend|os.ModePerm)
-	if e != nil {
-		logger.Fatalf("Failed to open file %s for writing.", e.Error())
+	if len(outputFilePaths) == 0 {
+		outputFilePaths = StringsFlag{"/dev/stdout"}
+	}
+	if StringArray(outputFilePaths).IndexOf(dbSink) != -1 {
+		storeResults = true
+	}
+
+	if storeResults && mode == "run" {
+		if err := OpenResultsDB(); err != nil {
+			exitf(exitDB, "Failed to open results database: %s", err.Error())
+		}
+		logger.Printf("%20s: %s", "Store Results", ResultRecord{}.TableName())
+	}
+
+	if mode != "generate" {
+		sinks, e := OpenOutputFiles(outputFilePaths)
+		if e != nil {
+			logger.Fatalf("Failed to open file %s for writing.", e.Error())
+		}
+		outputFile = sinks
+		logger.Printf("%20s: %s", "Output File Path", outputFilePaths.String())
+		if checkpointInterval > 0 {
+			if err := CheckCheckpointOutput(); err != nil {
+				exitf(exitUsage, "%s", err.Error())
+			}
+		}
+	}
+
+	if commandsFile != "" {
+		logger.Printf("%20s: %s", "Commands File", commandsFile)
+		cmds, err := ReadCommandsFile(commandsFile, loadbalancer)
+		if err != nil {
+			exitf(exitUsage, "Failed to read commands file: %s", err.Error())
+		}
+		cmdList = cmds
+		return
+	}
+
+	if cleanupPath != "" {
+		logger.Printf("%20s: %s", "Cleanup File", cleanupPath)
+		cmds, err := ReadCommandsFile(cleanupPath, "")
+		if err != nil {
+			exitf(exitUsage, "Failed to read cleanup file: %s", err.Error())
+		}
+		cmdList = cmds
+		return
+	}
+
+	if mode == "import" {
+		logger.Printf("%20s: %s", "Scenario File", scenarioFile)
+		cmds, err := ImportScenario(scenarioFile)
+		if err != nil {
+			exitf(exitUsage, "Failed to import scenario: %s", err.Error())
+		}
+		cmdList = cmds
+		return
+	}
+
+	if mode != "run" && mode != "generate" {
+		logger.Printf("%20s: %s", "Mode", mode)
+		return
 	}
-	outputFile = of
-	logger.Printf("%20s: %s", "Output File Path", outputFilePath)
 
 	neutronArgsIndex := StringArray(os.Args).IndexOf("--")
 	if neutronArgsIndex == -1 {
-		logger.Fatal(usage)
+		exitf(exitUsage, "%s", usage)
 	}
 
 	variableArgsIndex := StringArray(os.Args).IndexOf("++")
@@ -451,44 +1486,46 @@ func HandleArguments() {
 	}
 
 	neutronCmdArgs := strings.Join(os.Args[neutronArgsIndex+1:variableArgsIndex], " ")
-	neutronCmdArgs = loadbalancer + "|" + neutronCmdArgs
+	neutronCmdArgs = EnvAnnotation(commandEnvFlags) + loadbalancer + "|" + neutronCmdArgs
 	logger.Printf("%20s: %s", "Command Template", neutronCmdArgs)
 
-	variables := map[string]StringArray{}
-
-	varStart := false
-
-	for _, n := range os.Args[neutronArgsIndex+1:] {
-		if n == "++" {
-			varStart = true
-			continue
-		}
-
-		if !varStart {
-			matches := varRegexp.FindAllString(n, -1)
-			for _, m := range matches {
-				// logger.Printf("found variable: %s\n", m)
-				l := len(m)
-				varName := m[2 : l-1]
-				variables[varName] = []string{}
-			}
-		} else {
-			for k := range variables {
-				if strings.HasPrefix(n, fmt.Sprintf("%s:", k)) {
-					kvp := strings.Split(n, ":")
-					v := ParseVarValues(strings.Join(kvp[1:], ":"))
-					variables[k] = append(variables[k], v...)
-				}
-			}
-		}
+	// the loadbalancer and environment overrides may be variables too, resolved per generated command.
+	names := template.Variables(strings.Join(commandEnvFlags, ","))
+	names = append(names, template.Variables(loadbalancer)...)
+	names = append(names, template.Variables(strings.Join(os.Args[neutronArgsIndex+1:variableArgsIndex], " "))...)
+	definitions := []string{}
+	if variableArgsIndex < len(os.Args) {
+		definitions = os.Args[variableArgsIndex+1:]
 	}
+	variables := template.ParseDefinitions(names, definitions)
 
 	logger.Printf("%20s:", "Variables")
 	for k, v := range variables {
 		logger.Printf("%30s: %v", k, v)
 	}
 
-	ConstructFromTemplate(neutronCmdArgs, variables)
+	cmdList = append(cmdList, template.Expand(neutronCmdArgs, variables)...)
+
+	if dedupe {
+		deduped, n := DedupeCommands(cmdList)
+		cmdList = deduped
+		logger.Printf("%20s: %d duplicated commands collapsed", "Dedupe", n)
+	}
+
+	// Generated commands keep the template order for the other runner.
+	if mode == "generate" {
+		return
+	}
+
+	templatePositions = TemplatePositions(cmdList)
+	if shuffle {
+		if !seedSet {
+			shuffleSeed = time.Now().UnixNano()
+		}
+		logger.Printf("%20s: %d", "Shuffle Seed", shuffleSeed)
+		ShuffleCommands(cmdList, shuffleSeed)
+		return
+	}
 
 	// Random cmdList order to help reducing objects' waiting time in the same loadbalancer.
 	for i := range cmdList {
@@ -499,56 +1536,173 @@ func HandleArguments() {
 	}
 }
 
+// ConfirmDeletes prompt the user when there are delete commands.
+// Returns true if there is no delete or the user confirms.
+func ConfirmDeletes() bool {
+	deletes := 0
+	lbs := map[string]bool{}
+	for _, n := range cmdList {
+		cmdctx := NewCommandContext(n)
+		if cmdctx.OperationType == "delete" {
+			deletes++
+			lbs[cmdctx.LoadBalancer] = true
+		}
+	}
+	if deletes == 0 {
+		return true
+	}
+
+	fmt.Printf("%d delete command(s) across %d loadbalancer(s) to run. Proceed? [y/N] ", deletes, len(lbs))
+	answer, _ := stdinReader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// MissingEnvVars get the names absent from the environment.
+func MissingEnvVars(names []string) []string {
+	missing := []string{}
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if _, ok := LookupEnv(n); n != "" && !ok {
+			missing = append(missing, n)
+		}
+	}
+	return missing
+}
+
+// DefaultProjectID get the project id from openrc environment.
+func DefaultProjectID() string {
+	if id := os.Getenv("OS_PROJECT_ID"); id != "" {
+		return id
+	}
+	return os.Getenv("OS_TENANT_ID")
+}
+
 // PrintUsage print the usage
 func PrintUsage() {
 	fmt.Fprintf(os.Stderr, usage)
 	fmt.Fprintf(os.Stderr, example)
+	fmt.Fprintf(os.Stderr, "Modes: \n\n")
+	names := []string{}
+	for m := range modes {
+		names = append(names, m)
+	}
+	sort.Strings(names)
+	for _, m := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", m, modes[m])
+	}
+	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "Command Arguments: \n\n")
 	flag.PrintDefaults()
 	fmt.Fprintf(os.Stderr, "\n")
 }
 
-// ConstructFromTemplate recursively generate the command from templete
-func ConstructFromTemplate(template string, variables map[string]StringArray) {
-	varInTmp := varRegexp.FindString(template)
-	if varInTmp == "" {
-		cmdList = append(cmdList, template)
-		return
-	}
-	l := len(varInTmp)
-	varName := varInTmp[2 : l-1]
-
-	r := regexp.MustCompile(varInTmp)
-
-	for _, k := range variables[varName] {
-		replaced := r.ReplaceAllString(template, k)
-		ConstructFromTemplate(replaced, variables)
-	}
-}
-
-// ParseVarValues parse the value ranges to actual value list
-// Supports: '-' num list and ',' list
-//		1-5
-// 		a,b,c
-// 		1-3,4,6-9,a,b,c
-func ParseVarValues(v string) []string {
-	rlt := []string{}
-	ls := strings.Split(v, ",")
-	p := regexp.MustCompile(`^\d+\-\d+$`)
-	for _, n := range ls {
-		matched := p.MatchString(n)
-		if matched {
-			se := strings.Split(n, "-")
-			s, _ := strconv.Atoi(se[0])
-			e, _ := strconv.Atoi(se[1])
-			for i := s; i <= e; i++ {
-				rlt = append(rlt, fmt.Sprintf("%d", i))
+// FlagAliases get the other names of each flag: the flags set the same variable, like --yes and --force,
+// and the mode of the flags in flagModeAliases.
+func FlagAliases() map[string][]string {
+	byVar := map[uintptr][]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		if v := reflect.ValueOf(f.Value); v.Kind() == reflect.Ptr {
+			byVar[v.Pointer()] = append(byVar[v.Pointer()], f.Name)
+		}
+	})
+	aliases := map[string][]string{}
+	for _, names := range byVar {
+		for _, n := range names {
+			for _, m := range names {
+				if m != n {
+					aliases[n] = append(aliases[n], "--"+m)
+				}
 			}
-		} else {
-			rlt = append(rlt, n)
 		}
 	}
-	return rlt
+	for name, m := range flagModeAliases {
+		aliases[name] = append(aliases[name], "mode "+m)
+	}
+	return aliases
+}
+
+// PrintHelpAll print all the command arguments as a table.
+func PrintHelpAll() {
+	fmt.Fprintf(os.Stderr, usage)
+	aliases := FlagAliases()
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Flag\tAlias\tDefault\tEnv Var\tExample\tDescription")
+	flag.VisitAll(func(f *flag.Flag) {
+		alias, def, env, eg := strings.Join(aliases[f.Name], ", "), f.DefValue, flagEnvVars[f.Name], flagExamples[f.Name]
+		if alias == "" {
+			alias = "-"
+		}
+		if def == "" {
+			def = "-"
+		}
+		if env == "" {
+			env = "-"
+		}
+		if eg == "" {
+			eg = "-"
+		}
+		fmt.Fprintf(w, "--%s\t%s\t%s\t%s\t%s\t%s\n", f.Name, alias, def, env, eg, f.Usage)
+	})
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "\n")
+}
+
+// ReadCommandsFile read commands in cmdList format, one per line.
+// Lines without loadbalancer are checked against defaultLB; the leading 'neutron' is optional.
+// The commands are ordered by the label=NAME| and needs=SEQ|LABEL,...| annotations, see OrderByNeeds.
+func ReadCommandsFile(path string, defaultLB string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cmds := []string{}
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			continue
+		}
+		_, _, line := SplitDepAnnotations(raw)
+		env, rest, err := SplitEnvAnnotation(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineno, err.Error())
+		}
+		annotation := raw[:len(raw)-len(line)]
+		if env != nil {
+			annotation, line = raw[:len(raw)-len(rest)], rest
+		}
+		lbAndCmd := strings.SplitN(line, "|", 2)
+		if len(lbAndCmd) == 1 {
+			lbAndCmd = []string{defaultLB, line}
+		}
+		lbAndCmd[1] = strings.TrimPrefix(strings.TrimSpace(lbAndCmd[1]), "neutron ")
+		cmd := annotation + lbAndCmd[0] + "|" + lbAndCmd[1]
+		if _, err := ParseCommandContext(cmd); err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineno, err.Error())
+		}
+		cmds = append(cmds, cmd)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return OrderByNeeds(cmds)
+}
+
+// DedupeCommands remove the duplicated commands, keeping the first occurrences in order.
+// Returns the deduplicated commands and the number of removed ones.
+func DedupeCommands(cmds []string) ([]string, int) {
+	seen := map[string]bool{}
+	deduped := []string{}
+	for _, n := range cmds {
+		if !seen[n] {
+			seen[n] = true
+			deduped = append(deduped, n)
+		}
+	}
+	return deduped, len(cmds) - len(deduped)
 }
 
 // IndexOf Implement the StringArray's IndexOf
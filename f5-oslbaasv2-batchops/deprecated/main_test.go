@@ -0,0 +1,1846 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"f5-oslbaasv2-batchops/pkg/batch"
+	"f5-oslbaasv2-batchops/pkg/status"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func Test_DedupeCommands(t *testing.T) {
+	cmds, n := DedupeCommands([]string{"|a", "|b", "|a", "|c", "|b"})
+	if n != 2 || !reflect.DeepEqual(cmds, []string{"|a", "|b", "|c"}) {
+		t.Fatalf("unexpected deduped commands: %v, %d removed", cmds, n)
+	}
+}
+
+func Test_CleanupCommands(t *testing.T) {
+	results := []*CommandContext{
+		{CommandContext: batch.CommandContext{Command: "neutron --debug lbaas-loadbalancer-create --name lb1 subnet1", ResourceType: "loadbalancer", OperationType: "create", ObjectID: "lb-id"}},
+		{CommandContext: batch.CommandContext{Command: "neutron --debug lbaas-listener-create --loadbalancer lb1", ResourceType: "listener", OperationType: "create", ObjectID: "ls-id", LoadBalancer: "lb1"}},
+		{CommandContext: batch.CommandContext{Command: "neutron --debug lbaas-pool-create --listener ls1", ResourceType: "pool", OperationType: "create", ObjectID: "pl-id", LoadBalancer: "lb1"}},
+		{CommandContext: batch.CommandContext{Command: "neutron --debug lbaas-member-create --subnet subnet1 pool1", ResourceType: "member", OperationType: "create", ObjectID: "mb-id1", LoadBalancer: "lb1"}},
+		{CommandContext: batch.CommandContext{Command: "neutron --debug lbaas-member-create pool1 --subnet subnet1 --address 10.0.0.2", ResourceType: "member", OperationType: "create", ObjectID: "mb-id2", LoadBalancer: "lb1"}},
+		{CommandContext: batch.CommandContext{Command: "neutron --debug lbaas-member-create --subnet subnet1 pool1", ResourceType: "member", OperationType: "create", ExitCode: 1, LoadBalancer: "lb1"}},
+		{CommandContext: batch.CommandContext{Command: "neutron --debug lbaas-healthmonitor-create --pool pool1", ResourceType: "healthmonitor", OperationType: "create", ObjectID: "hm-id", LoadBalancer: "lb1"}},
+		{CommandContext: batch.CommandContext{Command: "neutron --debug lbaas-l7policy-create --listener ls1", ResourceType: "l7policy", OperationType: "create", ObjectID: "pc-id", LoadBalancer: "lb1"}},
+		{CommandContext: batch.CommandContext{Command: "neutron --debug lbaas-l7rule-create policy1 --type PATH --invert --value /api", ResourceType: "l7rule", OperationType: "create", ObjectID: "rl-id", LoadBalancer: "lb1"}},
+		{CommandContext: batch.CommandContext{Command: "neutron --debug lbaas-pool-show pool1", ResourceType: "pool", OperationType: "show", ObjectID: "pl-id", LoadBalancer: "lb1"}},
+	}
+	expected := []string{
+		"lb1|lbaas-l7rule-delete rl-id policy1",
+		"lb1|lbaas-l7policy-delete pc-id",
+		"lb1|lbaas-healthmonitor-delete hm-id",
+		"lb1|lbaas-member-delete mb-id2 pool1",
+		"lb1|lbaas-member-delete mb-id1 pool1",
+		"lb1|lbaas-pool-delete pl-id",
+		"lb1|lbaas-listener-delete ls-id",
+		"lb-id|lbaas-loadbalancer-delete lb-id",
+	}
+
+	cmds := CleanupCommands(results)
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Fatalf("unexpected cleanup commands:\n%v\nexpected:\n%v", cmds, expected)
+	}
+}
+
+func Test_MetricsRegistry(t *testing.T) {
+	m := NewMetricsRegistry()
+	m.Commands.WithLabelValues("member", "create", "success").Inc()
+	m.Commands.WithLabelValues("member", "create", "success").Inc()
+	m.InFlight.Inc()
+	m.Duration.WithLabelValues("member", "create").Observe(2)
+
+	server := httptest.NewServer(promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{}))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	families, err := (&expfmt.TextParser{}).TextToMetricFamilies(resp.Body)
+	if err != nil {
+		t.Fatalf("invalid exposition format: %s", err.Error())
+	}
+	if len(families) != 3 {
+		t.Fatalf("unexpected metric families, no go or process ones expected: %v", families)
+	}
+
+	if v := families["batchops_commands_total"].GetMetric()[0].GetCounter().GetValue(); v != 2 {
+		t.Fatalf("unexpected commands_total: %v", v)
+	}
+	if v := families["batchops_commands_in_flight"].GetMetric()[0].GetGauge().GetValue(); v != 1 {
+		t.Fatalf("unexpected commands_in_flight: %v", v)
+	}
+	h := families["batchops_command_duration_seconds"].GetMetric()[0].GetHistogram()
+	if h.GetSampleCount() != 1 || h.GetBucket()[2].GetCumulativeCount() != 0 || h.GetBucket()[3].GetCumulativeCount() != 1 {
+		t.Fatalf("unexpected duration histogram: %v", h)
+	}
+}
+
+func Test_PushMetrics(t *testing.T) {
+	var path string
+	var families []*dto.MetricFamily
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.Method + " " + r.URL.Path
+		decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			mf := &dto.MetricFamily{}
+			if err := decoder.Decode(mf); err != nil {
+				break
+			}
+			families = append(families, mf)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	defer func(m *MetricsRegistry, r *RunMetadata) { metrics, runMeta, pushgatewayURL = m, r, "" }(metrics, runMeta)
+	metrics, runMeta, pushgatewayURL = NewMetricsRegistry(), &RunMetadata{RunID: "run1"}, server.URL
+	metrics.InFlight.Inc()
+
+	if err := PushMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	if path != "PUT /metrics/job/f5-oslbaasv2-batchops/run_id/run1" {
+		t.Fatalf("unexpected push: %s", path)
+	}
+	if len(families) != 1 || families[0].GetName() != "batchops_commands_in_flight" {
+		t.Fatalf("unexpected pushed metrics: %v", families)
+	}
+}
+
+func Test_DerivedLoadBalancer(t *testing.T) {
+	for cmd, expected := range map[string]string{
+		"|lbaas-listener-create --loadbalancer lb1 --protocol HTTP --protocol-port 80":     "lb1",
+		"|lbaas-pool-create --loadbalancer=lb2 --protocol HTTP --lb-algorithm ROUND_ROBIN": "lb2",
+		"|lbaas-loadbalancer-update --description batch lb3":                               "lb3",
+		"|lbaas-loadbalancer-create --name lb4 subnet1":                                    "lb4",
+	} {
+		lb, err := NewCommandContext(cmd).DerivedLoadBalancer()
+		if err != nil || lb != expected {
+			t.Fatalf("unexpected loadbalancer of %s: %s, %v", cmd, lb, err)
+		}
+	}
+	if _, err := NewCommandContext("|lbaas-member-create --subnet s --address 10.0.0.1 --protocol-port 80 pool1").DerivedLoadBalancer(); err == nil {
+		t.Fatalf("expected error resolving member parent without database")
+	}
+}
+
+func Test_JSONPathFilter(t *testing.T) {
+	filter, err := ParseJSONPathFilter(`$.results[?(@.resource_type == "member" && @.duration >= 1000)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		cmdctx   *CommandContext
+		expected bool
+	}{
+		{&CommandContext{CommandContext: batch.CommandContext{ResourceType: "member", Duration: 2 * time.Second}}, true},
+		{&CommandContext{CommandContext: batch.CommandContext{ResourceType: "member", Duration: 500 * time.Millisecond}}, false},
+		{&CommandContext{CommandContext: batch.CommandContext{ResourceType: "pool", Duration: 2 * time.Second}}, false},
+	} {
+		if filter.Match(c.cmdctx) != c.expected {
+			t.Fatalf("unexpected match of %s %v", c.cmdctx.ResourceType, c.cmdctx.Duration)
+		}
+	}
+
+	if _, err := ParseJSONPathFilter(`$.results[0]`); err == nil {
+		t.Fatalf("expected error parsing non-filter expression")
+	}
+}
+
+func Test_ParseOpenRC(t *testing.T) {
+	f, err := ioutil.TempFile("", "openrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`#!/usr/bin/env bash
+export OS_AUTH_URL=http://10.0.0.1:5000/v3
+export OS_PROJECT_NAME="admin"
+export OS_USERNAME='admin'
+echo "Please enter your OpenStack Password: "
+export OS_PASSWORD_INPUT=secret
+export OS_PASSWORD=$OS_PASSWORD_INPUT
+`)
+	f.Close()
+
+	env, err := ParseOpenRC(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"OS_AUTH_URL":       "http://10.0.0.1:5000/v3",
+		"OS_PROJECT_NAME":   "admin",
+		"OS_USERNAME":       "admin",
+		"OS_PASSWORD_INPUT": "secret",
+		"OS_PASSWORD":       "secret",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("unexpected openrc variables: %v", env)
+	}
+
+	defer func(path string) {
+		openrcPath, openrcEnv = path, map[string]string{}
+	}(openrcPath)
+	openrcPath = f.Name()
+	if err := LoadOpenRC(); err != nil || openrcEnv["OS_PASSWORD"] != "secret" {
+		t.Fatalf("unexpected openrc loaded: %v %v", openrcEnv, err)
+	}
+	// half written, the password line not yet.
+	_ = ioutil.WriteFile(f.Name(), []byte("export OS_AUTH_URL=http://10.0.0.1:5000/v3\nexport OS_USERNAME=admin\n"), 0600)
+	if err := LoadOpenRC(); err == nil || openrcEnv["OS_PASSWORD"] != "secret" {
+		t.Fatalf("expected the variables kept, got %v %v", openrcEnv, err)
+	}
+}
+
+func Test_WatchOpenRC(t *testing.T) {
+	defer func(settle time.Duration) {
+		openrcPath, openrcEnv, openrcSettle = "", map[string]string{}, settle
+	}(openrcSettle)
+	openrcSettle = 50 * time.Millisecond
+
+	dir := t.TempDir()
+	openrcPath = filepath.Join(dir, "openrc")
+	_ = ioutil.WriteFile(openrcPath, []byte("export OS_AUTH_URL=http://10.0.0.1:5000/v3\nexport OS_USERNAME=admin\nexport OS_PASSWORD=secret\n"), 0600)
+	if err := LoadOpenRC(); err != nil {
+		t.Fatal(err)
+	}
+	stop, err := WatchOpenRC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	password := func() string {
+		v, _ := LookupEnv("OS_PASSWORD")
+		return v
+	}
+	waitFor := func(expected string) {
+		for i := 0; i < 100 && password() != expected; i++ {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if password() != expected {
+			t.Fatalf("expected OS_PASSWORD %s re-parsed, got %s", expected, password())
+		}
+	}
+
+	// rewritten in place.
+	_ = ioutil.WriteFile(openrcPath, []byte("export OS_AUTH_URL=http://10.0.0.1:5000/v3\nexport OS_USERNAME=admin\nexport OS_PASSWORD=rotated\n"), 0600)
+	waitFor("rotated")
+
+	// replaced by rename, like the editors do.
+	tmp := filepath.Join(dir, ".openrc.swp")
+	_ = ioutil.WriteFile(tmp, []byte("export OS_AUTH_URL=http://10.0.0.1:5000/v3\nexport OS_USERNAME=admin\nexport OS_PASSWORD=renamed\n"), 0600)
+	if err := os.Rename(tmp, openrcPath); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("renamed")
+
+	// the other files in the directory are not parsed.
+	_ = ioutil.WriteFile(filepath.Join(dir, "other"), []byte("export OS_PASSWORD=other\n"), 0600)
+	time.Sleep(4 * openrcSettle)
+	if password() != "renamed" {
+		t.Fatalf("unexpected OS_PASSWORD %s", password())
+	}
+}
+
+func Test_ResumeCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(format string) {
+		cmdList, cmdResults, resumedCount, outputFilePath, outputFormat = []string{}, NewResultCollector(), 0, "", format
+		outputFile.Close()
+		outputFile = nil
+	}(outputFormat)
+
+	outputFilePath = "/dev/stdout"
+	if err := CheckCheckpointOutput(); err == nil {
+		t.Fatal("expected the checkpoint of /dev/stdout rejected")
+	}
+
+	outputFilePath = dir + "/out.json"
+	sinks, err := OpenOutputFiles([]string{outputFilePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputFile = sinks
+	if err := CheckCheckpointOutput(); err != nil {
+		t.Fatal(err)
+	}
+	// the partial result written by the interrupted run.
+	_, _ = outputFile.WriteString(`{"partial": true}`)
+
+	cmdResults = NewResultCollector()
+	cmdResults.Add(&CommandContext{CommandContext: batch.CommandContext{Seq: 1, Command: "neutron --debug lbaas-loadbalancer-show lb2", Duration: 1500 * time.Millisecond}})
+	WriteCheckpoint()
+
+	cmdList = []string{"|lbaas-loadbalancer-show lb1", "|lbaas-loadbalancer-show lb2", "|lbaas-loadbalancer-show lb3"}
+	cmdResults = NewResultCollector()
+	if err := ResumeCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"|lbaas-loadbalancer-show lb2", "|lbaas-loadbalancer-show lb1", "|lbaas-loadbalancer-show lb3"}
+	if !reflect.DeepEqual(cmdList, expected) || resumedCount != 1 {
+		t.Fatalf("unexpected resumed commands: %v, %d completed", cmdList, resumedCount)
+	}
+	if results := cmdResults.Sorted(); len(results) != 1 || results[0].Duration != 1500*time.Millisecond {
+		t.Fatalf("unexpected resumed results: %+v", results)
+	}
+	if data, _ := ioutil.ReadFile(outputFilePath); len(data) != 0 {
+		t.Fatalf("expected the output rewritten, got %s", data)
+	}
+
+	// the jsonl records of the completed commands are written again.
+	outputFormat = "jsonl"
+	_, _ = outputFile.WriteString(`{"seqnum": 1}` + "\n" + `{"seqnum": 2, "partial": tr`)
+	cmdList = []string{"|lbaas-loadbalancer-show lb1", "|lbaas-loadbalancer-show lb2", "|lbaas-loadbalancer-show lb3"}
+	if err := ResumeCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(outputFilePath)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var record map[string]interface{}
+	if len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &record) != nil || record["command"] != "neutron --debug lbaas-loadbalancer-show lb2" {
+		t.Fatalf("unexpected resumed jsonl output: %s", data)
+	}
+}
+
+// fakeExecutor answers the commands by the script, keyed by the neutron subcommand.
+type fakeExecutor struct {
+	script map[string][]fakeRun
+	argvs  [][]string
+}
+
+type fakeRun struct {
+	stdout   string
+	stderr   string
+	exitCode int
+	delay    time.Duration
+}
+
+// Run pop the next scripted run of the subcommand, the last one is repeated.
+func (fe *fakeExecutor) Run(ctx context.Context, argv []string) (string, string, int, error) {
+	fe.argvs = append(fe.argvs, argv)
+	subcmd := ""
+	for _, n := range argv {
+		if strings.HasPrefix(n, lbaasSchema.SubcommandPrefix) {
+			subcmd = n
+			break
+		}
+	}
+	runs := fe.script[subcmd]
+	if len(runs) == 0 {
+		return "", "unknown command", 2, fmt.Errorf("exit status 2")
+	}
+	r := runs[0]
+	if len(runs) > 1 {
+		fe.script[subcmd] = runs[1:]
+	}
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return "", "", -1, ctx.Err()
+	}
+	if r.exitCode != 0 {
+		return r.stdout, r.stderr, r.exitCode, fmt.Errorf("exit status %d", r.exitCode)
+	}
+	return r.stdout, r.stderr, 0, nil
+}
+
+func Test_ExecuteWithFakeExecutor(t *testing.T) {
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-pool-create":        {{stdout: `{"id": "pool-id"}`, delay: 10 * time.Millisecond}},
+		"lbaas-member-create":      {{stderr: "Conflict", exitCode: 1}},
+		"lbaas-healthmonitor-show": {{stdout: `{"id": `}},
+		"lbaas-loadbalancer-show": {
+			{stdout: `{"id": "lb-id", "provisioning_status": "PENDING_UPDATE"}`},
+			{stdout: `{"id": "lb-id", "provisioning_status": "ACTIVE"}`},
+		},
+	}}
+	defer func(e batch.Executor) { executor = e }(executor)
+	executor = fake
+
+	cmdctx := NewCommandContext("lb1|lbaas-pool-create --loadbalancer lb1 --protocol HTTP --lb-algorithm ROUND_ROBIN")
+	if err := cmdctx.WaitForReady(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.argvs) != 2 {
+		t.Fatalf("expected the loadbalancer checked twice before ready, got %d runs", len(fake.argvs))
+	}
+	cmdctx.Execute(context.Background())
+	if cmdctx.ExitCode != 0 || cmdctx.ObjectID != "pool-id" || cmdctx.Duration < 10*time.Millisecond {
+		t.Fatalf("unexpected pool-create result: %+v", cmdctx)
+	}
+
+	cmdctx = NewCommandContext("lb1|lbaas-member-create --subnet s --address 10.0.0.1 --protocol-port 80 pool1")
+	cmdctx.Execute(context.Background())
+	if cmdctx.ExitCode != 1 || !strings.HasPrefix(cmdctx.Err, "Conflict") {
+		t.Fatalf("unexpected member-create result: %+v", cmdctx)
+	}
+
+	cmdctx = NewCommandContext("lb1|lbaas-healthmonitor-show hm1")
+	cmdctx.Execute(context.Background())
+	if cmdctx.ExitCode != 0 || cmdctx.ObjectID != "" {
+		t.Fatalf("unexpected result of malformed output: %+v", cmdctx)
+	}
+}
+
+func Test_ClassifyFailure(t *testing.T) {
+	for stderr, expected := range map[string]string{
+		"Unable to find loadbalancer with name or id 'lb1'":                                                     "NotFound",
+		"Invalid state PENDING_UPDATE of loadbalancer resource 1a2b\nNeutron server returns request_ids: [...]": "Conflict",
+		"The request you have made requires authentication. (HTTP 401)":                                         "Auth",
+		"Too Many Requests (HTTP 429)":                                                                          "RateLimited",
+		"Segmentation fault":                                                                                    "Unknown",
+	} {
+		if class := ClassifyFailure(stderr, ""); class != expected {
+			t.Fatalf("unexpected failure class of %q: %s", stderr, class)
+		}
+	}
+}
+
+func Test_APIExecutor(t *testing.T) {
+	var server *httptest.Server
+	requests := []string{}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.RequestURI()+" "+string(body))
+		w.Header().Set("X-Openstack-Request-Id", "req-1")
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v3/auth/tokens":
+			w.Header().Set("X-Subject-Token", "token")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token": {"catalog": [{"type": "network", "endpoints": [{"interface": "public", "url": "%s"}]}]}}`, server.URL)
+		case r.Header.Get("X-Auth-Token") != "token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2.0/lbaas/loadbalancers" && r.URL.Query().Get("name") == "lb1":
+			fmt.Fprint(w, `{"loadbalancers": [{"id": "lb-id"}]}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2.0/lbaas/listeners":
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"listener": {"id": "ls-id", "protocol_port": 80}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"NeutronError": {"message": "not found"}}`)
+		}
+	}))
+	defer server.Close()
+
+	for name, value := range map[string]string{"OS_AUTH_URL": server.URL, "OS_USERNAME": "admin", "OS_PASSWORD": "secret", "OS_PROJECT_NAME": "admin"} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	ae, err := NewAPIExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, _, exitCode, err := ae.Run(context.Background(), strings.Fields(
+		"neutron --debug lbaas-listener-create --loadbalancer lb1 --protocol HTTP --protocol-port 80 --format json"))
+	if err != nil || exitCode != 0 || !jsonEqual(out, `{"id": "ls-id", "protocol_port": 80}`) {
+		t.Fatalf("unexpected listener-create result: %s, %d, %v", out, exitCode, err)
+	}
+	if status, id := ae.LastResponse(); status != http.StatusCreated || id != "req-1" {
+		t.Fatalf("unexpected response: %d %s", status, id)
+	}
+	var body map[string]map[string]interface{}
+	json.Unmarshal([]byte(requests[len(requests)-1][len("POST /v2.0/lbaas/listeners "):]), &body)
+	expected := map[string]interface{}{"loadbalancer_id": "lb-id", "protocol": "HTTP", "protocol_port": float64(80)}
+	if !reflect.DeepEqual(body["listener"], expected) {
+		t.Fatalf("unexpected listener-create body: %v", body)
+	}
+
+	if _, _, exitCode, _ := ae.Run(context.Background(), strings.Fields("neutron lbaas-pool-show pool1")); exitCode != 1 {
+		t.Fatalf("expected exit code 1 of unknown pool, got %d", exitCode)
+	}
+	if _, _, exitCode, _ := ae.Run(context.Background(), strings.Fields("neutron lbaas-l7rule-create --type PATH policy1")); exitCode != 2 {
+		t.Fatalf("expected exit code 2 of unsupported command, got %d", exitCode)
+	}
+	// pools.UpdateOpts of gophercloud has no session_persistence.
+	if _, _, exitCode, _ := ae.Run(context.Background(), strings.Fields(
+		"neutron lbaas-pool-update --session-persistence type=SOURCE_IP 3b8d4c2e-5f1a-4e6b-9c7d-8a9b0c1d2e3f")); exitCode != 2 {
+		t.Fatalf("expected exit code 2 of unsupported field, got %d", exitCode)
+	}
+}
+
+func Test_APIExecutorTokenExpiry(t *testing.T) {
+	var server *httptest.Server
+	tokens, valid := 0, ""
+	bodies := []string{}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v3/auth/tokens":
+			tokens++
+			valid = fmt.Sprintf("token-%d", tokens)
+			w.Header().Set("X-Subject-Token", valid)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token": {"catalog": [{"type": "network", "endpoints": [{"interface": "public", "url": "%s"}]}]}}`, server.URL)
+		case r.Header.Get("X-Auth-Token") != valid:
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2.0/lbaas/pools" && r.URL.Query().Get("name") == "pool1":
+			fmt.Fprint(w, `{"pools": [{"id": "pool-id"}]}`)
+		case r.URL.Path == "/v2.0/lbaas/pools" && r.URL.Query().Get("marker") == "":
+			// the links come first, to be told apart from the objects.
+			fmt.Fprintf(w, `{"pools_links": [{"href": "%s/v2.0/lbaas/pools?marker=pool-id", "rel": "next"}], "pools": [{"id": "pool-id"}]}`, server.URL)
+		case r.URL.Path == "/v2.0/lbaas/pools":
+			fmt.Fprint(w, `{"pools": [{"id": "pool-id-2"}]}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2.0/lbaas/pools/pool-id":
+			bodies = append(bodies, string(body))
+			fmt.Fprint(w, `{"pool": {"id": "pool-id", "admin_state_up": true}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	for name, value := range map[string]string{"OS_AUTH_URL": server.URL, "OS_USERNAME": "admin", "OS_PASSWORD": "secret", "OS_PROJECT_NAME": "admin"} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	ae, err := NewAPIExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the token expires.
+	valid = "token-expired"
+
+	out, _, exitCode, err := ae.Run(context.Background(), strings.Fields("neutron lbaas-pool-update --admin-state-up True pool1"))
+	if err != nil || exitCode != 0 || !jsonEqual(out, `{"id": "pool-id", "admin_state_up": true}`) {
+		t.Fatalf("unexpected pool-update result: %s, %d, %v", out, exitCode, err)
+	}
+	if tokens != 2 || len(bodies) != 1 || bodies[0] != `{"pool":{"admin_state_up":true}}` {
+		t.Fatalf("unexpected authentications %d or bodies %v", tokens, bodies)
+	}
+	out, _, _, _ = ae.Run(context.Background(), strings.Fields("neutron lbaas-pool-list"))
+	if !jsonEqual(out, `[{"id": "pool-id"}, {"id": "pool-id-2"}]`) {
+		t.Fatalf("unexpected pool-list output: %s", out)
+	}
+}
+
+// jsonEqual compare the json documents regardless of their formatting.
+func jsonEqual(a string, b string) bool {
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func Test_AlreadyDone(t *testing.T) {
+	for _, c := range []struct {
+		cmdctx   *CommandContext
+		expected bool
+	}{
+		{&CommandContext{CommandContext: batch.CommandContext{OperationType: "create", Err: "Member with address 10.0.0.1 and protocol_port 80 already present in pool pool-id"}}, true},
+		{&CommandContext{CommandContext: batch.CommandContext{OperationType: "create", Err: "Load Balancer lb-id already has a listener with protocol_port of 80"}}, true},
+		{&CommandContext{CommandContext: batch.CommandContext{OperationType: "create", Err: "Invalid state PENDING_UPDATE of loadbalancer resource lb-id"}}, false},
+		{&CommandContext{CommandContext: batch.CommandContext{OperationType: "delete"}, FailureClass: "NotFound"}, true},
+		{&CommandContext{CommandContext: batch.CommandContext{OperationType: "update"}, FailureClass: "NotFound"}, false},
+	} {
+		if c.cmdctx.AlreadyDone() != c.expected {
+			t.Fatalf("unexpected already done of %s: %s", c.cmdctx.OperationType, c.cmdctx.Err)
+		}
+	}
+}
+
+func Test_NewSummary(t *testing.T) {
+	runMeta = &RunMetadata{StartedAt: time.Now().Add(-time.Second), FinishedAt: time.Now()}
+	summary := NewSummary([]*CommandContext{
+		{CommandContext: batch.CommandContext{Seq: 1, Command: "neutron lbaas-pool-show p1"}},
+		{CommandContext: batch.CommandContext{Seq: 2, Command: "neutron lbaas-pool-show p2", ExitCode: 1, Err: "Unable to find pool with name or id 'p2'"}},
+		{CommandContext: batch.CommandContext{Seq: 3, Command: "neutron lbaas-pool-update p3"}, CheckErr: "timeout"},
+	})
+	if summary.Total != 3 || summary.Succeeded != 1 || summary.Failed != 2 {
+		t.Fatalf("unexpected counts: %d %d %d", summary.Total, summary.Succeeded, summary.Failed)
+	}
+	if summary.Failures[1].Error != "timeout" || summary.DurationMs < 1000 {
+		t.Fatalf("unexpected summary: %v", summary)
+	}
+}
+
+func Test_ParseOutput(t *testing.T) {
+	cmdctx := &CommandContext{CommandContext: batch.CommandContext{RawOut: `{"id": "p1", "members": [{"id": "m1"}]}`}}
+	cmdctx.ParseOutput()
+	cmdctx.TruncateOutput(0)
+	if cmdctx.Parsed.(map[string]interface{})["id"] != "p1" || cmdctx.RawOut != "" || cmdctx.RawOutBytes != 39 {
+		t.Fatalf("unexpected parsed output: %v %q %d", cmdctx.Parsed, cmdctx.RawOut, cmdctx.RawOutBytes)
+	}
+
+	cmdctx = &CommandContext{CommandContext: batch.CommandContext{RawOut: `Deleted pool: p1`}}
+	cmdctx.ParseOutput()
+	cmdctx.TruncateOutput(0)
+	if cmdctx.Parsed != nil || cmdctx.ParseErr == "" || cmdctx.RawOut != "Deleted pool: p1" {
+		t.Fatalf("unexpected malformed output: %v %q", cmdctx.Parsed, cmdctx.ParseErr)
+	}
+}
+
+func Test_RunFailureHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hook.out")
+	onFailureHook = `echo "$BATCHOPS_SEQ $BATCHOPS_EXITCODE $BATCHOPS_COMMAND" > ` + out + `; exit 3`
+	defer func() { onFailureHook = "" }()
+	runMeta = &RunMetadata{RunID: "run1"}
+
+	RunFailureHook(&CommandContext{CommandContext: batch.CommandContext{Seq: 2, Command: "neutron lbaas-pool-show p2", ExitCode: 1}})
+	data, err := ioutil.ReadFile(out)
+	if err != nil || string(data) != "2 1 neutron lbaas-pool-show p2\n" {
+		t.Fatalf("unexpected hook output: %q %v", data, err)
+	}
+}
+
+func Test_Assert(t *testing.T) {
+	port, _ := ParseAssertion("protocol_port=80")
+	name, _ := ParseAssertion("loadbalancers.0.id=lb1")
+	admin := Assertion{regexp.MustCompile("lbaas-listener-show"), "admin_state_up", true}
+
+	cmdctx := &CommandContext{CommandContext: batch.CommandContext{Command: "neutron lbaas-listener-show ls1", RawOut: `{"protocol_port": 80, "admin_state_up": true, "loadbalancers": [{"id": "lb1"}]}`}}
+	cmdctx.Assert([]Assertion{port, name, admin})
+	if cmdctx.ExitCode != 0 {
+		t.Fatalf("unexpected assertion failure: %s", cmdctx.Err)
+	}
+
+	cmdctx = &CommandContext{CommandContext: batch.CommandContext{Command: "neutron lbaas-listener-show ls1", RawOut: `{"protocol_port": 8080}`}}
+	cmdctx.Assert([]Assertion{port, admin})
+	expected := "assertion failed: protocol_port: expected 80, got 8080; admin_state_up: expected true, got nothing"
+	if cmdctx.ExitCode != 1 || cmdctx.FailureClass != "Assertion" || cmdctx.Err != expected {
+		t.Fatalf("unexpected assertion result: %d %s", cmdctx.ExitCode, cmdctx.Err)
+	}
+
+	cmdctx = &CommandContext{CommandContext: batch.CommandContext{Command: "neutron lbaas-listener-delete ls1", RawOut: "Deleted listener: ls1"}}
+	cmdctx.Assert([]Assertion{port, admin})
+	if cmdctx.ExitCode != 0 {
+		t.Fatalf("unexpected assertion on non-json output: %s", cmdctx.Err)
+	}
+}
+
+func Test_Probe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	probeMode, probeLBPort, probeInterval = "tcp", ln.Addr().(*net.TCPAddr).Port, 0
+	defer func() { probeMode, probeLBPort, probeInterval = "", 0, time.Second }()
+
+	cmdctx := &CommandContext{CommandContext: batch.CommandContext{ResourceType: "loadbalancer", OperationType: "create", RawOut: `{"vip_address": "127.0.0.1"}`}}
+	cmdctx.RunProbe()
+	if !cmdctx.Probe.OK || cmdctx.Probe.Attempts != 1 {
+		t.Fatalf("unexpected probe result: %v", cmdctx.Probe)
+	}
+
+	ln.Close()
+	cmdctx.RunProbe()
+	if cmdctx.Probe.OK || cmdctx.Probe.Attempts != probeRetries+1 || cmdctx.ExitCode != 0 {
+		t.Fatalf("unexpected probe result of closed port: %v", cmdctx.Probe)
+	}
+}
+
+func Test_ReadinessObject(t *testing.T) {
+	if _, _, err := ParseReadinessStrategy("member=member"); err == nil {
+		t.Fatal("expected error of member polled")
+	}
+	resourceType, strategy, err := ParseReadinessStrategy("member=pool:db")
+	if err != nil || resourceType != "member" || strategy != (ReadinessStrategy{"pool", "db"}) {
+		t.Fatalf("unexpected strategy: %s %v %v", resourceType, strategy, err)
+	}
+
+	for _, c := range []struct {
+		command  string
+		object   string
+		expected string
+	}{
+		{"neutron lbaas-member-create --subnet s1 --address 10.0.0.1 --protocol-port 80 pool1", "pool", "pool1"},
+		{"neutron lbaas-member-update --weight 5 m1 pool1", "pool", "pool1"},
+		{"neutron lbaas-healthmonitor-create --type HTTP --pool pool1 --delay 5", "pool", "pool1"},
+		{"neutron lbaas-pool-update --name p2 pool1", "pool", "pool1"},
+		{"neutron lbaas-pool-create --listener ls1 --protocol HTTP --lb-algorithm ROUND_ROBIN", "listener", "ls1"},
+		{"neutron lbaas-pool-create --listener ls1 --protocol HTTP --lb-algorithm ROUND_ROBIN", "loadbalancer", "lb1"},
+	} {
+		cmdctx := NewCommandContext("lb1|" + strings.TrimPrefix(c.command, "neutron "))
+		if object, err := cmdctx.ReadinessObject(c.object); err != nil || object != c.expected {
+			t.Fatalf("unexpected %s of %s: %s %v", c.object, c.command, object, err)
+		}
+	}
+}
+
+func Test_BIGIPExists(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mgmt/tm/ltm/virtual/~Project_t1~Project_ls1":
+			fmt.Fprint(w, `{"name": "Project_ls1"}`)
+		case "/mgmt/tm/ltm/pool/~Project_t1~Project_p1/members":
+			fmt.Fprint(w, `{"items": [{"name": "10.0.0.1%1:80"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	bigipHost, bigipInsecure = strings.TrimPrefix(server.URL, "https://"), true
+	defer func() { bigipHost, bigipInsecure = "", false }()
+
+	for _, c := range []struct {
+		resourceType string
+		obj          map[string]interface{}
+		expected     bool
+	}{
+		{"listener", map[string]interface{}{"id": "ls1", "tenant_id": "t1"}, true},
+		{"listener", map[string]interface{}{"id": "ls2", "tenant_id": "t1"}, false},
+		{"member", map[string]interface{}{"id": "m1", "tenant_id": "t1", "address": "10.0.0.1", "protocol_port": 80.0}, true},
+		{"member", map[string]interface{}{"id": "m2", "tenant_id": "t1", "address": "10.0.0.1", "protocol_port": 8080.0}, false},
+	} {
+		exists, err := BIGIPExists(c.resourceType, c.obj, "p1")
+		if err != nil || exists != c.expected {
+			t.Fatalf("unexpected %s %v existence: %v %v", c.resourceType, c.obj["id"], exists, err)
+		}
+	}
+}
+
+func Test_AddressPort(t *testing.T) {
+	for s, expected := range map[string]string{
+		"/Project_t1/10.0.0.5%1:80": "10.0.0.5:80",
+		"10.0.0.1:8080":             "10.0.0.1:8080",
+		"10.0.0.1%2:443":            "10.0.0.1:443",
+	} {
+		if addressPort(s) != expected {
+			t.Fatalf("unexpected address and port of %s: %s", s, addressPort(s))
+		}
+	}
+}
+
+func Test_CommandEnv(t *testing.T) {
+	cmdctx := NewCommandContext("env:OS_PROJECT_NAME=projA,OS_PASSWORD=secret|projA-lb1|lbaas-pool-create --protocol HTTP")
+	if cmdctx.LoadBalancer != "projA-lb1" || cmdctx.Command != cmdPrefix+"lbaas-pool-create --protocol HTTP" {
+		t.Fatalf("unexpected command: %s %s", cmdctx.LoadBalancer, cmdctx.Command)
+	}
+	if !reflect.DeepEqual(cmdctx.Env, map[string]string{"OS_PROJECT_NAME": "projA", "OS_PASSWORD": "***"}) {
+		t.Fatalf("unexpected recorded env: %v", cmdctx.Env)
+	}
+
+	env := CommandEnvOf(batch.WithEnv(context.Background(), cmdctx.EnvOverrides))
+	found := 0
+	for _, n := range env {
+		if strings.HasPrefix(n, "OS_PROJECT_NAME=") {
+			found++
+			if n != "OS_PROJECT_NAME=projA" {
+				t.Fatalf("unexpected env: %s", n)
+			}
+		}
+	}
+	if found != 1 {
+		t.Fatalf("OS_PROJECT_NAME found %d times", found)
+	}
+
+	if _, _, err := SplitEnvAnnotation("env:OS_PROJECT_NAME|lb1|lbaas-pool-list"); err == nil {
+		t.Fatal("expected error of invalid annotation")
+	}
+}
+
+func Test_LBStatusFromCmdValueFormat(t *testing.T) {
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-loadbalancer-show": {{stdout: "ACTIVE\n"}},
+	}}
+	defer func(e batch.Executor) { executor = e }(executor)
+	executor = fake
+	neutronFormat = "table"
+	defer func() { neutronFormat = "json" }()
+
+	status, err := cliSource().ProvisioningStatus(context.Background(), "loadbalancer", "lb1")
+	if err != nil || status != "ACTIVE" {
+		t.Fatalf("unexpected status: %s %v", status, err)
+	}
+	argv := strings.Join(fake.argvs[0], " ")
+	if !strings.HasSuffix(argv, "lb1 --column provisioning_status --format value") {
+		t.Fatalf("unexpected command: %s", argv)
+	}
+}
+
+func Test_CloudArgs(t *testing.T) {
+	defer func(o StringsFlag, s string) { outputFilePaths, summaryFilePath = o, s }(outputFilePaths, summaryFilePath)
+	outputFilePaths = StringsFlag{"/dev/stdout", "rlt.json"}
+	summaryFilePath = "summary.json"
+
+	cloud := NewClouds([]string{"rc/staging.rc", "prod/staging.rc"})[1]
+	if cloud.Name != "staging2" {
+		t.Fatalf("unexpected cloud name: %s", cloud.Name)
+	}
+	args := cloud.CloudArgs([]string{"--openrc", "a.rc", "--openrc=b.rc", "--clouds-parallel", "--output-filepath", "/dev/stdout,rlt.json",
+		"--summary-filepath", "summary.json", "--loadbalancer", "lb1", "--", "loadbalancer-show", "lb1"}, "cmds")
+	expected := "--loadbalancer lb1 --output-filepath rlt-staging2.json --summary-filepath summary-staging2.json " +
+		"--openrc-path prod/staging.rc --cloud-name staging2 --commands-file cmds --yes"
+	if strings.Join(args, " ") != expected {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+func Test_ReadResultsFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"output.json": `{"metadata": {"run_id": "r1"}, "results": [{"seqnum": 1, "cloud": "staging"}]}`,
+		"legacy.json": `[{"seqnum": 1, "cloud": "staging"}]`,
+		"lines.jsonl": "{\"seqnum\": 1, \"cloud\": \"staging\"}\n\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		results, err := ReadResultsFile(path)
+		if err != nil || len(results) != 1 || results[0].Seq != 1 || results[0].Cloud != "staging" {
+			t.Fatalf("unexpected results of %s: %v %v", name, results, err)
+		}
+	}
+}
+
+func Test_ExecuteWithOwnFormat(t *testing.T) {
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-pool-show": {{stdout: `{"id": "pool-id"}`}, {stdout: `{"id": "pool-id"}`}},
+	}}
+	defer func(e batch.Executor) { executor = e }(executor)
+	executor = fake
+
+	NewCommandContext("lb1|lbaas-pool-show pool1 --format json").Execute(context.Background())
+	NewCommandContext("lb1|lbaas-pool-show pool1").Execute(context.Background())
+	if argv := strings.Join(fake.argvs[0], " "); strings.Count(argv, "--format") != 1 {
+		t.Fatalf("unexpected command: %s", argv)
+	}
+	if argv := strings.Join(fake.argvs[1], " "); !strings.HasSuffix(argv, "pool1 --format json") {
+		t.Fatalf("unexpected command: %s", argv)
+	}
+}
+
+func Test_AcquireLocks(t *testing.T) {
+	defer func(d string, w, ttl time.Duration) { lockDir, lockWait, lockTTL = d, w, ttl }(lockDir, lockWait, lockTTL)
+	lockDir = t.TempDir()
+	lockWait = 0
+	lockTTL = 24 * time.Hour
+
+	lbs := LockedLoadBalancers([]string{"lb1|lbaas-pool-list", "|lbaas-listener-create --loadbalancer lb/2", "lb1|lbaas-pool-show p1"})
+	if strings.Join(lbs, ",") != "lb/2,lb1" {
+		t.Fatalf("unexpected loadbalancers: %v", lbs)
+	}
+
+	hostname, _ := os.Hostname()
+	held, _ := json.Marshal(LockInfo{PID: os.Getppid(), Hostname: hostname, StartedAt: time.Now()})
+	if err := ioutil.WriteFile(LockPath("lb1"), held, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AcquireLocks(lbs); err == nil || !strings.Contains(err.Error(), "lb1 is locked") {
+		t.Fatalf("expected lb1 locked, got %v", err)
+	}
+	if _, err := os.Stat(LockPath("lb/2")); !os.IsNotExist(err) {
+		t.Fatalf("expected the lock of lb/2 released: %v", err)
+	}
+
+	stale, _ := json.Marshal(LockInfo{PID: os.Getpid(), Hostname: hostname, StartedAt: time.Now().Add(-48 * time.Hour)})
+	if err := ioutil.WriteFile(LockPath("lb1"), stale, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AcquireLocks(lbs); err != nil {
+		t.Fatal(err)
+	}
+	ReleaseLocks()
+	if files, _ := ioutil.ReadDir(lockDir); len(files) != 0 {
+		t.Fatalf("expected the locks released, got %d files", len(files))
+	}
+}
+
+func Test_NeutronTLS(t *testing.T) {
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-pool-show": {{stdout: `{"id": "pool-id"}`}},
+	}}
+	defer func(e batch.Executor) { executor = e }(executor)
+	executor = fake
+	defer func() { neutronInsecure, neutronCACert = false, "" }()
+
+	neutronInsecure = true
+	neutronCACert = filepath.Join(t.TempDir(), "ca.pem")
+	NewCommandContext("lb1|lbaas-pool-show pool1").Execute(context.Background())
+	if argv := strings.Join(fake.argvs[0], " "); !strings.HasPrefix(argv, "neutron --insecure --os-cacert "+neutronCACert+" --debug lbaas-pool-show") {
+		t.Fatalf("unexpected command: %s", argv)
+	}
+
+	if _, err := NeutronTLSConfig(); err == nil {
+		t.Fatal("expected error of missing cacert")
+	}
+	if err := ioutil.WriteFile(neutronCACert, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NeutronTLSConfig(); err == nil {
+		t.Fatal("expected error of invalid cacert")
+	}
+}
+
+func Test_StepCommand(t *testing.T) {
+	defer func(r *bufio.Reader, l []string) { stdinReader, cmdList = r, l }(stdinReader, cmdList)
+	cmdList = []string{"|lbaas-pool-list", "|lbaas-listener-list"}
+
+	stdinReader = bufio.NewReader(strings.NewReader("y\n"))
+	if ConfirmBatch() {
+		t.Fatal("expected only yes to confirm")
+	}
+	stdinReader = bufio.NewReader(strings.NewReader("yes\n"))
+	if !ConfirmBatch() {
+		t.Fatal("expected yes to confirm")
+	}
+
+	stdinReader = bufio.NewReader(strings.NewReader("x\nS\n\nq\n"))
+	cmdctx := NewCommandContext(cmdList[0])
+	for _, expected := range []string{"skip", "run", "quit", "quit"} {
+		if action := StepCommand(cmdctx); action != expected {
+			t.Fatalf("expected %s, got %s", expected, action)
+		}
+	}
+}
+
+func Test_CheckOperationPolicy(t *testing.T) {
+	defer func() { allowOperations, denyOperations = nil, nil }()
+	commands := []string{"lb1|lbaas-pool-create --loadbalancer lb1", "lb1|lbaas-pool-delete pool1"}
+	if err := CheckOperationPolicy(commands); err != nil {
+		t.Fatal(err)
+	}
+
+	allowOperations = StringsFlag{"create", "update"}
+	err := CheckOperationPolicy(commands)
+	if err == nil || !strings.Contains(err.Error(), "command 2 'neutron --debug lbaas-pool-delete pool1'") {
+		t.Fatalf("expected the delete not allowed, got %v", err)
+	}
+
+	allowOperations = nil
+	denyOperations = StringsFlag{"create"}
+	if err := CheckOperationPolicy(commands); err == nil || !strings.Contains(err.Error(), "command 1") {
+		t.Fatalf("expected the create denied, got %v", err)
+	}
+}
+
+func Test_SkipForParentFailure(t *testing.T) {
+	defer func() { failedLoadBalancers = map[string]int{} }()
+
+	failed := NewCommandContext("lb1|lbaas-loadbalancer-create --name lb1 subnet1")
+	failed.Seq, failed.ExitCode = 1, 1
+	failed.TrackParentFailure()
+	skipped := NewCommandContext("lb1|lbaas-listener-create --loadbalancer lb1 --protocol HTTP --protocol-port 80")
+	if !skipped.SkipForParentFailure() || skipped.ExitCode != -1 || skipped.SkipReason != "skipped-parent-failure" ||
+		skipped.Err != "skipped, loadbalancer lb1 failed in command 1" {
+		t.Fatalf("unexpected skipped result: %+v", skipped)
+	}
+	skipped.Seq = 2
+	skipped.TrackParentFailure()
+	if failedLoadBalancers["lb1"] != 1 {
+		t.Fatalf("expected the first failure kept, got %v", failedLoadBalancers)
+	}
+
+	if NewCommandContext("lb1|lbaas-loadbalancer-delete lb1").SkipForParentFailure() {
+		t.Fatal("expected the delete not skipped")
+	}
+	skipDeletesOnParentFailure = true
+	defer func() { skipDeletesOnParentFailure = false }()
+	if !NewCommandContext("lb1|lbaas-loadbalancer-delete lb1").SkipForParentFailure() {
+		t.Fatal("expected the delete skipped")
+	}
+	if NewCommandContext("lb2|lbaas-listener-create --loadbalancer lb2").SkipForParentFailure() {
+		t.Fatal("expected the command of another loadbalancer not skipped")
+	}
+}
+
+func Test_Refs(t *testing.T) {
+	for commandline, expected := range map[string]string{
+		"|lbaas-loadbalancer-create --name lb1 subnet1":                                        "subnet subnet1",
+		"lb1|lbaas-listener-create --loadbalancer lb1 --protocol HTTP --protocol-port 80":      "loadbalancer lb1",
+		"lb1|lbaas-member-create --subnet subnet1 --address 10.0.0.1 --protocol-port 80 pool1": "pool pool1,subnet subnet1",
+		"lb1|lbaas-member-update --weight 2 member1 pool1":                                     "member member1,pool pool1",
+		"lb1|lbaas-l7rule-create --type PATH --compare-type STARTS_WITH --value /a policy1":    "l7policy policy1",
+		"lb1|lbaas-pool-update --name pool2 pool1":                                             "pool pool1",
+		"lb1|lbaas-pool-list": "",
+	} {
+		refs := []string{}
+		for _, ref := range NewCommandContext(commandline).Refs() {
+			refs = append(refs, ref.String())
+		}
+		sort.Strings(refs)
+		if strings.Join(refs, ",") != expected {
+			t.Fatalf("unexpected refs of %s: %v", commandline, refs)
+		}
+	}
+}
+
+func Test_OrderByNeeds(t *testing.T) {
+	ordered, err := OrderByNeeds([]string{
+		"needs=lst|lb1|lbaas-l7policy-create --listener lst1 --action REJECT",
+		"label=lst|needs=3|lb1|lbaas-listener-create --loadbalancer lb1 --protocol HTTP --protocol-port 80",
+		"lb1|lbaas-loadbalancer-create --name lb1 subnet1",
+		"lb2|lbaas-loadbalancer-create --name lb2 subnet1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"label=#3|lb1|lbaas-loadbalancer-create --name lb1 subnet1",
+		"label=lst|needs=#3|lb1|lbaas-listener-create --loadbalancer lb1 --protocol HTTP --protocol-port 80",
+		"needs=lst|lb1|lbaas-l7policy-create --listener lst1 --action REJECT",
+		"lb2|lbaas-loadbalancer-create --name lb2 subnet1",
+	}
+	if strings.Join(ordered, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected order: %v", ordered)
+	}
+
+	defer func() { completedLabels = map[string]bool{} }()
+	lb := NewCommandContext(ordered[0])
+	lb.ExitCode = 1
+	lb.TrackCompletion()
+	listener := NewCommandContext(ordered[1])
+	if !listener.SkipForFailedNeeds() || listener.Err != "skipped, needed command #3 did not complete" {
+		t.Fatalf("unexpected listener result: %+v", listener)
+	}
+
+	_, err = OrderByNeeds([]string{"label=a|needs=c|lb1|lbaas-pool-list", "label=b|needs=a|lb1|lbaas-pool-list", "label=c|needs=b|lb1|lbaas-pool-list"})
+	if err == nil || err.Error() != "dependency cycle a -> c -> b -> a" {
+		t.Fatalf("expected dependency cycle, got %v", err)
+	}
+	if _, err = OrderByNeeds([]string{"needs=x|lb1|lbaas-pool-list"}); err == nil {
+		t.Fatal("expected unknown dependency")
+	}
+}
+
+func Test_ShuffleCommands(t *testing.T) {
+	defer func() { templatePositions = nil }()
+	commands := []string{"|lbaas-pool-show p1", "|lbaas-pool-show p2", "|lbaas-pool-show p1", "|lbaas-pool-show p3"}
+	templatePositions = TemplatePositions(commands)
+
+	shuffled := append([]string{}, commands...)
+	ShuffleCommands(shuffled, 42)
+	again := append([]string{}, commands...)
+	ShuffleCommands(again, 42)
+	if strings.Join(shuffled, ",") != strings.Join(again, ",") {
+		t.Fatalf("expected the same order of the same seed: %v %v", shuffled, again)
+	}
+
+	positions := []int{}
+	for _, n := range []string{"|lbaas-pool-show p1", "|lbaas-pool-show p3", "|lbaas-pool-show p1", "|lbaas-pool-show p1"} {
+		positions = append(positions, TemplatePosition(n))
+	}
+	if fmt.Sprint(positions) != "[1 4 3 0]" {
+		t.Fatalf("unexpected template positions: %v", positions)
+	}
+}
+
+func Test_ParseWaitOverride(t *testing.T) {
+	defer func() { waitOverrides = map[string]batch.WaitBudget{} }()
+	key, budget, err := ParseWaitOverride("member-update=30:500ms")
+	if err != nil || key != "member-update" || budget.Times != 30 || budget.Interval != 500*time.Millisecond {
+		t.Fatalf("unexpected override: %s %+v %v", key, budget, err)
+	}
+	waitOverrides[key] = budget
+	if b := NewCommandContext("lb1|lbaas-member-update --weight 2 m1 p1").WaitBudget(); b != budget {
+		t.Fatalf("unexpected budget: %+v", b)
+	}
+	if b := NewCommandContext("lb1|lbaas-member-create --subnet s --address 10.0.0.1 --protocol-port 80 p1").WaitBudget(); b.Times != maxCheckTimes || b.Interval != checkInterval {
+		t.Fatalf("unexpected default budget: %+v", b)
+	}
+
+	_, _, err = ParseWaitOverride("member-show=30")
+	if err == nil || !strings.Contains(err.Error(), "unknown key member-show, should be one of healthmonitor-create") {
+		t.Fatalf("expected unknown key, got %v", err)
+	}
+	if _, _, err = ParseWaitOverride("member-update=0"); err == nil {
+		t.Fatal("expected invalid times")
+	}
+}
+
+func Test_WaitForReadyCanceled(t *testing.T) {
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-loadbalancer-show": {{stdout: `{"id": "lb-id", "provisioning_status": "PENDING_UPDATE"}`}},
+	}}
+	defer func(e batch.Executor) { executor = e }(executor)
+	executor = fake
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	fs := time.Now()
+	err := NewCommandContext("lb1|lbaas-pool-create --loadbalancer lb1 --protocol HTTP --lb-algorithm ROUND_ROBIN").WaitForReady(ctx)
+	if err == nil || err.Error() != "Loadbalancer lb1 status check interrupted" {
+		t.Fatalf("expected the check interrupted, got %v", err)
+	}
+	if d := time.Since(fs); d >= checkInterval {
+		t.Fatalf("expected the check interrupted within one interval, took %s", d)
+	}
+}
+
+func Test_ThrottleObserve(t *testing.T) {
+	throttle := NewThrottle(0, 5*time.Second, time.Second, 2)
+	limited := &CommandContext{CommandContext: batch.CommandContext{ExitCode: 1}, FailureClass: "RateLimited"}
+	ok := &CommandContext{}
+
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		throttle.Observe(limited)
+		if throttle.Delay != expected {
+			t.Fatalf("expected delay %s after rate limited, got %s", expected, throttle.Delay)
+		}
+	}
+	throttle.Observe(&CommandContext{CommandContext: batch.CommandContext{ExitCode: 1}, FailureClass: "NotFound"})
+	throttle.Observe(ok)
+	if throttle.Delay != 5*time.Second {
+		t.Fatalf("expected no decrease before 2 successes, got %s", throttle.Delay)
+	}
+	throttle.Observe(ok)
+	if throttle.Delay != 4*time.Second {
+		t.Fatalf("expected delay 4s after 2 successes, got %s", throttle.Delay)
+	}
+	for i := 0; i < 10; i++ {
+		throttle.Observe(ok)
+	}
+	if throttle.Delay != 0 {
+		t.Fatalf("expected delay back to the base, got %s", throttle.Delay)
+	}
+}
+
+func Test_TrackFailures(t *testing.T) {
+	defer func() { maxFailures, maxConsecutiveFailures, failureCount, consecutiveFailures = 0, 0, 0, 0 }()
+	maxFailures, maxConsecutiveFailures = 5, 3
+	failed := &CommandContext{CommandContext: batch.CommandContext{ExitCode: 1}}
+	for _, n := range []*CommandContext{failed, failed, {}, failed, {CommandContext: batch.CommandContext{ExitCode: -1}, SkipReason: "skipped-dependency"}, {CheckErr: "ERROR"}} {
+		if reason := n.TrackFailures(); reason != "" {
+			t.Fatalf("unexpected abort: %s", reason)
+		}
+	}
+	if reason := failed.TrackFailures(); reason != "5 commands failed, reaching --max-failures 5" {
+		t.Fatalf("unexpected reason: %s", reason)
+	}
+
+	maxFailures, failureCount, consecutiveFailures = 0, 0, 0
+	failed.TrackFailures()
+	failed.TrackFailures()
+	if reason := failed.TrackFailures(); reason != "3 commands failed in a row, reaching --max-consecutive-failures 3" {
+		t.Fatalf("unexpected reason: %s", reason)
+	}
+}
+
+func Test_CheckStalePending(t *testing.T) {
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-loadbalancer-show": {
+			{stdout: `{"id": "lb1-id", "provisioning_status": "PENDING_UPDATE"}`},
+			{stdout: `{"id": "lb1-id", "provisioning_status": "PENDING_UPDATE"}`},
+			{stdout: `{"id": "lb2-id", "provisioning_status": "ACTIVE"}`},
+			{exitCode: 1, stderr: "Unable to find loadbalancer with name or id 'lb3'"},
+		},
+	}}
+	defer func(e batch.Executor) { executor = e }(executor)
+	executor = fake
+
+	if status, age, err := PendingAge("lb1"); err != nil || status != "PENDING_UPDATE" || age != 0 {
+		t.Fatalf("unexpected pending age: %s %s %v", status, age, err)
+	}
+	// the age is unknown without the database, only warned.
+	if err := CheckStalePending([]string{"lb1", "lb2", "lb3"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.argvs) != 4 {
+		t.Fatalf("expected 4 status checks, got %d", len(fake.argvs))
+	}
+}
+
+func Test_ReadCommandsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands")
+	_ = ioutil.WriteFile(path, []byte(strings.Join([]string{
+		"# the pools of lb1",
+		"lb1|lbaas-pool-create --protocol HTTP --name pool1",
+		"",
+		"neutron lbaas-pool-show pool1",
+	}, "\n")), 0644)
+	cmds, err := ReadCommandsFile(path, "lb2")
+	if err != nil || !reflect.DeepEqual(cmds, []string{"lb1|lbaas-pool-create --protocol HTTP --name pool1", "lb2|lbaas-pool-show pool1"}) {
+		t.Fatalf("unexpected commands: %v %v", cmds, err)
+	}
+
+	_ = ioutil.WriteFile(path, []byte("lb1|lbaas-pool-show pool1\n\nnet-show net1\n"), 0644)
+	if _, err := ReadCommandsFile(path, "lb1"); err == nil || err.Error() != "line 3: no lbaas-* subcommand in 'net-show net1'" {
+		t.Fatalf("unexpected error of the invalid line: %v", err)
+	}
+
+	if err := ValidateCommands([]string{"lb1|lbaas-pool-show pool1", "lb1|lbaas-pool"}); err == nil ||
+		err.Error() != "command 2: invalid subcommand lbaas-pool, should be lbaas-RESOURCE-OPERATION" {
+		t.Fatalf("unexpected error of the invalid command: %v", err)
+	}
+	if cmdctx := NewCommandContext("lb1|net-show net1"); cmdctx.ExitCode != -1 || cmdctx.Err == "" {
+		t.Fatalf("expected the invalid command not parsed: %+v", cmdctx)
+	}
+}
+
+func Test_TimestampsUnavailable(t *testing.T) {
+	for err, expected := range map[error]bool{
+		&mysqldriver.MySQLError{Number: 1054, Message: "Unknown column 'standardattributes.updated_at' in 'field list'"}:                               true,
+		&mysqldriver.MySQLError{Number: 1146, Message: "Table 'ovs_neutron.standardattributes' doesn't exist"}:                                         true,
+		fmt.Errorf("wrapped: %w", &mysqldriver.MySQLError{Number: 1146}):                                                                               true,
+		&mysqldriver.MySQLError{Number: 1045, Message: "Access denied"}:                                                                                false,
+		fmt.Errorf("sql: Scan error on column index 4, name \"updated_at\": unsupported Scan, storing driver.Value type []uint8 into type *time.Time"): false,
+	} {
+		if TimestampsUnavailable(err) != expected {
+			t.Fatalf("expected TimestampsUnavailable(%v) %v", err, expected)
+		}
+	}
+}
+
+func Test_IsPending(t *testing.T) {
+	defer func(states StringArray) { pendingStates, pendingStatesIgnoreCase = states, false }(pendingStates)
+	if !IsPending("PENDING_UPDATE") || IsPending("ACTIVE") || IsPending("pending_update") {
+		t.Fatal("unexpected default pending states")
+	}
+
+	states, err := ParsePendingStates(" BUILD, PENDING_UPDATE ,")
+	if err != nil || !reflect.DeepEqual(states, StringArray{"BUILD", "PENDING_UPDATE"}) {
+		t.Fatalf("unexpected states: %v %v", states, err)
+	}
+	pendingStates = states
+	if !IsPending("BUILD") || IsPending("build") || IsPending("PENDING_CREATE") {
+		t.Fatal("unexpected custom pending states")
+	}
+	pendingStatesIgnoreCase = true
+	if !IsPending("build") || !IsPending("Pending_Update") {
+		t.Fatal("expected case-insensitive match")
+	}
+	if _, err := ParsePendingStates(" , "); err == nil {
+		t.Fatal("expected no status error")
+	}
+}
+
+func Test_WaitForOperatingStatus(t *testing.T) {
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-member-show": {
+			{stdout: `{"id": "m1", "provisioning_status": "ACTIVE", "operating_status": "OFFLINE"}`},
+			{stdout: `{"id": "m1", "provisioning_status": "ACTIVE", "operating_status": "ONLINE"}`},
+			{stdout: `{"id": "m1", "provisioning_status": "ACTIVE", "operating_status": "ERROR"}`},
+		},
+	}}
+	defer func(e batch.Executor, interval time.Duration) {
+		executor, checkInterval, waitOperatingStatus = e, interval, ""
+	}(executor, checkInterval)
+	executor, checkInterval, waitOperatingStatus = fake, time.Millisecond, "ONLINE"
+
+	cmdctx := NewCommandContext("lb1|lbaas-member-create --subnet s --address 10.0.0.1 --protocol-port 80 p1")
+	cmdctx.ObjectID = "m1"
+	if err := cmdctx.WaitForOperatingStatus(context.Background()); err != nil || cmdctx.OperatingStatus != "ONLINE" {
+		t.Fatalf("expected ONLINE, got %s %v", cmdctx.OperatingStatus, err)
+	}
+	if argv := fake.argvs[0]; argv[len(argv)-4] != "m1" || argv[len(argv)-3] != "p1" {
+		t.Fatalf("unexpected show command: %v", argv)
+	}
+
+	cmdctx = NewCommandContext("lb1|lbaas-member-update --weight 2 m1 p1")
+	if err := cmdctx.WaitForOperatingStatus(context.Background()); err == nil || err.Error() != "member m1 operating status is ERROR" {
+		t.Fatalf("expected ERROR, got %v", err)
+	}
+	if err := NewCommandContext("lb1|lbaas-healthmonitor-create --delay 3 --max-retries 3 --timeout 3 --type HTTP --pool p1").WaitForOperatingStatus(context.Background()); err != nil {
+		t.Fatalf("expected no check of healthmonitor, got %v", err)
+	}
+}
+
+func Test_WriteArtifacts(t *testing.T) {
+	defer func(meta *RunMetadata) { runMeta, artifactsDir, runArtifactsDir, omitRawOutput = meta, "", "", false }(runMeta)
+	runMeta = &RunMetadata{RunID: "abc", StartedAt: time.Date(2020, 10, 25, 12, 35, 9, 0, time.Local)}
+	artifactsDir, omitRawOutput = t.TempDir(), true
+	if err := CreateRunArtifactsDir(); err != nil || runArtifactsDir != filepath.Join(artifactsDir, "20201025-123509-abc") {
+		t.Fatalf("unexpected run dir %s: %v", runArtifactsDir, err)
+	}
+
+	cmdctx := &CommandContext{CommandContext: batch.CommandContext{Seq: 7, Command: "neutron lbaas-pool-show p1", RawOut: `{"id": "p1"}`, Stderr: "GET call to network"}}
+	cmdctx.WriteArtifacts()
+	if cmdctx.Artifacts == nil || cmdctx.Artifacts.Stdout != filepath.Join(runArtifactsDir, "007-stdout.json") {
+		t.Fatalf("unexpected artifacts: %+v", cmdctx.Artifacts)
+	}
+	if out, _ := ioutil.ReadFile(cmdctx.Artifacts.Stdout); string(out) != `{"id": "p1"}` {
+		t.Fatalf("unexpected stdout artifact: %s", out)
+	}
+	if errout, _ := ioutil.ReadFile(cmdctx.Artifacts.Stderr); string(errout) != "GET call to network" {
+		t.Fatalf("unexpected stderr artifact: %s", errout)
+	}
+	if cmdctx.RawOut != "" || cmdctx.RawOutBytes != 12 {
+		t.Fatalf("expected the raw output omitted, got %q %d", cmdctx.RawOut, cmdctx.RawOutBytes)
+	}
+}
+
+func Test_OutputSchema(t *testing.T) {
+	cmdctx := &CommandContext{CommandContext: batch.CommandContext{Seq: 1, Command: "neutron lbaas-pool-show p1", Duration: time.Second}, Probe: &ProbeResult{Target: "10.0.0.1:80"}}
+	jd, _ := json.Marshal(cmdctx)
+	result := map[string]interface{}{}
+	_ = json.Unmarshal(jd, &result)
+
+	schema := OutputSchema("legacy")["items"].(map[string]interface{})
+	properties := schema["properties"].(map[string]interface{})
+	for k := range result {
+		if _, ok := properties[k]; !ok {
+			t.Fatalf("field %s is not in the schema", k)
+		}
+	}
+	for _, k := range schema["required"].([]string) {
+		if _, ok := result[k]; !ok {
+			t.Fatalf("required field %s is not in the result", k)
+		}
+	}
+	if properties["duration"].(map[string]interface{})["description"] != "milliseconds" {
+		t.Fatalf("unexpected duration schema: %v", properties["duration"])
+	}
+	if _, ok := OutputSchema("json")["properties"].(map[string]interface{})["metadata"]; !ok {
+		t.Fatal("expected the metadata in the json output schema")
+	}
+}
+
+func Test_AbbreviateCommand(t *testing.T) {
+	results := []*CommandContext{
+		{CommandContext: batch.CommandContext{Command: "neutron lbaas-member-create --subnet private-subnet --address 10.0.0.11 --protocol-port 80 --weight 5 --name member-with-a-long-name-1 pool-1"}},
+		{CommandContext: batch.CommandContext{Command: "neutron lbaas-member-create --subnet private-subnet --address 10.0.0.12 --protocol-port 80 --weight 5 --name member-with-a-long-name-2 pool-1"}},
+	}
+	distinguishing := DistinguishingArgs(results)
+	if !reflect.DeepEqual(distinguishing, map[string]bool{"10.0.0.11": true, "10.0.0.12": true, "member-with-a-long-name-1": true, "member-with-a-long-name-2": true}) {
+		t.Fatalf("unexpected distinguishing args: %v", distinguishing)
+	}
+	if short := AbbreviateCommand(results[0].Command, 100, distinguishing); short != "neutron lbaas-member-create … --address 10.0.0.11 … --name member-with-a-long-name-1 …" {
+		t.Fatalf("unexpected abbreviation: %s", short)
+	}
+	if short := AbbreviateCommand(results[0].Command, 40, distinguishing); short != "neutron lbaas-member-create … --address…" {
+		t.Fatalf("unexpected cut: %s", short)
+	}
+	if short := AbbreviateCommand("neutron lbaas-pool-show p1", 72, distinguishing); short != "neutron lbaas-pool-show p1" {
+		t.Fatalf("unexpected abbreviation of a short command: %s", short)
+	}
+
+	defer func() { reportSLA = 0 }()
+	reportSLA = time.Second
+	if ReportColor(&CommandContext{CommandContext: batch.CommandContext{Duration: 2 * time.Second}}) != colorYellow || ReportColor(&CommandContext{CommandContext: batch.CommandContext{ExitCode: 1}}) != colorRed ||
+		ReportColor(&CommandContext{CommandContext: batch.CommandContext{Duration: time.Millisecond}}) != colorGreen {
+		t.Fatal("unexpected report colors")
+	}
+}
+
+func Test_DBURIFromFlags(t *testing.T) {
+	reset := func() { dbUsername, dbPassword, dbPasswordFile, dbHost, dbPort, dbName = "", "", "", "", "", "" }
+	defer reset()
+	for _, n := range []string{"BATCHOPS_DB_USERNAME", "BATCHOPS_DB_PASSWORD", "BATCHOPS_DB_HOST", "BATCHOPS_DB_PORT", "BATCHOPS_DB_NAME"} {
+		defer os.Unsetenv(n)
+	}
+
+	if uri, err := DBURIFromFlags(); uri != "" || err != nil {
+		t.Fatalf("expected no uri, got %s %v", uri, err)
+	}
+	os.Setenv("BATCHOPS_DB_PORT", "3307")
+	if uri, err := DBURIFromFlags(); uri != "" || err != nil {
+		t.Fatalf("expected no uri of the port alone, got %s %v", uri, err)
+	}
+	for _, n := range dbFlags {
+		if flagEnvVars[strings.TrimPrefix(n.Name, "--")] != n.Env {
+			t.Fatalf("expected %s in --help-all as the environment variable of %s", n.Env, n.Name)
+		}
+	}
+	reset()
+	os.Unsetenv("BATCHOPS_DB_PORT")
+
+	os.Setenv("BATCHOPS_DB_USERNAME", "neutron")
+	os.Setenv("BATCHOPS_DB_HOST", "1.2.3.4")
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	_ = ioutil.WriteFile(passwordFile, []byte("p@ss:word\n"), 0600)
+	dbPasswordFile = passwordFile
+	if _, err := DBURIFromFlags(); err == nil || err.Error() != "missing --db-name(BATCHOPS_DB_NAME)" {
+		t.Fatalf("expected missing db name, got %v", err)
+	}
+
+	reset()
+	dbPasswordFile, dbName = passwordFile, "ovs_neutron"
+	uri, err := DBURIFromFlags()
+	if err != nil || uri != "neutron:p@ss:word@tcp(1.2.3.4:3306)/ovs_neutron?parseTime=true" {
+		t.Fatalf("unexpected uri %s: %v", uri, err)
+	}
+	if cfg, err := mysqldriver.ParseDSN(uri); err != nil || cfg.Passwd != "p@ss:word" || !cfg.ParseTime {
+		t.Fatalf("unexpected parsed uri: %+v %v", cfg, err)
+	}
+
+	reset()
+	os.Setenv("BATCHOPS_DB_PASSWORD", "secret")
+	dbPasswordFile, dbPassword = passwordFile, "secret"
+	if _, err := DBURIFromFlags(); err == nil {
+		t.Fatal("expected --db-password-file and --db-password exclusive")
+	}
+}
+
+func Test_WithParseTime(t *testing.T) {
+	for dsn, expected := range map[string]string{
+		"neutron:abd2aebadeff3e32@tcp(1.2.3.4:3306)/ovs_neutron":                 "neutron:abd2aebadeff3e32@tcp(1.2.3.4:3306)/ovs_neutron?parseTime=true",
+		"neutron:abd2aebadeff3e32@tcp(1.2.3.4:3306)/ovs_neutron?parseTime=true":  "neutron:abd2aebadeff3e32@tcp(1.2.3.4:3306)/ovs_neutron?parseTime=true",
+		"neutron:abd2aebadeff3e32@tcp(1.2.3.4:3306)/ovs_neutron?parseTime=false": "neutron:abd2aebadeff3e32@tcp(1.2.3.4:3306)/ovs_neutron?parseTime=true",
+	} {
+		uri, err := WithParseTime(dsn)
+		if err != nil || uri != expected {
+			t.Fatalf("unexpected uri of %s: %s %v", dsn, uri, err)
+		}
+		if cfg, err := mysqldriver.ParseDSN(uri); err != nil || !cfg.ParseTime {
+			t.Fatalf("expected parseTime of %s: %+v %v", uri, cfg, err)
+		}
+	}
+	if _, err := WithParseTime("neutron:secret@tcp(1.2.3.4:3306)/ovs_neutron?parseTime=maybe"); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("expected the invalid uri rejected with the password masked: %v", err)
+	}
+}
+
+func Test_MaskDSN(t *testing.T) {
+	for dsn, expected := range map[string]string{
+		"neutron:abd2aebadeff3e32@tcp(1.2.3.4:3306)/ovs_neutron":     "neutron:***@tcp(1.2.3.4:3306)/ovs_neutron",
+		"neutron:p@ss/w:ord@tcp(1.2.3.4:3306)/ovs_neutron?loc=Local": "neutron:***@tcp(1.2.3.4:3306)/ovs_neutron?loc=Local",
+		"neutron@tcp(1.2.3.4:3306)/ovs_neutron":                      "neutron@tcp(1.2.3.4:3306)/ovs_neutron",
+	} {
+		if masked := MaskDSN(dsn); masked != expected {
+			t.Fatalf("expected %s, got %s", expected, masked)
+		}
+	}
+
+	dsn := "neutron:p@ss/w:ord@tcp(1.2.3.4:3306)/ovs_neutron"
+	err := MaskDSNError(fmt.Errorf("failed to connect %s: access denied, password p@ss/w:ord", dsn), dsn)
+	if strings.Contains(err.Error(), "p@ss/w:ord") {
+		t.Fatalf("password leaked: %s", err.Error())
+	}
+	if args := RedactedArgs([]string{"batchops", "--results-db-dsn=" + dsn}); args[1] != "--results-db-dsn=neutron:***@tcp(1.2.3.4:3306)/ovs_neutron" {
+		t.Fatalf("unexpected redacted args: %v", args)
+	}
+}
+
+func Test_ParseHistogramBuckets(t *testing.T) {
+	names := func(buckets []LatencyBucket) []string {
+		ns := []string{}
+		for _, b := range buckets {
+			ns = append(ns, b.Name)
+		}
+		return ns
+	}
+	if ns := names(latencyBuckets); !reflect.DeepEqual(ns, []string{"0-100ms", "100-500ms", "500-1000ms", "1-5s", "5-10s", "10-30s", "30-60s", "60s+"}) {
+		t.Fatalf("unexpected default buckets: %v", ns)
+	}
+	buckets, err := ParseHistogramBuckets("1s,5s,10s,1500ms")
+	if err == nil {
+		t.Fatalf("expected decreasing bounds rejected, got %v", names(buckets))
+	}
+
+	defer func(buckets []LatencyBucket) { latencyBuckets = buckets }(latencyBuckets)
+	latencyBuckets, _ = ParseHistogramBuckets("2s,30s")
+	results := []*CommandContext{
+		{CommandContext: batch.CommandContext{ResourceType: "member", OperationType: "create", StartedAt: time.Now(), Duration: 2 * time.Second}},
+		{CommandContext: batch.CommandContext{ResourceType: "member", OperationType: "create", StartedAt: time.Now(), Duration: 40 * time.Second}},
+	}
+	expected := map[string]map[string]int{"member-create": {"0-2s": 0, "2-30s": 1, "30s+": 1}}
+	if counts := HistogramCounts(results); !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("unexpected histogram: %v", counts)
+	}
+
+	// the histogram output keeps the fixed buckets, in order.
+	defer func(path string) { histogramOutput, cmdResults = path, NewResultCollector() }(histogramOutput)
+	histogramOutput = filepath.Join(t.TempDir(), "histogram.json")
+	cmdResults = NewResultCollector()
+	cmdResults.AddBatch(results)
+	WriteHistogramOutput()
+	var hs []struct {
+		Buckets []BucketCount `json:"buckets"`
+	}
+	data, _ := ioutil.ReadFile(histogramOutput)
+	if err := json.Unmarshal(data, &hs); err != nil || len(hs) != 1 {
+		t.Fatalf("unexpected histogram output: %s %v", data, err)
+	}
+	expectedBuckets := []BucketCount{{"0-100ms", 100, 0}, {"100-500ms", 500, 0}, {"500-1000ms", 1000, 0}, {"1-5s", 5000, 1},
+		{"5-10s", 10000, 0}, {"10-30s", 30000, 0}, {"30-60s", 60000, 1}, {"60s+", 0, 0}}
+	if !reflect.DeepEqual(hs[0].Buckets, expectedBuckets) {
+		t.Fatalf("unexpected histogram output buckets: %+v", hs[0].Buckets)
+	}
+}
+
+func Test_LoadBalancerBreakdown(t *testing.T) {
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-loadbalancer-show": {
+			{stdout: `{"id": "lb1-id", "provisioning_status": "ACTIVE", "operating_status": "ONLINE"}`},
+			{exitCode: 1, stderr: "Unable to find loadbalancer with name or id 'lb2'"},
+		},
+	}}
+	defer func(e batch.Executor) { executor, finalLBStatuses = e, map[string][2]string{} }(executor)
+	executor = fake
+
+	results := []*CommandContext{
+		{CommandContext: batch.CommandContext{LoadBalancer: "lb1", Duration: 3 * time.Second, WaitDuration: time.Second}},
+		{CommandContext: batch.CommandContext{LoadBalancer: "lb2", Duration: time.Second}},
+		{CommandContext: batch.CommandContext{LoadBalancer: "lb1", Duration: 5 * time.Second, WaitDuration: 2 * time.Second}},
+		{CommandContext: batch.CommandContext{LoadBalancer: "lb2", Duration: time.Second, ExitCode: 1}},
+		{CommandContext: batch.CommandContext{Duration: time.Second}},
+	}
+	FetchFinalLBStatuses(results)
+	if len(fake.argvs) != 2 {
+		t.Fatalf("expected each loadbalancer shown once, got %d", len(fake.argvs))
+	}
+	stats := LoadBalancerBreakdown(results)
+	expected := []*LoadBalancerStats{
+		{LoadBalancer: "lb2", Commands: 2, Failures: 1, TotalDurationMs: 2000, AverageDurationMs: 1000, ProvisioningStatus: "NOT_FOUND"},
+		{LoadBalancer: "lb1", Commands: 2, TotalDurationMs: 8000, AverageDurationMs: 4000, ReadyWaitMs: 3000, ProvisioningStatus: "ACTIVE", OperatingStatus: "ONLINE"},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Fatalf("unexpected breakdown: %+v %+v", stats[0], stats[1])
+	}
+}
+
+func Test_SummarizeList(t *testing.T) {
+	defer func(columns []string) { summaryColumnList = columns }(summaryColumnList)
+	summaryColumnList = ParseSummaryColumns(" id, name,,listeners,provisioning_status ")
+	if !reflect.DeepEqual(summaryColumnList, []string{"id", "name", "listeners", "provisioning_status"}) {
+		t.Fatalf("unexpected columns: %v", summaryColumnList)
+	}
+
+	cmdctx := &CommandContext{CommandContext: batch.CommandContext{OperationType: "list", RawOut: `[
+		{"id": "lb1", "name": "lb-a", "provisioning_status": "ACTIVE"},
+		{"id": "lb2", "name": "", "provisioning_status": {"nested": 1}}
+	]`}}
+	cmdctx.SummarizeList()
+	expected := &ListSummary{
+		Columns: summaryColumnList,
+		Rows:    [][]string{{"lb1", "lb-a", "-", "ACTIVE"}, {"lb2", "-", "-", `{"nested":1}`}},
+		Missing: []string{"listeners"},
+	}
+	if !reflect.DeepEqual(cmdctx.ListSummary, expected) {
+		t.Fatalf("unexpected summary: %+v", cmdctx.ListSummary)
+	}
+
+	cmdctx = &CommandContext{CommandContext: batch.CommandContext{OperationType: "list", RawOut: `{"id": "lb1"}`}}
+	cmdctx.SummarizeList()
+	if cmdctx.ListSummary.Err == "" || len(cmdctx.ListSummary.Rows) != 0 {
+		t.Fatalf("expected not a json list, got %+v", cmdctx.ListSummary)
+	}
+}
+
+func Test_WaitDuration(t *testing.T) {
+	cmdctx := &CommandContext{CommandContext: batch.CommandContext{Seq: 1, Duration: 1500 * time.Millisecond, WaitDuration: 90 * time.Second}}
+	jd, _ := json.Marshal(cmdctx)
+	var fields map[string]interface{}
+	_ = json.Unmarshal(jd, &fields)
+	if fields["duration"] != float64(1500) || fields["wait_duration"] != float64(90000) {
+		t.Fatalf("expected durations in milliseconds, got %v %v", fields["duration"], fields["wait_duration"])
+	}
+	var read CommandContext
+	if err := json.Unmarshal(jd, &read); err != nil || read.WaitDuration != 90*time.Second {
+		t.Fatalf("unexpected wait duration read: %s %v", read.WaitDuration, err)
+	}
+
+	wait, execution := WaitTotals([]*CommandContext{cmdctx, {CommandContext: batch.CommandContext{Duration: 500 * time.Millisecond}}})
+	if wait != 90*time.Second || execution != 2*time.Second {
+		t.Fatalf("unexpected totals: %s %s", wait, execution)
+	}
+
+	var buf bytes.Buffer
+	defer logger.SetOutput(os.Stdout)
+	logger.SetOutput(&buf)
+	cmdctx.WarnLongWait()
+	if !strings.Contains(buf.String(), "Waited 1m30s for ready, 60.0 times the command duration 1.5s") {
+		t.Fatalf("expected long wait warned, got %q", buf.String())
+	}
+	buf.Reset()
+	cmdctx.WaitDuration = 10 * time.Second
+	cmdctx.WarnLongWait()
+	if buf.Len() != 0 {
+		t.Fatalf("expected no warning, got %q", buf.String())
+	}
+}
+
+func Test_ResultCollector(t *testing.T) {
+	rc := NewResultCollector()
+	var wg sync.WaitGroup
+	for i := 10; i > 0; i-- {
+		wg.Add(1)
+		go func(seq int) {
+			defer wg.Done()
+			rc.Add(&CommandContext{CommandContext: batch.CommandContext{Seq: seq}})
+		}(i)
+	}
+	wg.Wait()
+	rc.AddBatch([]*CommandContext{{CommandContext: batch.CommandContext{Seq: 2}, Cloud: "b"}, {CommandContext: batch.CommandContext{Seq: 1}, Cloud: "b"}})
+
+	seqs := []int{}
+	for _, n := range rc.Sorted() {
+		seqs = append(seqs, n.Seq)
+	}
+	if rc.Len() != 12 || !reflect.DeepEqual(seqs, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 1, 2}) {
+		t.Fatalf("unexpected sorted results: %v", seqs)
+	}
+}
+
+func Test_ExportImportScenario(t *testing.T) {
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-loadbalancer-show": {{stdout: `{"id": "lb-id", "name": "lb1", "vip_subnet_id": "subnet-id", "provider": "f5",
+			"listeners": [{"id": "listener-id"}], "pools": [{"id": "pool-id"}]}`}},
+		"lbaas-listener-show": {{stdout: `{"id": "listener-id", "name": "ls1", "protocol": "HTTP", "protocol_port": 80,
+			"admin_state_up": false, "l7policies": []}`}},
+		"lbaas-pool-show": {{stdout: `{"id": "pool-id", "name": "", "protocol": "HTTP", "lb_algorithm": "ROUND_ROBIN",
+			"listeners": [{"id": "listener-id"}], "healthmonitor_id": "hm-id"}`}},
+		"lbaas-member-list":        {{stdout: `[{"id": "member-id", "address": "10.0.0.1", "protocol_port": 80, "subnet_id": "subnet-id"}]`}},
+		"lbaas-healthmonitor-show": {{stdout: `{"id": "hm-id", "type": "HTTP", "delay": 5, "url_path": "/", "pools": [{"id": "pool-id"}]}`}},
+	}}
+	defer func(e batch.Executor) { executor = e }(executor)
+	executor = fake
+
+	sc, err := ExportLoadbalancer(context.Background(), "lb1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	jd, _ := json.Marshal(sc)
+	_ = ioutil.WriteFile(path, jd, 0644)
+
+	cmds, err := ImportScenario(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"lb1|lbaas-loadbalancer-create --name lb1 --provider f5 subnet-id",
+		"lb1|lbaas-listener-create --name ls1 --protocol HTTP --protocol-port 80 --admin-state-down --loadbalancer lb1",
+		"lb1|lbaas-pool-create --name pool-pool-id --protocol HTTP --lb-algorithm ROUND_ROBIN --listener ls1",
+		"lb1|lbaas-member-create --address 10.0.0.1 --protocol-port 80 --subnet subnet-id pool-pool-id",
+		"lb1|lbaas-healthmonitor-create --type HTTP --delay 5 --url-path / --pool pool-pool-id",
+	}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Fatalf("unexpected commands:\n%s", strings.Join(cmds, "\n"))
+	}
+
+	sc.Listeners[0]["description"] = "web frontend"
+	if _, err := sc.Commands(); err == nil || !strings.Contains(err.Error(), "whitespace in description") {
+		t.Fatalf("expected the description with space rejected, got %v", err)
+	}
+}
+
+func Test_SignalWhileFinishing(t *testing.T) {
+	defer atomic.StoreInt32(&finishing, 0)
+	atomic.StoreInt32(&finishing, 1)
+	go signalProcess()
+	chsig <- os.Interrupt
+	chsig <- os.Interrupt
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&draining) != 0 {
+		t.Fatal("expected the signals ignored once main is finishing the run")
+	}
+}
+
+func Test_HandleExistingRecreate(t *testing.T) {
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-member-list":       {{stdout: `[{"id": "member-id"}]`}},
+		"lbaas-member-delete":     {{stdout: "Deleted member: member-id"}},
+		"lbaas-loadbalancer-show": {{stdout: `{"id": "lb-id", "provisioning_status": "ACTIVE"}`}},
+	}}
+	defer func(e batch.Executor) { executor = e }(executor)
+	executor = fake
+
+	cmdctx := NewCommandContext("lb1|lbaas-member-create pool1 --name m1 --subnet s --address 10.0.0.1 --protocol-port 80")
+	if cmdctx.ParentArg() != "pool1" {
+		t.Fatalf("unexpected parent %s", cmdctx.ParentArg())
+	}
+	if cmdctx.HandleExisting(context.Background()) {
+		t.Fatalf("expected the member recreated, got %+v", cmdctx)
+	}
+	checked := 0
+	for _, argv := range fake.argvs {
+		if StringArray(argv).IndexOf("lbaas-member-list") != -1 || StringArray(argv).IndexOf("lbaas-member-delete") != -1 {
+			if StringArray(argv).IndexOf("pool1") == -1 || StringArray(argv).IndexOf("10.0.0.1") != -1 {
+				t.Fatalf("expected the existing member listed and deleted in pool1, got %q", argv)
+			}
+			checked++
+		}
+	}
+	if checked != 2 {
+		t.Fatalf("expected the member listed and deleted, got %q", fake.argvs)
+	}
+}
+
+func Test_FlagAliases(t *testing.T) {
+	var v bool
+	flag.BoolVar(&v, "test-alias-on", false, "")
+	flag.BoolVar(&v, "test-alias-yes", false, "")
+	aliases := FlagAliases()
+	if !reflect.DeepEqual(aliases["test-alias-on"], []string{"--test-alias-yes"}) ||
+		!reflect.DeepEqual(aliases["test-alias-yes"], []string{"--test-alias-on"}) {
+		t.Fatalf("unexpected aliases: %v", aliases)
+	}
+	if !reflect.DeepEqual(aliases["generate-only"], []string{"mode generate"}) {
+		t.Fatalf("unexpected mode alias: %v", aliases["generate-only"])
+	}
+}
+
+func Test_PositionalArgs(t *testing.T) {
+	for command, expected := range map[string][]string{
+		"neutron --debug lbaas-member-create --subnet s --address 10.0.0.1 pool1":     {"pool1"},
+		"neutron --debug lbaas-member-create pool1 --subnet s --address=10.0.0.1":     {"pool1"},
+		"neutron lbaas-member-update --weight 5 --admin-state-down member1 pool1":     {"member1", "pool1"},
+		"neutron lbaas-l7rule-create --invert policy1 --type PATH --value /api":       {"policy1"},
+		"neutron lbaas-listener-update listener1 --connection-limit=10 --name ls-new": {"listener1"},
+		"neutron lbaas-loadbalancer-list":                                             {},
+	} {
+		if args := PositionalArgs(command); !reflect.DeepEqual(args, expected) {
+			t.Fatalf("unexpected positional args of %q: %v", command, args)
+		}
+	}
+}
+
+func Test_CaptureDiff(t *testing.T) {
+	diff := DiffObjects(
+		map[string]interface{}{"name": "pool1", "lb_algorithm": "ROUND_ROBIN", "provisioning_status": "ACTIVE", "description": "old"},
+		map[string]interface{}{"name": "pool1", "lb_algorithm": "LEAST_CONNECTIONS", "provisioning_status": "PENDING_UPDATE",
+			"operating_status": "ONLINE", "session_persistence": map[string]interface{}{"type": "SOURCE_IP"}},
+	)
+	expected := map[string]FieldDiff{
+		"lb_algorithm":        {"ROUND_ROBIN", "LEAST_CONNECTIONS"},
+		"description":         {"old", nil},
+		"session_persistence": {nil, map[string]interface{}{"type": "SOURCE_IP"}},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("unexpected diff: %v", diff)
+	}
+
+	fake := &fakeExecutor{script: map[string][]fakeRun{
+		"lbaas-pool-show": {
+			{stdout: `{"id": "p1", "name": "pool1", "lb_algorithm": "ROUND_ROBIN", "provisioning_status": "ACTIVE"}`},
+			{stdout: `{"id": "p1", "name": "pool1", "lb_algorithm": "ROUND_ROBIN", "provisioning_status": "PENDING_UPDATE"}`},
+		},
+	}}
+	defer func(e batch.Executor) { executor = e }(executor)
+	executor = fake
+
+	cmdctx := NewCommandContext("lb1|lbaas-pool-update --lb-algorithm ROUND_ROBIN pool1")
+	cmdctx.CaptureBefore()
+	cmdctx.CaptureAfter()
+	if argv := fake.argvs[0]; StringArray(argv).IndexOf("pool1") == -1 || StringArray(argv).IndexOf("ROUND_ROBIN") != -1 {
+		t.Fatalf("expected pool1 shown, got %q", argv)
+	}
+	changed := NewCommandContext("lb1|lbaas-pool-update --lb-algorithm SOURCE_IP pool2")
+	changed.Before, changed.After = map[string]interface{}{"lb_algorithm": "ROUND_ROBIN"}, map[string]interface{}{"lb_algorithm": "SOURCE_IP"}
+	changed.Diff = DiffObjects(changed.Before, changed.After)
+	if noops := NoopUpdates([]*CommandContext{cmdctx, changed, {}}); len(noops) != 1 || noops[0] != cmdctx {
+		t.Fatalf("expected the status-only update in the no-op list, got %v", noops)
+	}
+}
+
+func Test_LBaaSV1(t *testing.T) {
+	defer func(schema status.Schema) { lbaasSchema = schema }(lbaasSchema)
+
+	if err := UseLBaaSAPIVersion("v3"); err == nil {
+		t.Fatalf("expected v3 rejected")
+	}
+	if columns := neutronColumns("member"); columns != "id, name, provisioning_status AS provisioning_status, project_id AS project_id" {
+		t.Fatalf("unexpected v2 columns: %s", columns)
+	}
+	if err := UseLBaaSAPIVersion("v1"); err != nil {
+		t.Fatalf("failed to use v1: %s", err.Error())
+	}
+	if columns := neutronColumns("vip"); columns != "id, name, status AS provisioning_status, tenant_id AS project_id" {
+		t.Fatalf("unexpected v1 columns: %s", columns)
+	}
+	if columns := neutronColumns("member"); columns != "id, '' AS name, status AS provisioning_status, tenant_id AS project_id" {
+		t.Fatalf("unexpected v1 member columns: %s", columns)
+	}
+	if lbaasSchema.LoadBalancerType != "pool" || lbaasSchema.Tables["vip"] != "vips" {
+		t.Fatalf("unexpected v1 object type %s or tables %v", lbaasSchema.LoadBalancerType, lbaasSchema.Tables)
+	}
+
+	for commandline, expected := range map[string][2]string{
+		"pool1|lb-pool-create --lb-method ROUND_ROBIN --protocol HTTP --subnet-id s1 --name pool1": {"pool", "create"},
+		"pool1|lb-vip-create --name vip1 --protocol-port 80 --protocol HTTP --subnet-id s1 pool1":  {"vip", "create"},
+		"pool1|lb-member-create --address 10.0.0.1 --protocol-port 80 pool1":                       {"member", "create"},
+		"pool1|lb-healthmonitor-associate hm1 pool1":                                               {"healthmonitor", "associate"},
+		"pool1|lb-pool-list": {"pool", "list"},
+	} {
+		cmdctx := NewCommandContext(commandline)
+		if cmdctx.ResourceType != expected[0] || cmdctx.OperationType != expected[1] || cmdctx.LoadBalancer != "pool1" {
+			t.Fatalf("unexpected parse of %s: %s %s %s", commandline, cmdctx.LoadBalancer, cmdctx.ResourceType, cmdctx.OperationType)
+		}
+	}
+}
+
+func Test_CommandListGraphviz(t *testing.T) {
+	cmds, err := OrderByNeeds([]string{
+		"needs=lb|lb1|lbaas-listener-create --name ls1 --protocol HTTP --protocol-port 80 --loadbalancer lb1",
+		"label=lb|lb1|lbaas-loadbalancer-create --name lb1 subnet1",
+		"needs=1,lb|lb1|lbaas-pool-create --name pool1 --listener ls1 --protocol HTTP --lb-algorithm ROUND_ROBIN",
+	})
+	if err != nil {
+		t.Fatalf("failed to order: %s", err.Error())
+	}
+	expected := `digraph commands {
+  1 [label="1: loadbalancer/create lb"];
+  2 [label="2: listener/create"];
+  3 [label="3: pool/create"];
+  1 -> 2;
+  2 -> 3;
+  1 -> 3;
+}
+`
+	if dot := CommandListGraphviz(cmds); dot != expected {
+		t.Fatalf("unexpected graph:\n%s", dot)
+	}
+}
+
+func Test_WriteRecordCount(t *testing.T) {
+	f, err := ioutil.TempFile("", "records-*.jsonl")
+	if err != nil {
+		t.Fatalf("failed to create output: %s", err.Error())
+	}
+	defer os.Remove(f.Name())
+	defer func(format string, exclude bool, sinks OutputSinks, written int32) {
+		outputFormat, excludeSuccessful, outputFile, recordsWritten = format, exclude, sinks, written
+	}(outputFormat, excludeSuccessful, outputFile, recordsWritten)
+	outputFormat, excludeSuccessful, outputFile, recordsWritten = "jsonl", true, OutputSinks{f}, 0
+
+	WriteRecord(&CommandContext{CommandContext: batch.CommandContext{Seq: 1, ExitCode: 0}})
+	WriteRecord(&CommandContext{CommandContext: batch.CommandContext{Seq: 2, ExitCode: 1}})
+	f.Close()
+	if recordsWritten != 1 {
+		t.Fatalf("expected 1 record written, counted %d", recordsWritten)
+	}
+	if data, _ := ioutil.ReadFile(f.Name()); strings.Count(string(data), "\n") != 1 {
+		t.Fatalf("expected 1 record in the file, got %s", data)
+	}
+}
+
+func Test_APILatencyPercentiles(t *testing.T) {
+	results := []*CommandContext{
+		{CommandContext: batch.CommandContext{ResourceType: "pool", OperationType: "create", StartedAt: time.Now(), Duration: 3 * time.Second, APILatencyMs: 400}},
+		{CommandContext: batch.CommandContext{ResourceType: "pool", OperationType: "create", StartedAt: time.Now(), Duration: 2 * time.Second, APILatencyMs: 200}},
+		{CommandContext: batch.CommandContext{ResourceType: "pool", OperationType: "show", StartedAt: time.Now(), Duration: 2 * time.Second}},
+	}
+	hs := LatencyHistograms(results, latencyBuckets)
+	if len(hs) != 2 || hs[0].APILatencyP50 != 200 || hs[0].APILatencyP95 != 400 || hs[1].APILatencyP50 != 0 {
+		t.Fatalf("unexpected api latency percentiles: %+v %+v", hs[0], hs[1])
+	}
+
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"f5-oslbaasv2-batchops/pkg/version"
+)
+
+// RunMetadata describes the run which produced the results.
+type RunMetadata struct {
+	RunID          string       `json:"run_id"`
+	StartedAt      time.Time    `json:"started_at"`
+	FinishedAt     time.Time    `json:"finished_at"`
+	CommandLine    string       `json:"command_line"`
+	Hostname       string       `json:"hostname"`
+	AuthURL        string       `json:"os_auth_url"`
+	ProjectName    string       `json:"os_project_name"`
+	NeutronVersion string       `json:"neutron_version"`
+	CommandCount   int          `json:"command_count"`
+	Build          version.Info `json:"build"`
+	ShuffleSeed    int64        `json:"shuffle_seed,omitempty"`
+	AbortReason    string       `json:"abort_reason,omitempty"`
+}
+
+// RunOutput is the output file content, unless --output-format legacy.
+type RunOutput struct {
+	Metadata *RunMetadata      `json:"metadata"`
+	Results  []*CommandContext `json:"results"`
+}
+
+var (
+	runMeta = &RunMetadata{}
+
+	// secretFlags have their values redacted from the command line.
+	secretFlags = map[string]bool{"--mysql-uri": true, "--results-db-dsn": true, "--audit-hmac-key": true, "--notify-token": true,
+		"--bigip-password": true, "--db-password": true}
+)
+
+// NewRunMetadata collect the metadata at the start of the run.
+func NewRunMetadata() *RunMetadata {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	hostname, _ := os.Hostname()
+	authURL, _ := LookupEnv("OS_AUTH_URL")
+	projectName, _ := LookupEnv("OS_PROJECT_NAME")
+
+	return &RunMetadata{
+		RunID:          hex.EncodeToString(id),
+		StartedAt:      time.Now(),
+		CommandLine:    strings.Join(RedactedArgs(os.Args), " "),
+		Hostname:       hostname,
+		AuthURL:        authURL,
+		ProjectName:    projectName,
+		NeutronVersion: NeutronVersion(),
+		CommandCount:   len(cmdList),
+		Build:          version.Get(),
+		ShuffleSeed:    shuffleSeed,
+	}
+}
+
+// NeutronVersion get the version of the neutron client.
+func NeutronVersion() string {
+	var out bytes.Buffer
+	c := exec.Command("neutron", "--version")
+	c.Stdout = &out
+	c.Stderr = &out
+	if err := c.Run(); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// RedactedArgs mask the secrets in the command line arguments.
+func RedactedArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i, n := range redacted {
+		name := "--" + strings.TrimLeft(strings.SplitN(n, "=", 2)[0], "-")
+		if !secretFlags[name] {
+			continue
+		}
+		if strings.Contains(n, "=") {
+			redacted[i] = strings.SplitN(n, "=", 2)[0] + "=" + redactValue(name, strings.SplitN(n, "=", 2)[1])
+		} else if i+1 < len(redacted) {
+			redacted[i+1] = redactValue(name, redacted[i+1])
+		}
+	}
+	return redacted
+}
+
+func redactValue(flag string, value string) string {
+	if flag == "--mysql-uri" || flag == "--results-db-dsn" {
+		return MaskDSN(value)
+	}
+	return "***"
+}
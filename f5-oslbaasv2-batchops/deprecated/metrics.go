@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+var (
+	metricsListen  string
+	pushgatewayURL string
+	metricsServer  *http.Server
+
+	// metrics the registry of the batch execution metrics.
+	metrics = NewMetricsRegistry()
+
+	// metricsBuckets upper bounds in seconds of the duration histograms.
+	metricsBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300}
+)
+
+// MetricsRegistry holds the batch execution metrics in a dedicated Prometheus registry,
+// without the go and process collectors of the default one.
+type MetricsRegistry struct {
+	Registry *prometheus.Registry
+
+	Commands      *prometheus.CounterVec
+	Duration      *prometheus.HistogramVec
+	ProvisionTime *prometheus.HistogramVec
+	InFlight      prometheus.Gauge
+}
+
+// NewMetricsRegistry create a registry with the batch execution metrics registered.
+func NewMetricsRegistry() *MetricsRegistry {
+	m := &MetricsRegistry{
+		Registry: prometheus.NewRegistry(),
+		Commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "batchops_commands_total",
+			Help: "The number of finished commands.",
+		}, []string{"resource", "operation", "status"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "batchops_command_duration_seconds",
+			Help:    "The neutron command execution time.",
+			Buckets: metricsBuckets,
+		}, []string{"resource", "operation"}),
+		ProvisionTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "batchops_command_provision_time_seconds",
+			Help:    "The time from command start until the object is checked done.",
+			Buckets: metricsBuckets,
+		}, []string{"resource", "operation"}),
+		InFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "batchops_commands_in_flight",
+			Help: "The number of commands being prepared or executed.",
+		}),
+	}
+	m.Registry.MustRegister(m.Commands, m.Duration, m.ProvisionTime, m.InFlight)
+	return m
+}
+
+// CommandStatus get the status label of the finished command: success, failed or skipped.
+func (cmdctx *CommandContext) CommandStatus() string {
+	switch {
+	case cmdctx.ExitCode == 0:
+		return "success"
+	case cmdctx.ExitCode == -1:
+		return "skipped"
+	default:
+		return "failed"
+	}
+}
+
+// ObserveCommand record the finished command in the metrics.
+func ObserveCommand(cmdctx *CommandContext) {
+	metrics.Commands.WithLabelValues(cmdctx.ResourceType, cmdctx.OperationType, cmdctx.CommandStatus()).Inc()
+	if cmdctx.StartedAt.IsZero() {
+		return
+	}
+	metrics.Duration.WithLabelValues(cmdctx.ResourceType, cmdctx.OperationType).Observe(cmdctx.Duration.Seconds())
+	if checkDone && cmdctx.ExitCode == 0 {
+		metrics.ProvisionTime.WithLabelValues(cmdctx.ResourceType, cmdctx.OperationType).
+			Observe(time.Since(cmdctx.StartedAt).Seconds())
+	}
+}
+
+// StartMetricsServer serve /metrics on --metrics-listen in background.
+func StartMetricsServer() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+	metricsServer = &http.Server{Addr: metricsListen, Handler: mux}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Printf("Metrics server on %s failed: %s", metricsListen, err.Error())
+		}
+	}()
+	logger.Printf("%20s: http://%s/metrics", "Metrics", metricsListen)
+}
+
+// StopMetrics push the metrics to --pushgateway-url and shut down the metrics server.
+func StopMetrics() {
+	if pushgatewayURL != "" {
+		if err := PushMetrics(); err != nil {
+			logger.Printf("Failed to push metrics to %s: %s", pushgatewayURL, err.Error())
+		}
+	}
+	if metricsServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = metricsServer.Shutdown(ctx)
+	}
+}
+
+// PushMetrics push the metrics to the pushgateway, replacing those of the same run id.
+func PushMetrics() error {
+	runID := ""
+	if runMeta != nil {
+		runID = runMeta.RunID
+	}
+	err := push.New(pushgatewayURL, "f5-oslbaasv2-batchops").
+		Gatherer(metrics.Registry).
+		Grouping("run_id", runID).
+		Push()
+	if err != nil {
+		return err
+	}
+	logger.Printf("%20s: %s", "Metrics Pushed", pushgatewayURL)
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+var (
+	notifyURL     string
+	notifyOn      = "all"
+	notifyToken   string
+	notifyTimeout = 10 * time.Second
+)
+
+// Notification is the run summary posted to --notify-url.
+type Notification struct {
+	RunID          string   `json:"run_id"`
+	Status         string   `json:"status"`
+	Commands       int      `json:"commands"`
+	Executed       int      `json:"executed"`
+	Succeeded      int      `json:"succeeded"`
+	Failed         int      `json:"failed"`
+	Skipped        int      `json:"skipped"`
+	DurationMs     int64    `json:"duration_ms"`
+	FailedCommands []string `json:"failed_commands"`
+	OutputFile     string   `json:"output_file"`
+	Hostname       string   `json:"hostname"`
+	Reason         string   `json:"reason,omitempty"`
+}
+
+// NewNotification summarize the results with the run status: completed or aborted.
+func NewNotification(status string) *Notification {
+	nt := &Notification{
+		RunID:          runMeta.RunID,
+		Status:         status,
+		Commands:       len(cmdList),
+		Executed:       cmdResults.Len(),
+		FailedCommands: []string{},
+		OutputFile:     outputFilePath,
+		Hostname:       runMeta.Hostname,
+		Reason:         runMeta.AbortReason,
+	}
+	if p, err := filepath.Abs(outputFilePath); err == nil {
+		nt.OutputFile = p
+	}
+	if !runMeta.StartedAt.IsZero() {
+		nt.DurationMs = time.Since(runMeta.StartedAt).Milliseconds()
+	}
+	for _, n := range cmdResults.Sorted() {
+		switch n.ExitCode {
+		case 0:
+			nt.Succeeded++
+		case -1:
+			nt.Skipped++
+		default:
+			nt.Failed++
+			nt.FailedCommands = append(nt.FailedCommands, n.Command)
+		}
+	}
+	return nt
+}
+
+// Notify post the run summary to --notify-url, retrying once.
+// Failures are only logged, they never change the exit code.
+func Notify(status string) {
+	if notifyURL == "" {
+		return
+	}
+	nt := NewNotification(status)
+	if notifyOn == "failure" && status == "completed" && nt.Failed == 0 {
+		return
+	}
+
+	jd, _ := json.Marshal(nt)
+	var err error
+	for i := 0; i < 2; i++ {
+		if err = postNotification(jd); err == nil {
+			logger.Printf("%20s: %s", "Notified", notifyURL)
+			return
+		}
+	}
+	logger.Printf("Failed to notify %s: %s", notifyURL, err.Error())
+}
+
+func postNotification(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, notifyURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if notifyToken != "" {
+		req.Header.Set("Authorization", "Bearer "+notifyToken)
+	}
+	client := http.Client{Timeout: notifyTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("responded %s", resp.Status)
+	}
+	return nil
+}
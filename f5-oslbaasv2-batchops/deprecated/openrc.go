@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+var (
+	openrcPath  string
+	openrcWatch bool
+
+	// openrcEnv the variables parsed from --openrc-path, merged into each command's environment.
+	openrcEnv      = map[string]string{}
+	openrcEnvMutex sync.RWMutex
+
+	// openrcRequired are the variables a re-parsed openrc file should not lose.
+	openrcRequired = []string{"OS_AUTH_URL", "OS_USERNAME", "OS_PASSWORD"}
+
+	// openrcSettle is the quiet time after the last change of the watched openrc file to re-parse it.
+	openrcSettle = 500 * time.Millisecond
+	// stopOpenRCWatch stop watching --openrc-path once the batch completes.
+	stopOpenRCWatch = func() {}
+)
+
+// ParseOpenRC parse the 'export NAME=value' lines of the openrc file.
+// Values are unquoted and $NAME references expanded; other shell lines are ignored.
+func ParseOpenRC(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	env := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || strings.ContainsAny(kv[0], " \t#") {
+			continue
+		}
+		v := kv[1]
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		env[kv[0]] = os.Expand(v, func(name string) string {
+			if ev, ok := env[name]; ok {
+				return ev
+			}
+			return os.Getenv(name)
+		})
+	}
+	return env, scanner.Err()
+}
+
+// LoadOpenRC parse --openrc-path into the environment of the commands. A re-parsed file missing the
+// openrcRequired variables of the current one, likely half written, is not loaded.
+func LoadOpenRC() error {
+	env, err := ParseOpenRC(openrcPath)
+	if err != nil {
+		return err
+	}
+	openrcEnvMutex.Lock()
+	for _, n := range openrcRequired {
+		if _, ok := env[n]; !ok {
+			if _, had := openrcEnv[n]; had {
+				openrcEnvMutex.Unlock()
+				return fmt.Errorf("%s is missing, keep the variables parsed before", n)
+			}
+		}
+	}
+	openrcEnv = env
+	openrcEnvMutex.Unlock()
+	logger.Printf("%20s: %s, %d variables", "OpenRC Parsed", openrcPath, len(env))
+	return nil
+}
+
+// LookupEnv get the variable from the openrc file, or from the process environment.
+func LookupEnv(name string) (string, bool) {
+	openrcEnvMutex.RLock()
+	defer openrcEnvMutex.RUnlock()
+	if v, ok := openrcEnv[name]; ok {
+		return v, true
+	}
+	return os.LookupEnv(name)
+}
+
+// CommandEnv get the process environment overridden by the openrc variables.
+func CommandEnv() []string {
+	openrcEnvMutex.RLock()
+	defer openrcEnvMutex.RUnlock()
+	env := []string{}
+	for _, n := range os.Environ() {
+		if _, ok := openrcEnv[strings.SplitN(n, "=", 2)[0]]; !ok {
+			env = append(env, n)
+		}
+	}
+	for k, v := range openrcEnv {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// WatchOpenRC re-parse --openrc-path in background once it is written or replaced, after the events settle
+// for openrcSettle, not in the middle of a write. The directory is watched, as the editors and the
+// credential rotations replace the file by renaming another one to it. Returns the function to stop watching.
+func WatchOpenRC() (func(), error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Clean(openrcPath)
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var settled <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) == path && ev.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					settled = time.After(openrcSettle)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logger.Printf("Failed to watch openrc file %s: %s", openrcPath, err.Error())
+			case <-settled:
+				settled = nil
+				if err := LoadOpenRC(); err != nil {
+					logger.Printf("Failed to re-parse openrc file %s: %s", openrcPath, err.Error())
+				}
+			}
+		}
+	}()
+	logger.Printf("%20s: %s", "OpenRC Watched", openrcPath)
+	return func() {
+		w.Close()
+		<-done
+	}, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"f5-oslbaasv2-batchops/pkg/batch"
+)
+
+var (
+	waitOperatingStatus string
+
+	// operatingObjects have operating_status, like ONLINE, OFFLINE or ERROR.
+	operatingObjects = map[string]bool{"loadbalancer": true, "listener": true, "pool": true, "member": true}
+)
+
+// operatingStatusArgs get the arguments to show the object created or updated by the command, like
+// 'MEMBER POOL' of lbaas-member-show.
+func (cmdctx *CommandContext) operatingStatusArgs() ([]string, error) {
+	args := PositionalArgs(cmdctx.Command)
+	if cmdctx.OperationType == "update" {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("no object in command")
+		}
+		return args, nil
+	}
+	if cmdctx.ObjectID == "" {
+		return nil, fmt.Errorf("no object id in the output")
+	}
+	if cmdctx.ResourceType == "member" {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("no pool in command")
+		}
+		return []string{cmdctx.ObjectID, args[len(args)-1]}, nil
+	}
+	return []string{cmdctx.ObjectID}, nil
+}
+
+// WaitForOperatingStatus poll the object created or updated until its operating_status is --wait-operating-status,
+// like members ONLINE after the health monitor probes, within the check budget. ERROR fails without waiting.
+func (cmdctx *CommandContext) WaitForOperatingStatus(ctx context.Context) error {
+	if !operatingObjects[cmdctx.ResourceType] || (cmdctx.OperationType != "create" && cmdctx.OperationType != "update") {
+		return nil
+	}
+	args, err := cmdctx.operatingStatusArgs()
+	if err != nil {
+		return fmt.Errorf("%s operating status not checked: %s", cmdctx.ResourceType, err.Error())
+	}
+
+	budget := cmdctx.WaitBudget()
+	for retries := budget.Times; retries > 0; retries-- {
+		var resp NeutronResponse
+		if err := runJSONCmd(ctx, fmt.Sprintf("%s%s-show", lbaasSchema.SubcommandPrefix, cmdctx.ResourceType), args, &resp); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("%s %s operating status check interrupted", cmdctx.ResourceType, args[0])
+			}
+			return err
+		}
+		cmdctx.OperatingStatus = resp.OperatingStatus
+		logInfo("Command(%d/%d): Object(%s) %s operating status is %s",
+			cmdctx.Seq, len(cmdList), cmdctx.ResourceType, args[0], resp.OperatingStatus)
+		if strings.EqualFold(resp.OperatingStatus, waitOperatingStatus) {
+			return nil
+		}
+		if resp.OperatingStatus == "ERROR" {
+			return fmt.Errorf("%s %s operating status is ERROR", cmdctx.ResourceType, args[0])
+		}
+		if err := batch.SleepContext(ctx, budget.Interval); err != nil {
+			return fmt.Errorf("%s %s operating status check interrupted", cmdctx.ResourceType, args[0])
+		}
+	}
+	return fmt.Errorf("%s %s operating status is still %s after %d times' check, expect %s",
+		cmdctx.ResourceType, args[0], cmdctx.OperatingStatus, budget.Times, waitOperatingStatus)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// dbSink is the --output-filepath value persisting the results into database, like --store-results.
+const dbSink = "db"
+
+// outputFilePaths the --output-filepath values, which can be repeated or comma separated.
+var outputFilePaths StringsFlag
+
+// StringsFlag is a flag which can be repeated or given as a comma separated list.
+type StringsFlag []string
+
+func (sf *StringsFlag) String() string {
+	return strings.Join(*sf, ",")
+}
+
+// Set append the comma separated values.
+func (sf *StringsFlag) Set(v string) error {
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			*sf = append(*sf, n)
+		}
+	}
+	return nil
+}
+
+// RepeatedFlag is a flag which can be repeated, its values are not split by commas.
+type RepeatedFlag []string
+
+func (rf *RepeatedFlag) String() string {
+	return strings.Join(*rf, " ")
+}
+
+// Set append the value.
+func (rf *RepeatedFlag) Set(v string) error {
+	*rf = append(*rf, v)
+	return nil
+}
+
+// OutputSinks writes the output to all the output files.
+type OutputSinks []*os.File
+
+// WriteString write s to each output file. Returns the length written to the first one,
+// and the first error.
+func (sinks OutputSinks) WriteString(s string) (int, error) {
+	var n int
+	var err error
+	for i, f := range sinks {
+		w, e := f.WriteString(s)
+		if i == 0 {
+			n = w
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return n, err
+}
+
+// Sync flush each output file; the error of pipes and ttys, which are not supported, is ignored.
+func (sinks OutputSinks) Sync() error {
+	for _, f := range sinks {
+		_ = f.Sync()
+	}
+	return nil
+}
+
+// Truncate empty the output files which are regular files, to rewrite the output from the start.
+// Returns the first error.
+func (sinks OutputSinks) Truncate() error {
+	var err error
+	for _, f := range sinks {
+		if fi, e := f.Stat(); e != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		if e := f.Truncate(0); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Close close each output file. Returns the first error.
+func (sinks OutputSinks) Close() error {
+	var err error
+	for _, f := range sinks {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// OpenOutputFiles open the output files of --output-filepath for appending. The first one is
+// taken as outputFilePath, for the checkpoint and notification.
+func OpenOutputFiles(paths []string) (OutputSinks, error) {
+	sinks := OutputSinks{}
+	for _, p := range paths {
+		if p == dbSink {
+			continue
+		}
+		of, e := os.OpenFile(p, os.O_CREATE|os.O_RDWR|os.O_APPEND, os.ModeAppend|os.ModePerm)
+		if e != nil {
+			sinks.Close()
+			return nil, e
+		}
+		sinks = append(sinks, of)
+		if outputFilePath == "" {
+			outputFilePath = p
+		}
+	}
+	return sinks, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+var (
+	parseOutput       bool
+	maxRawOutputBytes int
+)
+
+// ParseOutput embed the json output of the command as an object, which is kept in RawOut
+// with a parse error if malformed.
+func (cmdctx *CommandContext) ParseOutput() {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(cmdctx.RawOut), &parsed); err != nil {
+		cmdctx.ParseErr = err.Error()
+		return
+	}
+	cmdctx.Parsed = parsed
+}
+
+// TruncateOutput cut RawOut to max bytes, keeping its original length in RawOutBytes.
+// It is not truncated if the output is malformed and not parsed. Negative max means unlimited.
+func (cmdctx *CommandContext) TruncateOutput(max int) {
+	if max < 0 || len(cmdctx.RawOut) <= max || cmdctx.ParseErr != "" {
+		return
+	}
+	cmdctx.RawOutBytes = len(cmdctx.RawOut)
+	cmdctx.RawOut = cmdctx.RawOut[:max]
+}
@@ -0,0 +1,242 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeExecutor replies to the commands by subcommand, the last reply repeated.
+type fakeExecutor struct {
+	replies map[string][]fakeReply
+	argvs   [][]string
+}
+
+type fakeReply struct {
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+func (fe *fakeExecutor) Run(ctx context.Context, argv []string) (string, string, int, error) {
+	fe.argvs = append(fe.argvs, argv)
+	subcmd := ""
+	for _, n := range argv {
+		if strings.HasPrefix(n, "lbaas-") {
+			subcmd = n
+			break
+		}
+	}
+	replies := fe.replies[subcmd]
+	if len(replies) == 0 {
+		return "", "unknown command", 2, fmt.Errorf("exit status 2")
+	}
+	r := replies[0]
+	if len(replies) > 1 {
+		fe.replies[subcmd] = replies[1:]
+	}
+	if EnvOf(ctx)["OS_PROJECT_NAME"] != "" {
+		r.stdout = strings.Replace(r.stdout, "}", fmt.Sprintf(`, "project": %q}`, EnvOf(ctx)["OS_PROJECT_NAME"]), 1)
+	}
+	if r.exitCode != 0 {
+		return r.stdout, r.stderr, r.exitCode, fmt.Errorf("exit status %d", r.exitCode)
+	}
+	return r.stdout, r.stderr, 0, nil
+}
+
+// fakeSource replies to the status checks in order, the last status repeated.
+type fakeSource struct {
+	statuses []string
+	checked  []string
+}
+
+func (fs *fakeSource) ProvisioningStatus(ctx context.Context, objectType string, idOrName string) (string, error) {
+	fs.checked = append(fs.checked, objectType+" "+idOrName)
+	status := fs.statuses[0]
+	if len(fs.statuses) > 1 {
+		fs.statuses = fs.statuses[1:]
+	}
+	if status == "" {
+		return "", fmt.Errorf("%s %s not found", objectType, idOrName)
+	}
+	return status, nil
+}
+
+func Test_NewCommandContext(t *testing.T) {
+	opts := ParseOptions{Prefix: "neutron --debug ", SubcommandPrefix: "lbaas-"}
+	cmdctx, err := NewCommandContext("lb1|lbaas-member-create --subnet s --address 10.0.0.1 pool1", opts)
+	if err != nil || cmdctx.Command != "neutron --debug lbaas-member-create --subnet s --address 10.0.0.1 pool1" ||
+		cmdctx.LoadBalancer != "lb1" || cmdctx.ResourceType != "member" || cmdctx.OperationType != "create" {
+		t.Fatalf("unexpected command: %+v", cmdctx)
+	}
+	if cmdctx.ReadOnly() {
+		t.Fatal("expected member-create not read only")
+	}
+
+	cmdctx, err = NewCommandContext("pool1|lb-vip-list", ParseOptions{Prefix: "neutron ", SubcommandPrefix: "lb-"})
+	if err != nil || cmdctx.ResourceType != "vip" || cmdctx.OperationType != "list" || !cmdctx.ReadOnly() {
+		t.Fatalf("unexpected v1 command: %+v", cmdctx)
+	}
+
+	for commandline, expected := range map[string]string{
+		"lbaas-pool-create --protocol HTTP": "no '|' between the loadbalancer and the command in 'lbaas-pool-create --protocol HTTP'",
+		"lb1|net-show net1":                 "no lbaas-* subcommand in 'net-show net1'",
+		"lb1|lbaas-pool":                    "invalid subcommand lbaas-pool, should be lbaas-RESOURCE-OPERATION",
+	} {
+		if cmdctx, err := NewCommandContext(commandline, opts); err == nil || err.Error() != expected || cmdctx != nil {
+			t.Fatalf("unexpected error of %s: %v", commandline, err)
+		}
+	}
+}
+
+func Test_RunnerExecute(t *testing.T) {
+	fake := &fakeExecutor{replies: map[string][]fakeReply{
+		"lbaas-pool-create": {{stdout: `{"id": "pool-id"}`,
+			stderr: "DEBUG: keystoneauth.session POST call to network for http://10.0.0.1:9696/v2.0/lbaas/pools used request id req-9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b"}},
+		"lbaas-member-create": {{stdout: "partial", stderr: "Conflict", exitCode: 1}},
+	}}
+	runner := NewRunner(RunnerOptions{Executor: fake, Args: []string{"--insecure"}})
+
+	cmdctx, _ := NewCommandContext("lb1|lbaas-pool-create --protocol HTTP", ParseOptions{Prefix: "neutron ", SubcommandPrefix: "lbaas-"})
+	cmdctx.EnvOverrides = map[string]string{"OS_PROJECT_NAME": "projA"}
+	runner.Execute(context.Background(), cmdctx)
+	if argv := strings.Join(fake.argvs[0], " "); argv != "neutron --insecure lbaas-pool-create --protocol HTTP --format json" {
+		t.Fatalf("unexpected argv: %s", argv)
+	}
+	if cmdctx.ExitCode != 0 || cmdctx.ObjectID != "pool-id" || cmdctx.Err != "" || !strings.Contains(cmdctx.RawOut, "projA") {
+		t.Fatalf("unexpected pool-create result: %+v", cmdctx)
+	}
+	if len(cmdctx.CLIRequests) != 1 || !reflect.DeepEqual(cmdctx.RequestIDs, []string{"req-9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b"}) {
+		t.Fatalf("unexpected requests: %v %v", cmdctx.CLIRequests, cmdctx.RequestIDs)
+	}
+	if cmdctx.StartedAt.IsZero() || cmdctx.FinishedAt.Before(cmdctx.StartedAt) {
+		t.Fatalf("unexpected timing: %s %s", cmdctx.StartedAt, cmdctx.FinishedAt)
+	}
+
+	cmdctx = &CommandContext{Command: "neutron lbaas-member-create --format value pool1"}
+	runner.Execute(context.Background(), cmdctx)
+	if argv := strings.Join(fake.argvs[1], " "); strings.Count(argv, "--format") != 1 {
+		t.Fatalf("expected the command's own format kept: %s", argv)
+	}
+	if cmdctx.ExitCode != 1 || cmdctx.Err != "Conflictexit status 1" || cmdctx.RawOut != "" || cmdctx.Stdout != "partial" {
+		t.Fatalf("unexpected member-create result: %+v", cmdctx)
+	}
+}
+
+func Test_CheckerWaitForReady(t *testing.T) {
+	checker := NewChecker(CheckerOptions{Total: 1})
+	budget := WaitBudget{Times: 3, Interval: time.Millisecond}
+	cmdctx := &CommandContext{Seq: 1, ResourceType: "pool", OperationType: "create", LoadBalancer: "lb1"}
+
+	if checker.NeedsReady(&CommandContext{ResourceType: "loadbalancer", OperationType: "create"}) ||
+		checker.NeedsReady(&CommandContext{ResourceType: "pool", OperationType: "show"}) || !checker.NeedsReady(cmdctx) {
+		t.Fatal("unexpected commands needing ready")
+	}
+
+	source := &fakeSource{statuses: []string{"PENDING_UPDATE", "PENDING_UPDATE", "ACTIVE"}}
+	if err := checker.WaitForReady(context.Background(), cmdctx, source, "loadbalancer", "lb1", budget); err != nil {
+		t.Fatal(err)
+	}
+	if len(source.checked) != 3 || source.checked[0] != "loadbalancer lb1" || cmdctx.WaitDuration <= 0 {
+		t.Fatalf("unexpected checks: %v, waited %s", source.checked, cmdctx.WaitDuration)
+	}
+
+	source = &fakeSource{statuses: []string{"PENDING_UPDATE"}}
+	if err := checker.WaitForReady(context.Background(), cmdctx, source, "pool", "pool1", budget); err == nil ||
+		err.Error() != "Pool pool1 is still PENDING after 3 times' check" {
+		t.Fatalf("unexpected error of pending pool: %v", err)
+	}
+
+	failing := StatusSourceFunc(func(ctx context.Context, objectType string, idOrName string) (string, error) {
+		return "PENDING_UPDATE", fmt.Errorf("timed out")
+	})
+	if err := checker.WaitForReady(context.Background(), cmdctx, failing, "pool", "pool1", budget); err == nil ||
+		!strings.HasPrefix(err.Error(), "Pool pool1 status check fails for 3 times") {
+		t.Fatalf("unexpected error of failed checks: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	source = &fakeSource{statuses: []string{"PENDING_UPDATE"}}
+	if err := checker.WaitForReady(ctx, cmdctx, source, "loadbalancer", "lb1", budget); err == nil ||
+		!strings.HasSuffix(err.Error(), "interrupted") {
+		t.Fatalf("unexpected error of canceled check: %v", err)
+	}
+
+	checker = NewChecker(CheckerOptions{Pending: func(status string) bool { return status == "BUILD" }})
+	source = &fakeSource{statuses: []string{"BUILD", "PENDING_UPDATE"}}
+	if err := checker.WaitForReady(context.Background(), cmdctx, source, "loadbalancer", "lb1", budget); err != nil || len(source.checked) != 2 {
+		t.Fatalf("expected the custom pending status waited: %v %v", err, source.checked)
+	}
+}
+
+func Test_CheckerWaitForDone(t *testing.T) {
+	checker := NewChecker(CheckerOptions{})
+	budget := WaitBudget{Times: 3, Interval: time.Millisecond}
+	cmdctx := &CommandContext{ResourceType: "pool", OperationType: "create", LoadBalancer: "lb1", ObjectID: "pool-id"}
+
+	objects := &fakeSource{statuses: []string{"PENDING_CREATE", "ACTIVE"}}
+	lbs := &fakeSource{statuses: []string{"ACTIVE"}}
+	if done, err := checker.WaitForDone(context.Background(), cmdctx, objects, lbs, budget); !done || err != nil {
+		t.Fatalf("expected done: %v", err)
+	}
+	if !reflect.DeepEqual(objects.checked, []string{"pool pool-id", "pool pool-id"}) || !reflect.DeepEqual(lbs.checked, []string{"loadbalancer lb1"}) {
+		t.Fatalf("unexpected checks: %v %v", objects.checked, lbs.checked)
+	}
+
+	lbs = &fakeSource{statuses: []string{"ERROR"}}
+	if done, err := checker.WaitForDone(context.Background(), cmdctx, nil, lbs, budget); done || err == nil || err.Error() != "LB: lb1 is ERROR" {
+		t.Fatalf("unexpected result of ERROR loadbalancer: %v %v", done, err)
+	}
+
+	lbs = &fakeSource{statuses: []string{"PENDING_UPDATE"}}
+	if done, err := checker.WaitForDone(context.Background(), cmdctx, nil, lbs, budget); done || err == nil || err.Error() != "LB: lb1 left PENDING" {
+		t.Fatalf("unexpected result of pending loadbalancer: %v %v", done, err)
+	}
+
+	for _, n := range []*CommandContext{
+		{ResourceType: "pool", OperationType: "show", LoadBalancer: "lb1"},
+		{ResourceType: "pool", OperationType: "create"},
+		{ResourceType: "loadbalancer", OperationType: "delete", LoadBalancer: "lb1"},
+	} {
+		lbs = &fakeSource{statuses: []string{"PENDING_UPDATE"}}
+		if done, err := checker.WaitForDone(context.Background(), n, nil, lbs, budget); !done || err != nil || len(lbs.checked) != 0 {
+			t.Fatalf("expected %s-%s done without check: %v %v", n.ResourceType, n.OperationType, err, lbs.checked)
+		}
+	}
+}
+
+func Test_RequestIDsOf(t *testing.T) {
+	stderr := `DEBUG: keystoneauth.session POST call to identity for http://10.0.0.1:5000/v3/auth/tokens used request id req-0f6a3b5e-1c2d-4e5f-8a9b-0c1d2e3f4a5b
+DEBUG: keystoneauth.session GET call to network for http://10.0.0.1:9696/v2.0/lbaas/loadbalancers/lb1 used request id req-9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b
+DEBUG: neutronclient.v2_0.client Error message: {"NeutronError": {"message": "Invalid state PENDING_UPDATE", "type": "StateInvalid"}}
+DEBUG: neutronclient.v2_0.client RESP BODY: x-openstack-request-id: req-9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b`
+	expected := []string{"req-0f6a3b5e-1c2d-4e5f-8a9b-0c1d2e3f4a5b", "req-9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b"}
+	if ids := RequestIDsOf(stderr); !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("unexpected request ids: %v", ids)
+	}
+}
+
+func Test_APILatencyRecorder(t *testing.T) {
+	var r APILatencyRecorder
+	lines := []string{
+		"DEBUG: keystoneauth.session REQ: curl -g -i -X POST http://10.0.0.1:5000/v3/auth/tokens -H \"Content-Type: application/json\"\n",
+		"DEBUG: keystoneauth.session RESP: [201] Content-Type: application/json\n",
+		"DEBUG: keystoneauth.session REQ: curl -g -i -X POST http://10.0.0.1:9696/v2.0/lbaas/pools -H \"X-Auth-Token: {SHA1}abc\" -d '{\"pool\": {}}'\n",
+		"DEBUG: keystoneauth.session RESP: [201] Content-Type: application/json Content-Length: 520\n",
+	}
+	for i, n := range lines {
+		if i == 3 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		// written in pieces like the pipe does.
+		_, _ = r.Write([]byte(n[:10]))
+		_, _ = r.Write([]byte(n[10:]))
+	}
+	if r.Latency < 20*time.Millisecond || r.Latency > time.Second {
+		t.Fatalf("unexpected api latency %s", r.Latency)
+	}
+}
@@ -0,0 +1,115 @@
+// Package batch runs the neutron lbaas commands and checks the objects they change are ready,
+// before and after each command, by the status sources behind StatusSource.
+package batch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	cliTraceRegexp  = regexp.MustCompile(`\w+ call to .* used request id req-.*`)
+	requestIDRegexp = regexp.MustCompile(`req-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+)
+
+// CommandContext is a neutron command and its result.
+type CommandContext struct {
+	Seq           int           `json:"seqnum"`
+	Command       string        `json:"command"`
+	ObjectID      string        `json:"object_id"`
+	RawOut        string        `json:"output"`
+	Err           string        `json:"error"`
+	CLIRequests   []string      `json:"cli_requests"`
+	ExitCode      int           `json:"exitcode"`
+	Duration      time.Duration `json:"duration"`
+	WaitDuration  time.Duration `json:"wait_duration"`
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at"`
+	ResourceType  string        `json:"resource_type"`
+	OperationType string        `json:"operation_type"`
+	LoadBalancer  string        `json:"loadbalancer"`
+	RequestIDs    []string      `json:"request_ids"`
+	APILatencyMs  int64         `json:"api_latency_ms,omitempty"`
+
+	// Stdout of the command, in RawOut too if it succeeds.
+	Stdout string `json:"-"`
+	// Stderr of the command, in Err too if it fails.
+	Stderr string `json:"-"`
+	// Format of the output appended to the command, the runner's format if empty.
+	Format string `json:"-"`
+	// EnvOverrides of the command's environment, passed to the executor with WithEnv.
+	EnvOverrides map[string]string `json:"-"`
+}
+
+// ParseOptions of the command lines.
+type ParseOptions struct {
+	// Prefix is prepended to the subcommand, like "neutron --debug ".
+	Prefix string
+	// SubcommandPrefix starts the lbaas subcommands, lbaas- of v2 or lb- of v1.
+	SubcommandPrefix string
+}
+
+// NewCommandContext parse the LOADBALANCER|subcommand arguments command line. The resource and
+// operation type are taken from the subcommand, like pool and create of lbaas-pool-create.
+// Returns the error if the command line has no such subcommand.
+func NewCommandContext(commandline string, opts ParseOptions) (*CommandContext, error) {
+	lbAndCmd := strings.SplitN(commandline, "|", 2)
+	if len(lbAndCmd) != 2 {
+		return nil, fmt.Errorf("no '|' between the loadbalancer and the command in '%s'", commandline)
+	}
+
+	cmdctx := CommandContext{
+		Command:      fmt.Sprintf("%s%s", opts.Prefix, lbAndCmd[1]),
+		LoadBalancer: lbAndCmd[0],
+	}
+
+	subcmd := ""
+	for _, arg := range strings.Split(cmdctx.Command, " ") {
+		if strings.HasPrefix(arg, opts.SubcommandPrefix) {
+			subcmd = arg
+			break
+		}
+	}
+	if subcmd == "" {
+		return nil, fmt.Errorf("no %s* subcommand in '%s'", opts.SubcommandPrefix, lbAndCmd[1])
+	}
+	subs := strings.Split(subcmd, "-")
+	if len(subs) < 3 || subs[1] == "" || subs[2] == "" {
+		return nil, fmt.Errorf("invalid subcommand %s, should be %sRESOURCE-OPERATION", subcmd, opts.SubcommandPrefix)
+	}
+	cmdctx.ResourceType = subs[1]
+	cmdctx.OperationType = subs[2]
+
+	return &cmdctx, nil
+}
+
+// ReadOnly tells the command is a show or list, which needs no readiness check.
+func (cmdctx *CommandContext) ReadOnly() bool {
+	return cmdctx.OperationType == "show" || cmdctx.OperationType == "list"
+}
+
+// RequestIDsOf get the x-openstack-request-ids in the neutron --debug output, in order without duplicates.
+// There can be more than one, like the keystone authentication and the neutron call.
+func RequestIDsOf(stderr string) []string {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, n := range requestIDRegexp.FindAllString(stderr, -1) {
+		if !seen[n] {
+			seen[n] = true
+			ids = append(ids, n)
+		}
+	}
+	return ids
+}
+
+// HasFormatArg tell if the command gives its own --format or -f, which is not appended again.
+func HasFormatArg(command string) bool {
+	for _, n := range strings.Fields(command) {
+		if n == "--format" || n == "-f" || strings.HasPrefix(n, "--format=") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var (
+	// apiRequestRegexp matches the --debug log of an lbaas POST/PUT/DELETE request, not the keystone authentication.
+	apiRequestRegexp  = regexp.MustCompile(`REQ: curl .*-X (POST|PUT|DELETE) \S*/v2\.0/lb`)
+	apiResponseRegexp = regexp.MustCompile(`RESP: \[\d+\]`)
+)
+
+// Executor runs a command line, like the neutron client, and returns its outputs.
+// err is not nil if the command cannot start, exits non-zero or times out.
+type Executor interface {
+	Run(ctx context.Context, argv []string) (stdout, stderr string, exitCode int, err error)
+}
+
+// FirstByteTimer is implemented by the executors measuring when the last run wrote its first byte,
+// used by --neutron-command-profiling.
+type FirstByteTimer interface {
+	FirstByteAt() time.Time
+}
+
+// APILatencyTimer is implemented by the executors timing the lbaas POST/PUT/DELETE call of the last run,
+// apart from the client startup and the authentication.
+type APILatencyTimer interface {
+	APILatency() time.Duration
+}
+
+type envKey struct{}
+
+// WithEnv pass the environment overrides of the command to the executor.
+func WithEnv(ctx context.Context, env map[string]string) context.Context {
+	if len(env) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// EnvOf get the environment overrides in the context, nil if none.
+func EnvOf(ctx context.Context) map[string]string {
+	env, _ := ctx.Value(envKey{}).(map[string]string)
+	return env
+}
+
+// ExecOptions of the sub process executor.
+type ExecOptions struct {
+	// Env gets the environment of the command, with the overrides in the context.
+	// The environment of this process is inherited if nil.
+	Env func(ctx context.Context) []string
+	// Profiling records when the command writes its first byte.
+	Profiling bool
+}
+
+// ExecExecutor runs the command as a sub process.
+type ExecExecutor struct {
+	opts       ExecOptions
+	firstByte  time.Time
+	apiLatency time.Duration
+}
+
+// NewExecExecutor create the sub process executor.
+func NewExecExecutor(opts ExecOptions) *ExecExecutor {
+	return &ExecExecutor{opts: opts}
+}
+
+// Run the command with os/exec. The exit code is -1 if the command cannot start.
+func (ee *ExecExecutor) Run(ctx context.Context, argv []string) (string, string, int, error) {
+	var out, err bytes.Buffer
+	c := exec.CommandContext(ctx, argv[0], argv[1:]...)
+
+	if ee.opts.Env != nil {
+		c.Env = ee.opts.Env(ctx)
+	}
+	var apiLatency APILatencyRecorder
+	c.Stdout = &out
+	c.Stderr = io.MultiWriter(&err, &apiLatency)
+	var firstByte FirstByteRecorder
+	if ee.opts.Profiling {
+		c.Stdout = firstByte.Wrap(c.Stdout)
+		c.Stderr = firstByte.Wrap(c.Stderr)
+	}
+
+	e := c.Start()
+	if e == nil {
+		e = c.Wait()
+	}
+	ee.firstByte = firstByte.At
+	ee.apiLatency = apiLatency.Latency
+	return out.String(), err.String(), c.ProcessState.ExitCode(), e
+}
+
+// APILatency get the time of the lbaas call of the last run, parsed from the --debug output.
+func (ee *ExecExecutor) APILatency() time.Duration {
+	return ee.apiLatency
+}
+
+// FirstByteAt get the time the last run wrote its first byte to stdout or stderr.
+func (ee *ExecExecutor) FirstByteAt() time.Time {
+	return ee.firstByte
+}
+
+// FirstByteRecorder record the time the command writes its first byte to stdout or stderr.
+type FirstByteRecorder struct {
+	once sync.Once
+	At   time.Time
+}
+
+// Wrap get a writer to w which records the first write.
+func (r *FirstByteRecorder) Wrap(w io.Writer) io.Writer {
+	return &firstByteWriter{r, w}
+}
+
+type firstByteWriter struct {
+	recorder *FirstByteRecorder
+	w        io.Writer
+}
+
+func (fw *firstByteWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		fw.recorder.once.Do(func() { fw.recorder.At = time.Now() })
+	}
+	return fw.w.Write(p)
+}
+
+// APILatencyRecorder time the lbaas POST/PUT/DELETE request in the neutron --debug output written to it,
+// from the request logged to its response logged. The last request is timed if there are more.
+type APILatencyRecorder struct {
+	mu        sync.Mutex
+	line      []byte
+	requestAt time.Time
+	Latency   time.Duration
+}
+
+// Write check the complete lines written, the partial last line is kept for the next write.
+func (r *APILatencyRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.line = append(r.line, p...)
+	for {
+		i := bytes.IndexByte(r.line, '\n')
+		if i < 0 {
+			break
+		}
+		line := r.line[:i]
+		r.line = r.line[i+1:]
+		switch {
+		case apiRequestRegexp.Match(line):
+			r.requestAt = now
+		case !r.requestAt.IsZero() && apiResponseRegexp.Match(line):
+			r.Latency = now.Sub(r.requestAt)
+			r.requestAt = time.Time{}
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,187 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StatusSource gets the provisioning status of an lbaas object by its id or name.
+type StatusSource interface {
+	ProvisioningStatus(ctx context.Context, objectType string, idOrName string) (string, error)
+}
+
+// StatusSourceFunc is a function as the StatusSource.
+type StatusSourceFunc func(ctx context.Context, objectType string, idOrName string) (string, error)
+
+// ProvisioningStatus call f.
+func (f StatusSourceFunc) ProvisioningStatus(ctx context.Context, objectType string, idOrName string) (string, error) {
+	return f(ctx, objectType, idOrName)
+}
+
+// WaitBudget is the max times to check the status and the interval between the checks.
+type WaitBudget struct {
+	Times    int
+	Interval time.Duration
+}
+
+// CheckerOptions of the readiness checks.
+type CheckerOptions struct {
+	// LoadBalancerType is the object locking the tree: loadbalancer of v2, pool of v1.
+	LoadBalancerType string
+	// Pending tells the status is transitional, to keep waiting. The PENDING_* statuses if nil.
+	Pending func(status string) bool
+	// Total is the number of commands of the batch, in the log prefix.
+	Total  int
+	Logger Logger
+}
+
+// Checker waits for the objects changed by the commands to be ready.
+type Checker struct {
+	opts CheckerOptions
+}
+
+// NewChecker create the readiness checker, the options not given are defaulted.
+func NewChecker(opts CheckerOptions) *Checker {
+	if opts.LoadBalancerType == "" {
+		opts.LoadBalancerType = "loadbalancer"
+	}
+	if opts.Pending == nil {
+		opts.Pending = func(status string) bool { return strings.HasPrefix(status, "PENDING_") }
+	}
+	if opts.Logger == nil {
+		opts.Logger = NopLogger{}
+	}
+	return &Checker{opts}
+}
+
+func (c *Checker) logPrefix(cmdctx *CommandContext) string {
+	return fmt.Sprintf("Command(%d/%d):", cmdctx.Seq, c.opts.Total)
+}
+
+// NeedsReady tells the command waits for the object to be ready before running: the show, list
+// and loadbalancer create commands do not.
+func (c *Checker) NeedsReady(cmdctx *CommandContext) bool {
+	return !cmdctx.ReadOnly() && !(cmdctx.ResourceType == c.opts.LoadBalancerType && cmdctx.OperationType == "create")
+}
+
+// WaitForReady check the object by the source until it is not pending, within the budget.
+// The time waiting is added to the WaitDuration of the command.
+func (c *Checker) WaitForReady(ctx context.Context, cmdctx *CommandContext, source StatusSource,
+	objectType string, object string, budget WaitBudget) error {
+	defer func(fs time.Time) { cmdctx.WaitDuration += time.Since(fs) }(time.Now())
+
+	logPrefix := c.logPrefix(cmdctx)
+	c.opts.Logger.Infof("%s Confirm %s %s is not pending", logPrefix, objectType, object)
+
+	maxErrTries := 3
+	errTried := 0
+	for retries := budget.Times; retries > 0; retries-- {
+		status, err := source.ProvisioningStatus(ctx, objectType, object)
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s %s status check interrupted", strings.Title(objectType), object)
+		}
+
+		if err != nil {
+			c.opts.Logger.Warnf("%s Checking %s(%s) status failed: %s", logPrefix, objectType, object, err.Error())
+			errTried++
+			if errTried >= maxErrTries {
+				return fmt.Errorf("%s %s status check fails for %d times, last failure: %s",
+					strings.Title(objectType), object, maxErrTries, err.Error())
+			}
+		} else {
+			errTried = 0
+		}
+
+		c.opts.Logger.Infof("%s Checked %s %s status %s", logPrefix, objectType, object, status)
+
+		if !c.opts.Pending(status) {
+			return nil
+		}
+		if err := SleepContext(ctx, budget.Interval); err != nil {
+			return fmt.Errorf("%s %s status check interrupted", strings.Title(objectType), object)
+		}
+	}
+
+	return fmt.Errorf("%s %s is still PENDING after %d times' check", strings.Title(objectType), object, budget.Times)
+}
+
+// WaitForDone check the object created, updated or deleted by the command, by objects if given and the
+// object id is known, then its loadbalancer by lbs, until they are not pending, within the budget.
+// Returns false if either is ERROR or left pending.
+func (c *Checker) WaitForDone(ctx context.Context, cmdctx *CommandContext, objects StatusSource,
+	lbs StatusSource, budget WaitBudget) (bool, error) {
+	logPrefix := c.logPrefix(cmdctx)
+	fs := time.Now()
+	defer func() {
+		c.opts.Logger.Infof("%s Checked time: %d ms", logPrefix, time.Since(fs).Milliseconds())
+	}()
+
+	if cmdctx.OperationType != "create" && cmdctx.OperationType != "update" && cmdctx.OperationType != "delete" {
+		return true, nil
+	}
+	if cmdctx.LoadBalancer == "" {
+		c.opts.Logger.Infof("%s No loadbalancer appointed, no check to do.", logPrefix)
+		return true, nil
+	}
+	if cmdctx.ResourceType == c.opts.LoadBalancerType && cmdctx.OperationType == "delete" {
+		c.opts.Logger.Infof("%s Loadbalancer deleted, no check to do.", logPrefix)
+		return true, nil
+	}
+
+	c.opts.Logger.Infof("%s Check loadbalancer %s status", logPrefix, cmdctx.LoadBalancer)
+	for maxTries := budget.Times; maxTries > 0; maxTries-- {
+		// Check created object's status
+		if objects != nil && cmdctx.ObjectID != "" {
+			status, err := objects.ProvisioningStatus(ctx, cmdctx.ResourceType, cmdctx.ObjectID)
+			if err != nil {
+				c.opts.Logger.Printf("%s Failed to fetch object %s status: %s", logPrefix, cmdctx.ObjectID, err.Error())
+				break
+			}
+			c.opts.Logger.Infof("%s Object(%s) %s staus is %s", logPrefix, cmdctx.ResourceType, cmdctx.ObjectID, status)
+			if c.opts.Pending(status) {
+				if err := SleepContext(ctx, budget.Interval); err != nil {
+					return false, fmt.Errorf("%s %s status check interrupted", cmdctx.ResourceType, cmdctx.ObjectID)
+				}
+				continue
+			}
+			if status == "ERROR" {
+				return false, fmt.Errorf("%s %s is ERROR", cmdctx.ResourceType, cmdctx.ObjectID)
+			}
+		}
+
+		// Check belonged loadbalancer's status
+		status, err := lbs.ProvisioningStatus(ctx, c.opts.LoadBalancerType, cmdctx.LoadBalancer)
+		if ctx.Err() != nil {
+			return false, fmt.Errorf("LB: %s status check interrupted", cmdctx.LoadBalancer)
+		}
+		if err != nil {
+			c.opts.Logger.Printf("%s Checked loadbalancer %s Failed: %s", logPrefix, cmdctx.LoadBalancer, err.Error())
+			break
+		}
+
+		c.opts.Logger.Infof("%s Loadbalancer %s staus is %s", logPrefix, cmdctx.LoadBalancer, status)
+		switch {
+		case c.opts.Pending(status):
+			if err := SleepContext(ctx, budget.Interval); err != nil {
+				return false, fmt.Errorf("LB: %s status check interrupted", cmdctx.LoadBalancer)
+			}
+		case status == "ERROR":
+			return false, fmt.Errorf("LB: %s is ERROR", cmdctx.LoadBalancer)
+		default:
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("LB: %s left PENDING", cmdctx.LoadBalancer)
+}
+
+// SleepContext sleep for d, or until the context is canceled. Returns the error of the canceled context.
+func SleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Logger logs the progress of the runs and checks by level.
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Warnf(format string, v ...interface{})
+	// Printf logs the failures regardless of the level.
+	Printf(format string, v ...interface{})
+}
+
+// NopLogger logs nothing, the default of the options.
+type NopLogger struct{}
+
+func (NopLogger) Debugf(format string, v ...interface{}) {}
+func (NopLogger) Infof(format string, v ...interface{})  {}
+func (NopLogger) Warnf(format string, v ...interface{})  {}
+func (NopLogger) Printf(format string, v ...interface{}) {}
+
+// RunnerOptions of the command runner.
+type RunnerOptions struct {
+	Executor Executor
+	// Format is appended as --format to the commands without their own, json if empty, none to append nothing.
+	Format string
+	// Args are inserted after the program, like the TLS options of the neutron client.
+	Args []string
+	// Timeout of a command, 30 minutes if 0.
+	Timeout time.Duration
+	Logger  Logger
+}
+
+// Runner executes the commands with the executor and records their results.
+type Runner struct {
+	opts RunnerOptions
+}
+
+// NewRunner create the runner, the options not given are defaulted.
+func NewRunner(opts RunnerOptions) *Runner {
+	if opts.Format == "" {
+		opts.Format = "json"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Minute
+	}
+	if opts.Logger == nil {
+		opts.Logger = NopLogger{}
+	}
+	return &Runner{opts}
+}
+
+// Executor get the executor running the commands.
+func (r *Runner) Executor() Executor {
+	return r.opts.Executor
+}
+
+// Execute run the command and fill in its result: the output, the object id created, the request ids
+// and the timing. Err is the stderr when the command fails.
+func (r *Runner) Execute(ctx context.Context, cmdctx *CommandContext) {
+	cmdArgs := strings.Split(cmdctx.Command, " ")
+	cmdArgs = append(append(cmdArgs[:1:1], r.opts.Args...), cmdArgs[1:]...)
+	format := cmdctx.Format
+	if format == "" {
+		format = r.opts.Format
+	}
+	if format != "none" && !HasFormatArg(cmdctx.Command) {
+		cmdArgs = append(cmdArgs, "--format", format)
+	}
+
+	timeoutctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	r.opts.Logger.Debugf("Execute: %q", cmdArgs)
+
+	fs := time.Now()
+	out, err, exitCode, e := r.opts.Executor.Run(WithEnv(timeoutctx, cmdctx.EnvOverrides), cmdArgs)
+	fe := time.Now()
+	r.opts.Logger.Debugf("Executed: %q, stdout: %s, stderr: %s", cmdArgs, out, err)
+
+	if e != nil {
+		err += e.Error()
+		cmdctx.Err = err
+	} else {
+		cmdctx.RawOut = out
+		var resp struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal([]byte(out), &resp) == nil {
+			cmdctx.ObjectID = resp.ID
+		}
+	}
+	cmdctx.CLIRequests = cliTraceRegexp.FindAllString(err, -1)
+	cmdctx.RequestIDs = RequestIDsOf(err)
+	cmdctx.Stdout = out
+	cmdctx.Stderr = err
+
+	if alt, ok := r.opts.Executor.(APILatencyTimer); ok {
+		cmdctx.APILatencyMs = alt.APILatency().Milliseconds()
+	}
+
+	cmdctx.ExitCode = exitCode
+	cmdctx.Duration = fe.Sub(fs)
+	cmdctx.StartedAt = fs
+	cmdctx.FinishedAt = fe
+}
@@ -0,0 +1,52 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"f5-oslbaasv2-batchops/pkg/batch"
+)
+
+// CLIOptions of the neutron command status source.
+type CLIOptions struct {
+	Runner *batch.Runner
+	Schema Schema
+	// Format is the --neutron-format: the json output is parsed, otherwise the status column is
+	// shown in value format, for the clients without json support.
+	Format string
+}
+
+// CLISource gets the provisioning status by the neutron show command.
+type CLISource struct {
+	opts CLIOptions
+}
+
+// NewCLISource create the neutron command status source.
+func NewCLISource(opts CLIOptions) *CLISource {
+	return &CLISource{opts}
+}
+
+// ProvisioningStatus run the show command of the object and get its status.
+func (s *CLISource) ProvisioningStatus(ctx context.Context, objectType string, idOrName string) (string, error) {
+	chkctx := batch.CommandContext{
+		Command: fmt.Sprintf("neutron %s%s-show %s", s.opts.Schema.SubcommandPrefix, objectType, idOrName),
+	}
+	if s.opts.Format != "json" {
+		chkctx.Command += " --column " + s.opts.Schema.StatusColumn
+		chkctx.Format = "value"
+	}
+	s.opts.Runner.Execute(ctx, &chkctx)
+	if chkctx.ExitCode != 0 {
+		return "", fmt.Errorf("%s", chkctx.Err)
+	}
+	if chkctx.Format == "value" {
+		return strings.TrimSpace(chkctx.RawOut), nil
+	}
+
+	obj := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(chkctx.RawOut), &obj)
+	status, _ := obj[s.opts.Schema.StatusColumn].(string)
+	return status, nil
+}
@@ -0,0 +1,130 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Object is the row of an lbaas object selected by Schema.Columns.
+type Object struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	ProvisioningStatus string `json:"provisioning_status"`
+	ProjectID          string `json:"project_id"`
+}
+
+// DBOptions of the database status source.
+type DBOptions struct {
+	Schema Schema
+	// ProjectID limits the objects looked up by name to the project, all projects if empty.
+	ProjectID string
+}
+
+// DBSource gets the provisioning status from the neutron database.
+type DBSource struct {
+	db   *gorm.DB
+	opts DBOptions
+}
+
+// NewDBSource create the database status source on the connection.
+func NewDBSource(db *gorm.DB, opts DBOptions) *DBSource {
+	return &DBSource{db, opts}
+}
+
+// ProvisioningStatus get the status of the object by its id, or its name if not an id.
+func (s *DBSource) ProvisioningStatus(ctx context.Context, objectType string, idOrName string) (string, error) {
+	return s.StatusOf(objectType, idOrName, IsID(idOrName))
+}
+
+// StatusOf get the status of the object by its id if isID, otherwise by its name, which is an error
+// if more than one object has it.
+func (s *DBSource) StatusOf(objectType string, idOrName string, isID bool) (string, error) {
+	table, ok := s.opts.Schema.Tables[objectType]
+	if !ok {
+		table = "unknown"
+	}
+
+	if !isID && !s.opts.Schema.HasName(objectType) {
+		return "", fmt.Errorf("%s %s: %s has no name, use an id instead", objectType, idOrName, table)
+	}
+
+	entries := []Object{}
+	tag := "id"
+	if !isID {
+		tag = "name"
+	}
+	query := s.db.Table(table).Select(s.opts.Schema.Columns(objectType)).Where(fmt.Sprintf("%s = ?", tag), idOrName)
+	if s.opts.ProjectID != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", s.opts.Schema.ProjectColumn), s.opts.ProjectID)
+	}
+	rlt := query.Find(&entries)
+	if rlt.Error != nil {
+		return "", rlt.Error
+	}
+	if rlt.RowsAffected > 1 {
+		candidates := []string{}
+		for _, n := range entries {
+			candidates = append(candidates, fmt.Sprintf("%s(project: %s)", n.ID, n.ProjectID))
+		}
+		return "", fmt.Errorf("%s %s has %d records, use an id instead: %s",
+			objectType, idOrName, rlt.RowsAffected, strings.Join(candidates, ", "))
+	}
+	if rlt.RowsAffected != 1 {
+		return "", fmt.Errorf("%s %s has %d records", objectType, idOrName, rlt.RowsAffected)
+	}
+
+	return entries[0].ProvisioningStatus, nil
+}
+
+// ProvisioningStatuses get the status of the objects by id with one query.
+// Objects not found in database are absent from the returned map.
+func (s *DBSource) ProvisioningStatuses(objectType string, ids []string) (map[string]string, error) {
+	table, ok := s.opts.Schema.Tables[objectType]
+	if !ok {
+		return nil, fmt.Errorf("unknown object type %s", objectType)
+	}
+
+	statuses := map[string]string{}
+	if len(ids) == 0 {
+		return statuses, nil
+	}
+
+	entries := []Object{}
+	rlt := s.db.Table(table).Select(s.opts.Schema.Columns(objectType)).Where("id IN ?", ids).Find(&entries)
+	if rlt.Error != nil {
+		return nil, rlt.Error
+	}
+	for _, n := range entries {
+		statuses[n.ID] = n.ProvisioningStatus
+	}
+	return statuses, nil
+}
+
+// ID get the id of the object by its name or id.
+func (s *DBSource) ID(objectType string, idOrName string) (string, error) {
+	if IsID(idOrName) {
+		return idOrName, nil
+	}
+
+	table := s.opts.Schema.Tables[objectType]
+	if !s.opts.Schema.HasName(objectType) {
+		return "", fmt.Errorf("%s %s: %s has no name, use an id instead", objectType, idOrName, table)
+	}
+
+	entries := []Object{}
+	query := s.db.Table(table).Select(s.opts.Schema.Columns(objectType)).Where("name = ?", idOrName)
+	if s.opts.ProjectID != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", s.opts.Schema.ProjectColumn), s.opts.ProjectID)
+	}
+	rlt := query.Find(&entries)
+	if rlt.Error != nil {
+		return "", rlt.Error
+	}
+	if rlt.RowsAffected != 1 {
+		return "", fmt.Errorf("%s %s has %d records", objectType, idOrName, rlt.RowsAffected)
+	}
+	return entries[0].ID, nil
+}
@@ -0,0 +1,119 @@
+package status
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"f5-oslbaasv2-batchops/pkg/batch"
+)
+
+// FailoverOptions of the failover from the database to the neutron command.
+type FailoverOptions struct {
+	// Threshold is the database query time to fail over to the neutron command, 0 to disable.
+	Threshold time.Duration
+	// RecoverQueries is the number of consecutive fast queries to switch back to the database.
+	RecoverQueries int
+	Logger         batch.Logger
+}
+
+// Failover checks the status with the database, and fails over to the neutron command while the
+// database queries are slower than the threshold. The database is probed aside meanwhile.
+type Failover struct {
+	opts FailoverOptions
+
+	mu          sync.Mutex
+	failedOver  bool
+	fastQueries int
+	probing     int32
+}
+
+// NewFailover create the failover state, shared by the sources it makes.
+func NewFailover(opts FailoverOptions) *Failover {
+	if opts.Logger == nil {
+		opts.Logger = batch.NopLogger{}
+	}
+	return &Failover{opts: opts}
+}
+
+// FailedOver tells the neutron command is used instead of the database.
+func (f *Failover) FailedOver() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.failedOver
+}
+
+// Observe fail over to the neutron command when a database query is slower than the threshold,
+// and switch back after consecutive fast queries.
+func (f *Failover) Observe(d time.Duration) {
+	if f.opts.Threshold <= 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if d > f.opts.Threshold {
+		f.fastQueries = 0
+		if !f.failedOver {
+			f.failedOver = true
+			f.opts.Logger.Warnf("Database query took %d ms, over %d ms, check loadbalancer status with neutron command instead",
+				d.Milliseconds(), f.opts.Threshold.Milliseconds())
+		}
+		return
+	}
+
+	if f.failedOver {
+		f.fastQueries++
+		if f.fastQueries >= f.opts.RecoverQueries {
+			f.failedOver = false
+			f.fastQueries = 0
+			f.opts.Logger.Warnf("Database queries are under %d ms for %d times, check loadbalancer status with database again",
+				f.opts.Threshold.Milliseconds(), f.opts.RecoverQueries)
+		}
+	}
+}
+
+// Source get the status source checking db, or cli while failed over.
+func (f *Failover) Source(db batch.StatusSource, cli batch.StatusSource) batch.StatusSource {
+	return &failoverSource{f, db, cli}
+}
+
+type failoverSource struct {
+	failover *Failover
+	db       batch.StatusSource
+	cli      batch.StatusSource
+}
+
+func (fs *failoverSource) ProvisioningStatus(ctx context.Context, objectType string, idOrName string) (string, error) {
+	f := fs.failover
+	if !f.FailedOver() {
+		started := time.Now()
+		status, err := fs.db.ProvisioningStatus(ctx, objectType, idOrName)
+		f.Observe(time.Since(started))
+		return status, err
+	}
+
+	var probe chan time.Duration
+	if atomic.CompareAndSwapInt32(&f.probing, 0, 1) {
+		probe = make(chan time.Duration, 1)
+		go func() {
+			defer atomic.StoreInt32(&f.probing, 0)
+			started := time.Now()
+			_, _ = fs.db.ProvisioningStatus(context.Background(), objectType, idOrName)
+			probe <- time.Since(started)
+		}()
+	}
+
+	status, err := fs.cli.ProvisioningStatus(ctx, objectType, idOrName)
+	if probe != nil {
+		select {
+		case d := <-probe:
+			f.Observe(d)
+		default:
+			// still running, slower than the neutron command.
+			f.Observe(f.opts.Threshold + time.Millisecond)
+		}
+	}
+	return status, err
+}
@@ -0,0 +1,100 @@
+// Package status gets the provisioning status of the lbaas objects, from the neutron database or
+// the neutron command, as the status sources of the batch readiness checks.
+package status
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// idRegexp matches an object id, which is looked up by id instead of name.
+var idRegexp = regexp.MustCompile(`[0-9a-f\-]{36}`)
+
+// IsID tells idOrName is an object id.
+func IsID(idOrName string) bool {
+	return idRegexp.MatchString(idOrName)
+}
+
+// Schema is the naming of an lbaas api version: its subcommands, object types, tables and columns.
+type Schema struct {
+	// SubcommandPrefix starts the subcommands, like lbaas-pool-show.
+	SubcommandPrefix string
+	// LoadBalancerType is the object locking the tree, which is checked for readiness.
+	LoadBalancerType string
+	StatusColumn     string
+	ProjectColumn    string
+	// ObjectTypes in the order of the object hierarchy.
+	ObjectTypes []string
+	// Tables by object type.
+	Tables map[string]string
+	// Unnamed object types have no name column, which is selected empty and not looked up by.
+	Unnamed map[string]bool
+	// Statusless object types have no status column, which is selected empty.
+	Statusless map[string]bool
+}
+
+var (
+	// V2 is the lbaas v2 schema.
+	V2 = Schema{
+		SubcommandPrefix: "lbaas-",
+		LoadBalancerType: "loadbalancer",
+		StatusColumn:     "provisioning_status",
+		ProjectColumn:    "project_id",
+		ObjectTypes:      []string{"loadbalancer", "listener", "pool", "member", "healthmonitor", "l7policy"},
+		Tables: map[string]string{
+			"loadbalancer":  "lbaas_loadbalancers",
+			"listener":      "lbaas_listeners",
+			"pool":          "lbaas_pools",
+			"member":        "lbaas_members",
+			"healthmonitor": "lbaas_healthmonitors",
+			"l7policy":      "lbaas_l7policies",
+		},
+	}
+	// V1 is the lbaas v1 schema, which has no loadbalancer object: the pool is checked for readiness.
+	// The members and healthmonitors have no name, and the healthmonitors keep their status per pool,
+	// in poolmonitorassociations.
+	V1 = Schema{
+		SubcommandPrefix: "lb-",
+		LoadBalancerType: "pool",
+		StatusColumn:     "status",
+		ProjectColumn:    "tenant_id",
+		ObjectTypes:      []string{"pool", "vip", "member", "healthmonitor"},
+		Tables: map[string]string{
+			"pool":          "pools",
+			"vip":           "vips",
+			"member":        "members",
+			"healthmonitor": "healthmonitors",
+		},
+		Unnamed:    map[string]bool{"member": true, "healthmonitor": true},
+		Statusless: map[string]bool{"healthmonitor": true},
+	}
+)
+
+// SchemaOf get the schema of the lbaas api version, v1 or v2.
+func SchemaOf(version string) (Schema, error) {
+	switch version {
+	case "v2":
+		return V2, nil
+	case "v1":
+		return V1, nil
+	}
+	return Schema{}, fmt.Errorf("Invalid neutron lbaas api version: %s, should be v1 or v2", version)
+}
+
+// HasName tells the objects of the type have a name column to be looked up by.
+func (s Schema) HasName(objectType string) bool {
+	return !s.Unnamed[objectType]
+}
+
+// Columns select the id, name, provisioning_status and project_id of the objects of the type.
+// The columns missing in its table are selected as empty strings.
+func (s Schema) Columns(objectType string) string {
+	name, status := "name", s.StatusColumn
+	if s.Unnamed[objectType] {
+		name = "'' AS name"
+	}
+	if s.Statusless[objectType] {
+		status = "''"
+	}
+	return fmt.Sprintf("id, %s, %s AS provisioning_status, %s AS project_id", name, status, s.ProjectColumn)
+}
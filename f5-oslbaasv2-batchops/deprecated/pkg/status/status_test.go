@@ -0,0 +1,206 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"f5-oslbaasv2-batchops/pkg/batch"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeExecutor replies stdout to every command, or fails if stdout is empty.
+type fakeExecutor struct {
+	stdout string
+	argvs  []string
+}
+
+func (fe *fakeExecutor) Run(ctx context.Context, argv []string) (string, string, int, error) {
+	fe.argvs = append(fe.argvs, strings.Join(argv, " "))
+	if fe.stdout == "" {
+		return "", "Unable to find loadbalancer", 1, fmt.Errorf("exit status 1")
+	}
+	return fe.stdout, "", 0, nil
+}
+
+// slowSource replies the status after the delay, counting the checks.
+type slowSource struct {
+	mu      sync.Mutex
+	status  string
+	delay   time.Duration
+	checked int
+}
+
+func (s *slowSource) ProvisioningStatus(ctx context.Context, objectType string, idOrName string) (string, error) {
+	s.mu.Lock()
+	s.checked++
+	s.mu.Unlock()
+	time.Sleep(s.delay)
+	return s.status, nil
+}
+
+func (s *slowSource) checks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checked
+}
+
+// sqlRecorder records the sqls traced by gorm, which are not executed in the dry run.
+type sqlRecorder struct {
+	logger.Interface
+	sqls []string
+}
+
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.sqls = append(r.sqls, sql)
+}
+
+func dryRunDB(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	recorder := &sqlRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "neutron:secret@tcp(127.0.0.1:3306)/ovs_neutron", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, recorder
+}
+
+func Test_SchemaOf(t *testing.T) {
+	if s, err := SchemaOf("v2"); err != nil || s.LoadBalancerType != "loadbalancer" ||
+		s.Columns("pool") != "id, name, provisioning_status AS provisioning_status, project_id AS project_id" {
+		t.Fatalf("unexpected v2 schema: %+v %v", s, err)
+	}
+	if s, err := SchemaOf("v1"); err != nil || s.LoadBalancerType != "pool" || s.Tables["vip"] != "vips" ||
+		s.Columns("pool") != "id, name, status AS provisioning_status, tenant_id AS project_id" {
+		t.Fatalf("unexpected v1 schema: %+v %v", s, err)
+	}
+	if columns := V1.Columns("member"); columns != "id, '' AS name, status AS provisioning_status, tenant_id AS project_id" {
+		t.Fatalf("unexpected v1 member columns: %s", columns)
+	}
+	if columns := V1.Columns("healthmonitor"); columns != "id, '' AS name, '' AS provisioning_status, tenant_id AS project_id" {
+		t.Fatalf("unexpected v1 healthmonitor columns: %s", columns)
+	}
+	if _, err := SchemaOf("v3"); err == nil || err.Error() != "Invalid neutron lbaas api version: v3, should be v1 or v2" {
+		t.Fatalf("unexpected error of v3: %v", err)
+	}
+
+	for idOrName, expected := range map[string]bool{
+		"0f6a3b5e-1c2d-4e5f-8a9b-0c1d2e3f4a5b": true,
+		"lb1":                                  false,
+		"0f6a3b5e":                             false,
+	} {
+		if IsID(idOrName) != expected {
+			t.Fatalf("expected IsID(%s) %v", idOrName, expected)
+		}
+	}
+}
+
+func Test_DBSourceV1(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	source := NewDBSource(db, DBOptions{Schema: V1, ProjectID: "p1"})
+	memberID := "0f6a3b5e-1c2d-4e5f-8a9b-0c1d2e3f4a5b"
+
+	// no rows in the dry run.
+	_, _ = source.StatusOf("member", memberID, true)
+	_, _ = source.ProvisioningStatuses("healthmonitor", []string{memberID})
+	_, _ = source.ID("pool", "pool1")
+	expected := []string{
+		"SELECT id, '' AS name, status AS provisioning_status, tenant_id AS project_id FROM `members` WHERE id = '" + memberID + "' AND tenant_id = 'p1'",
+		"SELECT id, '' AS name, '' AS provisioning_status, tenant_id AS project_id FROM `healthmonitors` WHERE id IN ('" + memberID + "')",
+		"SELECT id, name, status AS provisioning_status, tenant_id AS project_id FROM `pools` WHERE name = 'pool1' AND tenant_id = 'p1'",
+	}
+	if len(recorder.sqls) != len(expected) {
+		t.Fatalf("unexpected sqls: %q", recorder.sqls)
+	}
+	for i, n := range expected {
+		if recorder.sqls[i] != n {
+			t.Fatalf("unexpected sql:\n%s\nexpected:\n%s", recorder.sqls[i], n)
+		}
+	}
+
+	if _, err := source.StatusOf("member", "member1", false); err == nil || err.Error() != "member member1: members has no name, use an id instead" {
+		t.Fatalf("unexpected error of member by name: %v", err)
+	}
+	if _, err := source.ID("healthmonitor", "hm1"); err == nil || err.Error() != "healthmonitor hm1: healthmonitors has no name, use an id instead" {
+		t.Fatalf("unexpected error of healthmonitor by name: %v", err)
+	}
+	if len(recorder.sqls) != len(expected) {
+		t.Fatalf("expected no query of the unnamed objects by name: %q", recorder.sqls[len(expected):])
+	}
+}
+
+func Test_CLISource(t *testing.T) {
+	fake := &fakeExecutor{stdout: `{"id": "lb-id", "provisioning_status": "PENDING_UPDATE"}`}
+	runner := batch.NewRunner(batch.RunnerOptions{Executor: fake})
+
+	source := NewCLISource(CLIOptions{Runner: runner, Schema: V2, Format: "json"})
+	if status, err := source.ProvisioningStatus(context.Background(), "loadbalancer", "lb1"); err != nil || status != "PENDING_UPDATE" {
+		t.Fatalf("unexpected json status: %s %v", status, err)
+	}
+	if fake.argvs[0] != "neutron lbaas-loadbalancer-show lb1 --format json" {
+		t.Fatalf("unexpected json command: %s", fake.argvs[0])
+	}
+
+	fake.stdout = "ACTIVE\n"
+	source = NewCLISource(CLIOptions{Runner: runner, Schema: V1, Format: "table"})
+	if status, err := source.ProvisioningStatus(context.Background(), "pool", "pool1"); err != nil || status != "ACTIVE" {
+		t.Fatalf("unexpected value status: %s %v", status, err)
+	}
+	if fake.argvs[1] != "neutron lb-pool-show pool1 --column status --format value" {
+		t.Fatalf("unexpected value command: %s", fake.argvs[1])
+	}
+
+	fake.stdout = ""
+	if _, err := source.ProvisioningStatus(context.Background(), "pool", "pool1"); err == nil ||
+		err.Error() != "Unable to find loadbalancerexit status 1" {
+		t.Fatalf("unexpected error of failed show: %v", err)
+	}
+}
+
+func Test_Failover(t *testing.T) {
+	f := NewFailover(FailoverOptions{Threshold: 20 * time.Millisecond, RecoverQueries: 2})
+	f.Observe(5 * time.Millisecond)
+	if f.FailedOver() {
+		t.Fatal("expected not failed over by a fast query")
+	}
+	f.Observe(30 * time.Millisecond)
+	f.Observe(5 * time.Millisecond)
+	if !f.FailedOver() {
+		t.Fatal("expected failed over by a slow query")
+	}
+	f.Observe(5 * time.Millisecond)
+	if f.FailedOver() {
+		t.Fatal("expected switched back after 2 fast queries")
+	}
+
+	db := &slowSource{status: "ACTIVE", delay: 40 * time.Millisecond}
+	cli := &slowSource{status: "PENDING_UPDATE"}
+	source := f.Source(db, cli)
+	if status, _ := source.ProvisioningStatus(context.Background(), "loadbalancer", "lb1"); status != "ACTIVE" || !f.FailedOver() {
+		t.Fatalf("expected the slow database checked then failed over: %s", status)
+	}
+	if status, _ := source.ProvisioningStatus(context.Background(), "loadbalancer", "lb1"); status != "PENDING_UPDATE" {
+		t.Fatalf("expected the neutron command checked while failed over: %s", status)
+	}
+	if cli.checks() != 1 {
+		t.Fatalf("expected 1 neutron command check, got %d", cli.checks())
+	}
+	// the database is probed aside.
+	time.Sleep(60 * time.Millisecond)
+	if db.checks() != 2 {
+		t.Fatalf("expected the database probed, got %d checks", db.checks())
+	}
+
+	disabled := NewFailover(FailoverOptions{})
+	disabled.Observe(time.Hour)
+	if disabled.FailedOver() {
+		t.Fatal("expected no failover without threshold")
+	}
+}
@@ -0,0 +1,98 @@
+// Package template expands the neutron command template with %{variable}s into commands.
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// VarRegexp matches a variable in the template, like %{x}.
+var VarRegexp = regexp.MustCompile(`%\{[a-zA-Z_][a-zA-Z0-9_]*\}`)
+
+// weightRegexp matches a weighted value, like a*3.
+var weightRegexp = regexp.MustCompile(`^(.+)\*([1-9]\d*)$`)
+
+// Variables get the names of the variables in s, in order of appearance.
+func Variables(s string) []string {
+	names := []string{}
+	for _, m := range VarRegexp.FindAllString(s, -1) {
+		names = append(names, m[2:len(m)-1])
+	}
+	return names
+}
+
+// ParseDefinitions parse the 'name:values' definitions of the variables given in names.
+// Definitions of other names are ignored; values of a name defined more than once are appended.
+func ParseDefinitions(names []string, definitions []string) map[string][]string {
+	variables := map[string][]string{}
+	for _, k := range names {
+		variables[k] = []string{}
+	}
+	for _, n := range definitions {
+		for k := range variables {
+			if strings.HasPrefix(n, fmt.Sprintf("%s:", k)) {
+				kvp := strings.Split(n, ":")
+				v := ParseVarValues(strings.Join(kvp[1:], ":"))
+				variables[k] = append(variables[k], v...)
+			}
+		}
+	}
+	return variables
+}
+
+// Expand recursively generate the commands from the template, one for each combination of
+// the variable values. A variable without values generates no command.
+func Expand(template string, variables map[string][]string) []string {
+	varInTmp := VarRegexp.FindString(template)
+	if varInTmp == "" {
+		return []string{template}
+	}
+	l := len(varInTmp)
+	varName := varInTmp[2 : l-1]
+
+	r := regexp.MustCompile(varInTmp)
+
+	cmds := []string{}
+	for _, k := range variables[varName] {
+		replaced := r.ReplaceAllString(template, k)
+		cmds = append(cmds, Expand(replaced, variables)...)
+	}
+	return cmds
+}
+
+// ParseVarValues parse the value ranges to actual value list
+// Supports: '-' num list and ',' list, and '*' weights repeating the values
+//
+//	1-5
+//	a,b,c
+//	1-3,4,6-9,a,b,c
+//	a*3,b,c*2
+func ParseVarValues(v string) []string {
+	rlt := []string{}
+	ls := strings.Split(v, ",")
+	p := regexp.MustCompile(`^\d+\-\d+$`)
+	for _, n := range ls {
+		weight := 1
+		if m := weightRegexp.FindStringSubmatch(n); m != nil {
+			n = m[1]
+			weight, _ = strconv.Atoi(m[2])
+		}
+		values := []string{n}
+		matched := p.MatchString(n)
+		if matched {
+			values = []string{}
+			se := strings.Split(n, "-")
+			s, _ := strconv.Atoi(se[0])
+			e, _ := strconv.Atoi(se[1])
+			for i := s; i <= e; i++ {
+				values = append(values, fmt.Sprintf("%d", i))
+			}
+		}
+		for i := 0; i < weight; i++ {
+			rlt = append(rlt, values...)
+		}
+	}
+	return rlt
+}
@@ -0,0 +1,48 @@
+package template
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Expand(t *testing.T) {
+	cmds := Expand("lb%{x}|lbaas-member-create --subnet s --address 10.0.%{x}.%{y} pool%{x}", map[string][]string{
+		"x": {"1", "2"},
+		"y": {"5"},
+	})
+	expected := []string{
+		"lb1|lbaas-member-create --subnet s --address 10.0.1.5 pool1",
+		"lb2|lbaas-member-create --subnet s --address 10.0.2.5 pool2",
+	}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Fatalf("unexpected commands: %v", cmds)
+	}
+
+	if cmds := Expand("|lbaas-loadbalancer-show lb%{x}", map[string][]string{}); len(cmds) != 0 {
+		t.Fatalf("unexpected commands of undefined variable: %v", cmds)
+	}
+}
+
+func Test_ParseDefinitions(t *testing.T) {
+	names := Variables("lbaas-loadbalancer-create --name lb%{x} %{subnet}")
+	variables := ParseDefinitions(names, []string{"x:1-3,7", "subnet:private-subnet,public-subnet", "y:1"})
+	expected := map[string][]string{
+		"x":      {"1", "2", "3", "7"},
+		"subnet": {"private-subnet", "public-subnet"},
+	}
+	if !reflect.DeepEqual(variables, expected) {
+		t.Fatalf("unexpected variables: %v", variables)
+	}
+}
+
+func Test_ParseVarValues(t *testing.T) {
+	for v, expected := range map[string][]string{
+		"1-3,a":     {"1", "2", "3", "a"},
+		"a*3,b,c*2": {"a", "a", "a", "b", "c", "c"},
+		"1-2*2,x*":  {"1", "2", "1", "2", "x*"},
+	} {
+		if values := ParseVarValues(v); !reflect.DeepEqual(values, expected) {
+			t.Fatalf("unexpected values of %s: %v", v, values)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Package version holds the build information of the binaries, injected with -ldflags, like
+//
+//	go build -ldflags "-X f5-oslbaasv2-batchops/pkg/version.Version=1.2.0
+//	    -X f5-oslbaasv2-batchops/pkg/version.Commit=$(git rev-parse --short HEAD)
+//	    -X f5-oslbaasv2-batchops/pkg/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import "fmt"
+
+var (
+	// Version is the semantic version of the build.
+	Version = "0.0.0-dev"
+	// Commit is the git commit the binary is built from.
+	Commit = "unknown"
+	// BuildDate is the time of the build, in RFC3339.
+	BuildDate = "unknown"
+)
+
+// Info is the build information, for the outputs recording it.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// Get the build information.
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, BuildDate: BuildDate}
+}
+
+// String format the build information as 'name version (commit, built at date)'.
+func String(name string) string {
+	return fmt.Sprintf("%s %s (commit %s, built %s)", name, Version, Commit, BuildDate)
+}
@@ -0,0 +1,15 @@
+package version
+
+import "testing"
+
+func Test_String(t *testing.T) {
+	defer func(v, c, d string) { Version, Commit, BuildDate = v, c, d }(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "1.2.0", "abc1234", "2020-10-25T12:35:09Z"
+
+	if s := String("f5-oslbaasv2-batchops"); s != "f5-oslbaasv2-batchops 1.2.0 (commit abc1234, built 2020-10-25T12:35:09Z)" {
+		t.Fatalf("unexpected version: %s", s)
+	}
+	if info := Get(); info.Version != "1.2.0" || info.Commit != "abc1234" || info.BuildDate != "2020-10-25T12:35:09Z" {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+)
+
+var (
+	allowOperations StringsFlag
+	denyOperations  StringsFlag
+)
+
+// OperationAllowed tell if the operation type passes --allow-operations and --deny-operations.
+// All operations are allowed without --allow-operations; the denied ones are never.
+func OperationAllowed(operation string) bool {
+	if StringArray(denyOperations).IndexOf(operation) != -1 {
+		return false
+	}
+	return len(allowOperations) == 0 || StringArray(allowOperations).IndexOf(operation) != -1
+}
+
+// CheckOperationPolicy validate the operations of the commands against --allow-operations and
+// --deny-operations. Returns the error of the first command violating the policy.
+func CheckOperationPolicy(commands []string) error {
+	for i, n := range commands {
+		cmdctx := NewCommandContext(n)
+		if !OperationAllowed(cmdctx.OperationType) {
+			return fmt.Errorf("command %d '%s': operation %s is not allowed by --allow-operations %q --deny-operations %q",
+				i+1, cmdctx.Command, cmdctx.OperationType, &allowOperations, &denyOperations)
+		}
+	}
+	return nil
+}
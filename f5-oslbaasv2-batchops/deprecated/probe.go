@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	probeMode     string
+	probeTimeout  = 5 * time.Second
+	probeRetries  = 3
+	probeStrict   bool
+	probeLBPort   int
+	probeInterval = time.Second
+)
+
+// ProbeResult is the data path check of the VIP after a loadbalancer or listener is created.
+type ProbeResult struct {
+	Target    string `json:"target"`
+	OK        bool   `json:"ok"`
+	Attempts  int    `json:"attempts"`
+	LatencyMs int64  `json:"latency_ms"`
+	Err       string `json:"error,omitempty"`
+}
+
+// Probeable tells the command creates a loadbalancer or listener, whose VIP can be probed.
+func (cmdctx *CommandContext) Probeable() bool {
+	return cmdctx.OperationType == "create" &&
+		(cmdctx.ResourceType == "listener" || (cmdctx.ResourceType == "loadbalancer" && probeLBPort > 0))
+}
+
+// ProbeTarget get the vip_address:port to probe: the protocol_port of the listener, or
+// --probe-loadbalancer-port for the loadbalancer.
+func (cmdctx *CommandContext) ProbeTarget() (string, error) {
+	doc := cmdctx.Parsed
+	if doc == nil {
+		if err := json.Unmarshal([]byte(cmdctx.RawOut), &doc); err != nil {
+			return "", fmt.Errorf("invalid output: %s", err.Error())
+		}
+	}
+
+	if cmdctx.ResourceType == "loadbalancer" {
+		vip, _ := FieldOf(doc, "vip_address")
+		if s, ok := vip.(string); ok && s != "" {
+			return net.JoinHostPort(s, strconv.Itoa(probeLBPort)), nil
+		}
+		return "", fmt.Errorf("no vip_address in output")
+	}
+
+	port, _ := FieldOf(doc, "protocol_port")
+	p, ok := port.(float64)
+	if !ok {
+		return "", fmt.Errorf("no protocol_port in output")
+	}
+	lb := cmdctx.LoadBalancer
+	if id, ok := FieldOf(doc, "loadbalancers.0.id"); ok {
+		lb, _ = id.(string)
+	}
+	vip, err := VIPAddressOf(lb)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(vip, strconv.Itoa(int(p))), nil
+}
+
+// VIPAddressOf get the vip_address of the loadbalancer from database, or by command without --mysql-uri.
+func VIPAddressOf(lbIDName string) (string, error) {
+	if lbIDName == "" {
+		return "", fmt.Errorf("no loadbalancer to get the vip_address")
+	}
+	if dbConn != nil {
+		return singleColumn(lbaasSchema.Tables["loadbalancer"], "vip_address", lbIDName)
+	}
+	obj, err := ShowFromCmd(context.Background(), "loadbalancer", lbIDName)
+	if err != nil {
+		return "", err
+	}
+	vip, _ := obj["vip_address"].(string)
+	if vip == "" {
+		return "", fmt.Errorf("no vip_address of loadbalancer %s", lbIDName)
+	}
+	return vip, nil
+}
+
+// Probe connect the target by --probe tcp or http, retrying --probe-retries times.
+// Any http response means the data path works.
+func Probe(target string) *ProbeResult {
+	pr := &ProbeResult{Target: target}
+	for pr.Attempts <= probeRetries {
+		if pr.Attempts > 0 {
+			time.Sleep(probeInterval)
+		}
+		pr.Attempts++
+
+		fs := time.Now()
+		var err error
+		if probeMode == "http" {
+			client := http.Client{Timeout: probeTimeout}
+			var resp *http.Response
+			if resp, err = client.Get("http://" + target + "/"); err == nil {
+				resp.Body.Close()
+			}
+		} else {
+			var conn net.Conn
+			if conn, err = net.DialTimeout("tcp", target, probeTimeout); err == nil {
+				conn.Close()
+			}
+		}
+		pr.LatencyMs = time.Since(fs).Milliseconds()
+		if err == nil {
+			pr.OK, pr.Err = true, ""
+			return pr
+		}
+		pr.Err = err.Error()
+	}
+	return pr
+}
+
+// RunProbe probe the VIP created by the command. A failure is reported as a data path failure,
+// and fails the command only with --probe-strict.
+func (cmdctx *CommandContext) RunProbe() {
+	target, err := cmdctx.ProbeTarget()
+	if err != nil {
+		cmdctx.Probe = &ProbeResult{Err: err.Error()}
+	} else {
+		cmdctx.Probe = Probe(target)
+	}
+	if cmdctx.Probe.OK {
+		logInfo("Command(%d/%d): Probed %s %s in %d ms", cmdctx.Seq, len(cmdList), probeMode, target, cmdctx.Probe.LatencyMs)
+		return
+	}
+
+	logger.Printf("Command(%d/%d): Data path failure, %s probe of %s: %s",
+		cmdctx.Seq, len(cmdList), probeMode, cmdctx.Probe.Target, cmdctx.Probe.Err)
+	if probeStrict {
+		cmdctx.ExitCode = 1
+		cmdctx.FailureClass = "DataPath"
+		cmdctx.Err = "probe failed: " + cmdctx.Probe.Err
+	}
+}
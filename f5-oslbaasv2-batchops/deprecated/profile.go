@@ -0,0 +1,17 @@
+package main
+
+import (
+	"time"
+)
+
+var neutronProfiling bool
+
+// Profile split the command duration into the python startup overhead until the first byte,
+// and the API time from the first byte until exit.
+func (cmdctx *CommandContext) Profile(started, firstByte, exited time.Time) {
+	if firstByte.IsZero() {
+		firstByte = exited
+	}
+	cmdctx.StartupMs = firstByte.Sub(started).Milliseconds()
+	cmdctx.APICallMs = exited.Sub(firstByte).Milliseconds()
+}
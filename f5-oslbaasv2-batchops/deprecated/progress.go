@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var showProgress bool
+
+// progressWindow is the number of recent commands to estimate the remaining time.
+const progressWindow = 20
+
+// Progress renders a single status line on the terminal, updated in place.
+// Logs are written through it so that they don't interleave with the status line.
+type Progress struct {
+	mu      sync.Mutex
+	out     *os.File
+	total   int
+	ok      int
+	fail    int
+	started time.Time
+	current string
+	begin   time.Time
+	recent  []time.Duration
+}
+
+// progress is nil unless --progress is set and stdout is a terminal.
+var progress *Progress
+
+// NewProgress create the progress line of total commands on out.
+func NewProgress(out *os.File, total int) *Progress {
+	return &Progress{out: out, total: total, started: time.Now()}
+}
+
+// Write a log line above the status line.
+func (p *Progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprint(p.out, "\r\033[K")
+	n, err := p.out.Write(b)
+	p.render()
+	return n, err
+}
+
+// Start a command.
+func (p *Progress) Start(cmdctx *CommandContext) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.begin = time.Now()
+	p.current = strings.TrimPrefix(cmdctx.Command, cmdPrefix)
+	p.render()
+}
+
+// Finish a command, its time including the waiting is used for the estimate.
+func (p *Progress) Finish(cmdctx *CommandContext) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cmdctx.ExitCode == 0 {
+		p.ok++
+	} else {
+		p.fail++
+	}
+	if !p.begin.IsZero() {
+		p.recent = append(p.recent, time.Since(p.begin))
+		if len(p.recent) > progressWindow {
+			p.recent = p.recent[1:]
+		}
+	}
+	p.current = ""
+	p.render()
+}
+
+// Stop clear the status line and restore the logger.
+func (p *Progress) Stop() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprint(p.out, "\r\033[K")
+	if logFile == "" {
+		logger.SetOutput(p.out)
+	}
+}
+
+func (p *Progress) render() {
+	done := p.ok + p.fail
+	percent := 0
+	if p.total > 0 {
+		percent = done * 100 / p.total
+	}
+
+	eta := "-"
+	if len(p.recent) > 0 {
+		var sum time.Duration
+		for _, d := range p.recent {
+			sum += d
+		}
+		eta = (sum / time.Duration(len(p.recent)) * time.Duration(p.total-done)).Round(time.Second).String()
+	}
+
+	line := fmt.Sprintf("[ %d/%d ] %d%%  ok:%d fail:%d  elapsed %s  eta %s",
+		done, p.total, percent, p.ok, p.fail, time.Since(p.started).Round(time.Second), eta)
+	if p.current != "" {
+		current := p.current
+		if len(current) > 60 {
+			current = current[:57] + "..."
+		}
+		line += "  current: " + current
+	}
+	fmt.Fprint(p.out, "\r\033[K"+line)
+}
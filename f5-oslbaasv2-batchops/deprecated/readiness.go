@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+var readinessFlags StringsFlag
+
+// ReadinessStrategy is the object polled before running a command of a resource type, and the
+// method to get its provisioning status: db, cmd or auto, which prefers the database.
+type ReadinessStrategy struct {
+	Object string
+	Method string
+}
+
+// readinessStrategies by resource type. neutron-lbaas locks the whole tree by the loadbalancer status,
+// which is polled by default; the types not listed poll the loadbalancer too.
+var readinessStrategies = map[string]ReadinessStrategy{
+	"loadbalancer":  {"loadbalancer", "auto"},
+	"listener":      {"loadbalancer", "auto"},
+	"pool":          {"loadbalancer", "auto"},
+	"member":        {"loadbalancer", "auto"},
+	"healthmonitor": {"loadbalancer", "auto"},
+	"l7policy":      {"loadbalancer", "auto"},
+}
+
+// readinessObjects can be polled: they have provisioning_status and a show subcommand by id.
+var readinessObjects = map[string]bool{"loadbalancer": true, "listener": true, "pool": true}
+
+// ParseReadinessStrategy parse resource=object[:method] of --readiness-strategy, like member=pool:db.
+func ParseReadinessStrategy(s string) (string, ReadinessStrategy, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return "", ReadinessStrategy{}, fmt.Errorf("invalid readiness strategy %s, expect resource=object[:method]", s)
+	}
+	om := strings.SplitN(kv[1], ":", 2)
+	strategy := ReadinessStrategy{om[0], "auto"}
+	if len(om) == 2 {
+		strategy.Method = om[1]
+	}
+	if _, ok := lbaasSchema.Tables[kv[0]]; !ok {
+		return "", strategy, fmt.Errorf("unknown resource type %s", kv[0])
+	}
+	if !readinessObjects[strategy.Object] {
+		return "", strategy, fmt.Errorf("%s can not be polled, should be loadbalancer, listener or pool", strategy.Object)
+	}
+	if strategy.Method != "auto" && strategy.Method != "db" && strategy.Method != "cmd" {
+		return "", strategy, fmt.Errorf("invalid method %s, should be auto, db or cmd", strategy.Method)
+	}
+	return kv[0], strategy, nil
+}
+
+// ReadinessStrategy get the strategy of the command's resource type.
+func (cmdctx *CommandContext) ReadinessStrategy() ReadinessStrategy {
+	if strategy, ok := readinessStrategies[cmdctx.ResourceType]; ok {
+		return strategy
+	}
+	return ReadinessStrategy{lbaasSchema.LoadBalancerType, "auto"}
+}
+
+// ReadinessObject get the id or name of the object to poll, from the command arguments or database.
+func (cmdctx *CommandContext) ReadinessObject(objectType string) (string, error) {
+	if objectType == lbaasSchema.LoadBalancerType {
+		return cmdctx.LoadBalancer, nil
+	}
+
+	args := PositionalArgs(cmdctx.Command)
+	if cmdctx.ResourceType == objectType && cmdctx.OperationType != "create" && len(args) > 0 {
+		return args[0], nil
+	}
+	if v := ArgValue(cmdctx.Command, "--"+objectType); v != "" {
+		return v, nil
+	}
+
+	switch {
+	case objectType == "pool" && cmdctx.ResourceType == "member" && len(args) > 0:
+		return args[len(args)-1], nil
+	case objectType == "pool" && cmdctx.ResourceType == "healthmonitor" && len(args) > 0 && dbConn != nil:
+		id, err := singleColumn(lbaasSchema.Tables["healthmonitor"], "id", args[0])
+		if err != nil {
+			return "", err
+		}
+		return singleColumnBy(lbaasSchema.Tables["pool"], "id", "healthmonitor_id", id)
+	case objectType == "listener" && cmdctx.ResourceType == "l7policy" && len(args) > 0 && dbConn != nil:
+		return singleColumn(lbaasSchema.Tables["l7policy"], "listener_id", args[0])
+	}
+	return "", fmt.Errorf("no %s in command", objectType)
+}
+
+// ProvisioningStatusOf get the provisioning status of the object by the method.
+func ProvisioningStatusOf(ctx context.Context, objectType string, objectIDName string, method string) (string, error) {
+	if objectType == lbaasSchema.LoadBalancerType && method == "auto" {
+		return LBStatus(ctx, objectIDName)
+	}
+	if method == "db" || (method == "auto" && dbConn != nil) {
+		if dbConn == nil {
+			return "", fmt.Errorf("--mysql-uri is required to check %s %s status from database", objectType, objectIDName)
+		}
+		return dbSource().ProvisioningStatus(ctx, objectType, objectIDName)
+	}
+	obj, err := ShowFromCmd(ctx, objectType, objectIDName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(obj["provisioning_status"]), nil
+}
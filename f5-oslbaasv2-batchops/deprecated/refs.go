@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	validateRefs bool
+
+	// refFlags the flags referring to other objects and the object types.
+	refFlags = map[string]string{
+		"--loadbalancer":  "loadbalancer",
+		"--listener":      "listener",
+		"--pool":          "pool",
+		"--default-pool":  "pool",
+		"--redirect-pool": "pool",
+		"--subnet":        "subnet",
+	}
+	// refTables the tables of the referred objects, besides lbaasSchema.Tables.
+	refTables = map[string]string{"subnet": "subnets"}
+)
+
+// ObjectRef is an object referred to by a command.
+type ObjectRef struct {
+	ObjectType string
+	IDName     string
+}
+
+func (ref ObjectRef) String() string {
+	return ref.ObjectType + " " + ref.IDName
+}
+
+// Refs get the existing objects the command refers to, by its flags and positional arguments.
+func (cmdctx *CommandContext) Refs() []ObjectRef {
+	refs := []ObjectRef{}
+	for flag, objectType := range refFlags {
+		if v := ArgValue(cmdctx.Command, flag); v != "" {
+			refs = append(refs, ObjectRef{objectType, v})
+		}
+	}
+
+	args := PositionalArgs(cmdctx.Command)
+	if len(args) == 0 {
+		return refs
+	}
+	switch {
+	case cmdctx.ResourceType == "loadbalancer" && cmdctx.OperationType == "create":
+		// lbaas-loadbalancer-create ... VIP_SUBNET
+		refs = append(refs, ObjectRef{"subnet", args[0]})
+	case cmdctx.ResourceType == "member":
+		// lbaas-member-create ... POOL, lbaas-member-update MEMBER POOL
+		refs = append(refs, ObjectRef{"pool", args[len(args)-1]})
+		if cmdctx.OperationType != "create" && len(args) > 1 {
+			refs = append(refs, ObjectRef{"member", args[0]})
+		}
+	case cmdctx.ResourceType == "l7rule":
+		// lbaas-l7rule-create ... L7POLICY, lbaas-l7rule-update L7RULE L7POLICY
+		refs = append(refs, ObjectRef{"l7policy", args[len(args)-1]})
+	case cmdctx.OperationType != "create" && cmdctx.OperationType != "list":
+		refs = append(refs, ObjectRef{cmdctx.ResourceType, args[0]})
+	}
+	return refs
+}
+
+// ObjectExists tell if the object with the id or name is in database.
+func ObjectExists(ref ObjectRef) (bool, error) {
+	table, ok := lbaasSchema.Tables[ref.ObjectType]
+	if !ok {
+		table, ok = refTables[ref.ObjectType]
+	}
+	if !ok {
+		return false, fmt.Errorf("unknown object type %s", ref.ObjectType)
+	}
+	var count int64
+	query := dbConn.Table(table).Where("id = ? OR name = ?", ref.IDName, ref.IDName)
+	if _, ok := lbaasSchema.Tables[ref.ObjectType]; ok && projectID != "" {
+		query = query.Where(fmt.Sprintf("%s = ?", lbaasSchema.ProjectColumn), projectID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// MissingRefs check the distinct objects referred to by the commands in database, except the ones
+// created by earlier commands of the batch. Returns the missing references with the seqs of
+// the commands referring to them.
+func MissingRefs(commands []string) (map[string][]int, error) {
+	created := map[ObjectRef]bool{}
+	checked := map[ObjectRef]bool{}
+	missing := map[string][]int{}
+	for i, n := range commands {
+		cmdctx := NewCommandContext(n)
+		for _, ref := range cmdctx.Refs() {
+			if created[ref] {
+				continue
+			}
+			exists, ok := checked[ref]
+			if !ok {
+				found, err := ObjectExists(ref)
+				if err != nil {
+					return nil, fmt.Errorf("failed to check %s: %s", ref, err.Error())
+				}
+				checked[ref], exists = found, found
+			}
+			if !exists {
+				missing[ref.String()] = append(missing[ref.String()], i+1)
+			}
+		}
+		if name := ArgValue(cmdctx.Command, "--name"); cmdctx.OperationType == "create" && name != "" {
+			created[ObjectRef{cmdctx.ResourceType, name}] = true
+		}
+	}
+	return missing, nil
+}
+
+// ValidateRefs report the objects referred to by the commands but not found in database.
+// Returns an error if any is missing.
+func ValidateRefs() error {
+	missing, err := MissingRefs(cmdList)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		logger.Printf("%20s: all referred objects found", "References")
+		return nil
+	}
+	refs := []string{}
+	for ref := range missing {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		seqs := []string{}
+		for _, seq := range missing[ref] {
+			seqs = append(seqs, fmt.Sprintf("%d", seq))
+		}
+		logger.Printf("Not found: %s, referred to by command %s", ref, strings.Join(seqs, ","))
+	}
+	return fmt.Errorf("%d referred object(s) not found", len(missing))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// ResultCollector collects the results of the commands, safe for concurrent writers. The results are
+// kept in batches, one per run, like the runs of the clouds or the stored runs of the report mode.
+type ResultCollector struct {
+	mu      sync.Mutex
+	batches [][]*CommandContext
+}
+
+// NewResultCollector create an empty collector.
+func NewResultCollector() *ResultCollector {
+	return &ResultCollector{}
+}
+
+// Add add the result to the current run, the last batch, in the order it finishes.
+func (rc *ResultCollector) Add(cmdctx *CommandContext) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.batches) == 0 {
+		rc.batches = append(rc.batches, []*CommandContext{})
+	}
+	last := len(rc.batches) - 1
+	rc.batches[last] = append(rc.batches[last], cmdctx)
+}
+
+// AddBatch add the results of a run as a new batch, the current run for the later Add.
+func (rc *ResultCollector) AddBatch(results []*CommandContext) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.batches = append(rc.batches, append([]*CommandContext{}, results...))
+}
+
+// Len count the results.
+func (rc *ResultCollector) Len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	count := 0
+	for _, b := range rc.batches {
+		count += len(b)
+	}
+	return count
+}
+
+// Sorted get a copy of the results ordered by Seq in each batch, the batches in the order added.
+func (rc *ResultCollector) Sorted() []*CommandContext {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	sorted := []*CommandContext{}
+	for _, b := range rc.batches {
+		batch := append([]*CommandContext{}, b...)
+		sort.SliceStable(batch, func(i, j int) bool { return batch[i].Seq < batch[j].Seq })
+		sorted = append(sorted, batch...)
+	}
+	return sorted
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// StuckObject is an lbaas object left in PENDING_* or ERROR status.
+type StuckObject struct {
+	ObjectType         string     `json:"object_type"`
+	ID                 string     `json:"id"`
+	Name               string     `json:"name"`
+	ProjectID          string     `json:"project_id"`
+	ProvisioningStatus string     `json:"provisioning_status"`
+	UpdatedAt          *time.Time `json:"updated_at"`
+	Age                string     `json:"age"`
+}
+
+// scanFilters limit the objects to the ones under the loadbalancer, keyed by object type.
+var scanFilters = map[string]string{
+	"loadbalancer":  "lbaas_loadbalancers.id = ?",
+	"listener":      "lbaas_listeners.loadbalancer_id = ?",
+	"pool":          "lbaas_pools.loadbalancer_id = ?",
+	"member":        "lbaas_members.pool_id IN (SELECT id FROM lbaas_pools WHERE loadbalancer_id = ?)",
+	"healthmonitor": "lbaas_healthmonitors.id IN (SELECT healthmonitor_id FROM lbaas_pools WHERE loadbalancer_id = ?)",
+	"l7policy":      "lbaas_l7policies.listener_id IN (SELECT id FROM lbaas_listeners WHERE loadbalancer_id = ?)",
+}
+
+// StuckObjectsFromDB query the objects of objectType in PENDING_* or ERROR status.
+// lbID and projectID are optional filters.
+func StuckObjectsFromDB(objectType string, lbID string) ([]StuckObject, error) {
+	table := lbaasSchema.Tables[objectType]
+	build := func(withTime bool) ([]StuckObject, error) {
+		rows := []StuckObject{}
+		columns := fmt.Sprintf("%s.id, %s.name, %s.project_id, %s.provisioning_status", table, table, table, table)
+		query := dbConn.Table(table)
+		if withTime {
+			columns += ", standardattributes.updated_at"
+			query = query.Joins(fmt.Sprintf("LEFT JOIN standardattributes ON standardattributes.id = %s.standard_attr_id", table))
+		}
+		query = query.Select(columns).Where(
+			fmt.Sprintf("(%s.provisioning_status LIKE ? OR %s.provisioning_status = ?)", table, table), "PENDING_%", "ERROR")
+		if projectID != "" {
+			query = query.Where(fmt.Sprintf("%s.project_id = ?", table), projectID)
+		}
+		if lbID != "" {
+			query = query.Where(scanFilters[objectType], lbID)
+		}
+		err := query.Scan(&rows).Error
+		return rows, err
+	}
+
+	rows, err := build(true)
+	if err != nil {
+		if !TimestampsUnavailable(err) {
+			return nil, fmt.Errorf("failed to query %s with timestamps: %s", table, err.Error())
+		}
+		logger.Printf("Query %s with timestamps failed, retry without: %s", table, err.Error())
+		rows, err = build(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range rows {
+		rows[i].ObjectType = objectType
+		if rows[i].UpdatedAt != nil {
+			rows[i].Age = time.Since(*rows[i].UpdatedAt).Round(time.Second).String()
+		}
+	}
+	return rows, nil
+}
+
+// TimestampsUnavailable tells the query failed for the schema without the timestamps, like the older
+// neutron-lbaas without standardattributes, rather than failing to scan them.
+func TimestampsUnavailable(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	// ER_BAD_FIELD_ERROR and ER_NO_SUCH_TABLE
+	return mysqlErr.Number == 1054 || mysqlErr.Number == 1146
+}
+
+// ScanStuckObjects print the stuck objects and write them to the output file.
+// Returns the exit code: 0 if nothing is stuck.
+func ScanStuckObjects() int {
+	defer outputFile.Close()
+
+	if dbConn == nil {
+		logger.Printf("scan mode requires --mysql-uri")
+		return 1
+	}
+
+	lbID := ""
+	if loadbalancer != "" {
+		id, err := dbSource().ID(lbaasSchema.LoadBalancerType, loadbalancer)
+		if err != nil {
+			logger.Printf("Failed to find loadbalancer %s: %s", loadbalancer, err.Error())
+			return 1
+		}
+		lbID = id
+	}
+
+	stuck := []StuckObject{}
+	for _, t := range lbaasSchema.ObjectTypes {
+		rows, err := StuckObjectsFromDB(t, lbID)
+		if err != nil {
+			logger.Printf("Failed to scan %s: %s", lbaasSchema.Tables[t], err.Error())
+			return 1
+		}
+		stuck = append(stuck, rows...)
+	}
+
+	fmt.Println()
+	fmt.Println("------------------------- Scan Report -------------------------")
+	fmt.Println()
+	fmt.Printf("%-14s %-36s %-24s %-16s %s\n", "TYPE", "ID", "NAME", "STATUS", "AGE")
+	for _, n := range stuck {
+		fmt.Printf("%-14s %-36s %-24s %-16s %s\n", n.ObjectType, n.ID, n.Name, n.ProvisioningStatus, n.Age)
+	}
+	fmt.Println()
+	fmt.Printf("%d object(s) in PENDING_* or ERROR status.\n", len(stuck))
+	fmt.Println()
+	fmt.Println("----------------------- Scan Report End -----------------------")
+	fmt.Println()
+
+	jd, _ := json.MarshalIndent(stuck, "", "  ")
+	if _, e := outputFile.WriteString(string(jd)); e != nil {
+		logger.Printf("Error happens while writing: %s", e.Error())
+	}
+
+	if len(stuck) > 0 {
+		return 1
+	}
+	return 0
+}
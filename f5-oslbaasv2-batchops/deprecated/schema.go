@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var printSchema bool
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// JSONSchemaOf generate the JSON schema of the type by its json tags. The fields with omitempty,
+// and the pointers, are not required.
+func JSONSchemaOf(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]interface{}{"type": "integer", "description": "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return JSONSchemaOf(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Array:
+		return map[string]interface{}{"type": "array", "items": JSONSchemaOf(t.Elem())}
+	case reflect.Slice:
+		// nil slices and maps are written as null.
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": JSONSchemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": JSONSchemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if f.PkgPath != "" || tag == "-" {
+				continue
+			}
+			// the fields of an embedded struct are inlined, like encoding/json does.
+			if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+				embedded := JSONSchemaOf(f.Type)
+				for k, v := range embedded["properties"].(map[string]interface{}) {
+					properties[k] = v
+				}
+				required = append(required, embedded["required"].([]string)...)
+				continue
+			}
+			name, opts := tag, ""
+			if j := strings.Index(tag, ","); j >= 0 {
+				name, opts = tag[:j], tag[j:]
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = JSONSchemaOf(f.Type)
+			if !strings.Contains(opts, ",omitempty") && f.Type.Kind() != reflect.Ptr {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	}
+	// interface{}, like the parsed output, is any value.
+	return map[string]interface{}{}
+}
+
+// ResultSchema get the JSON schema of a command result, as written by CommandContext.MarshalJSON.
+func ResultSchema() map[string]interface{} {
+	schema := JSONSchemaOf(reflect.TypeOf(CommandContext{}))
+	for _, n := range []string{"duration", "wait_duration"} {
+		schema["properties"].(map[string]interface{})[n] = map[string]interface{}{"type": "integer", "description": "milliseconds"}
+	}
+	return schema
+}
+
+// OutputSchema get the JSON schema of the output file of the output format: the run metadata and the
+// results of json, the results array of legacy, or a result per line of jsonl.
+func OutputSchema(format string) map[string]interface{} {
+	var schema map[string]interface{}
+	switch format {
+	case "legacy":
+		schema = map[string]interface{}{"type": "array", "items": ResultSchema()}
+	case "jsonl":
+		schema = ResultSchema()
+		schema["description"] = "a line of the jsonl output"
+	default:
+		schema = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"metadata": JSONSchemaOf(reflect.TypeOf(RunMetadata{})),
+				"results":  map[string]interface{}{"type": "array", "items": ResultSchema()},
+			},
+			"required": []string{"metadata", "results"},
+		}
+	}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = fmt.Sprintf("f5-oslbaasv2-batchops %s output", format)
+	return schema
+}
+
+// PrintSchema print the JSON schema of the output file of --output-format.
+func PrintSchema() {
+	jd, _ := json.MarshalIndent(OutputSchema(outputFormat), "", "  ")
+	fmt.Println(string(jd))
+}
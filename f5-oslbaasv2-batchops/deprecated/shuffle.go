@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+)
+
+var (
+	shuffle     bool
+	shuffleSeed int64
+	seedSet     bool
+
+	// templatePositions the template positions of each generated command, in order.
+	templatePositions map[string][]int
+)
+
+// seedFlag set shuffleSeed, telling it is given.
+type seedFlag struct{}
+
+func (sf *seedFlag) String() string {
+	return ""
+}
+
+func (sf *seedFlag) Set(v string) error {
+	seed, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return err
+	}
+	shuffleSeed, seedSet = seed, true
+	return nil
+}
+
+// TemplatePositions map the commands to their 1-based positions in the template expansion order,
+// the duplicated ones to all their positions.
+func TemplatePositions(commands []string) map[string][]int {
+	positions := map[string][]int{}
+	for i, n := range commands {
+		positions[n] = append(positions[n], i+1)
+	}
+	return positions
+}
+
+// TemplatePosition take the next template position of the command, or 0 if unknown.
+func TemplatePosition(n string) int {
+	positions := templatePositions[n]
+	if len(positions) == 0 {
+		return 0
+	}
+	templatePositions[n] = positions[1:]
+	return positions[0]
+}
+
+// ShuffleCommands permute the commands in place, the same seed getting the same order.
+func ShuffleCommands(commands []string, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(commands), func(i, j int) {
+		commands[i], commands[j] = commands[j], commands[i]
+	})
+}
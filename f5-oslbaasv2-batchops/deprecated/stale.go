@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	stalePendingThreshold = 15 * time.Minute
+	ignoreStalePending    bool
+)
+
+// PendingAge get the provisioning status of the loadbalancer, and how long it has been in it when
+// --mysql-uri is given and the schema has the timestamps, 0 otherwise.
+func PendingAge(lb string) (string, time.Duration, error) {
+	status, err := LBStatus(context.Background(), lb)
+	if err != nil || !IsPending(status) || dbConn == nil {
+		return status, 0, err
+	}
+	id, err := dbSource().ID(lbaasSchema.LoadBalancerType, lb)
+	if err != nil {
+		return status, 0, err
+	}
+	rows, err := StuckObjectsFromDB(lbaasSchema.LoadBalancerType, id)
+	if err != nil {
+		return status, 0, err
+	}
+	for _, n := range rows {
+		if n.ID == id && n.UpdatedAt != nil {
+			return status, time.Since(*n.UpdatedAt), nil
+		}
+	}
+	return status, 0, nil
+}
+
+// CheckStalePending warn the loadbalancers of the batch pending longer than --stale-pending-threshold
+// before the batch starts, which would exhaust the status checks of the commands. Returns the error to
+// abort unless --ignore-stale-pending.
+func CheckStalePending(lbs []string) error {
+	stale := []string{}
+	for _, lb := range lbs {
+		status, age, err := PendingAge(lb)
+		if err != nil && status == "" {
+			// the loadbalancers to create in the batch are not found.
+			logDebug("Preflight: Failed to check loadbalancer %s status: %s", lb, err.Error())
+			continue
+		}
+		if err != nil {
+			logWarn("Preflight: Loadbalancer %s is %s, failed to get its update time: %s", lb, status, err.Error())
+			continue
+		}
+		if !IsPending(status) {
+			continue
+		}
+		if age == 0 && dbConn == nil {
+			logWarn("Preflight: Loadbalancer %s is %s, for an unknown time without --mysql-uri", lb, status)
+			continue
+		}
+		if age == 0 {
+			logWarn("Preflight: Loadbalancer %s is %s, for an unknown time without its update time in database", lb, status)
+			continue
+		}
+		if age < stalePendingThreshold {
+			logInfo("Preflight: Loadbalancer %s is %s for %s", lb, status, age.Round(time.Second))
+			continue
+		}
+		logger.Printf("%s", Colorize(colorRed, fmt.Sprintf("!!! Preflight: Loadbalancer %s has been %s for %s, longer than --stale-pending-threshold %s !!!",
+			lb, status, age.Round(time.Second), stalePendingThreshold)))
+		stale = append(stale, lb)
+	}
+	if len(stale) == 0 || ignoreStalePending {
+		return nil
+	}
+	return fmt.Errorf("loadbalancer(s) stuck in pending: %s. Fix them or add --ignore-stale-pending to proceed", strings.Join(stale, ", "))
+}
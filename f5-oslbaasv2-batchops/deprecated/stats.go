@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHistogramBuckets are the bounds of --command-stats-histogram-output, fixed for the trend
+// analysis across runs, and the default of --histogram-buckets.
+const defaultHistogramBuckets = "100ms,500ms,1s,5s,10s,30s,60s"
+
+var (
+	histogramOutput  string
+	histogramBuckets = defaultHistogramBuckets
+)
+
+// LatencyBucket is a histogram bucket of the durations below Upper.
+type LatencyBucket struct {
+	Name  string
+	Upper time.Duration
+}
+
+// latencyBuckets of the histograms in the report and summary, the last one is unbounded.
+// fixedLatencyBuckets of the histogram output are not changed by --histogram-buckets.
+var (
+	latencyBuckets, _      = ParseHistogramBuckets(histogramBuckets)
+	fixedLatencyBuckets, _ = ParseHistogramBuckets(defaultHistogramBuckets)
+)
+
+// ParseHistogramBuckets parse the increasing upper bounds of --histogram-buckets, like 1s,5s,10s, into the
+// buckets 0-1s, 1-5s, 5-10s and 10s+. The bounds are named in seconds if whole, in milliseconds otherwise.
+func ParseHistogramBuckets(s string) ([]LatencyBucket, error) {
+	buckets := []LatencyBucket{}
+	var lower time.Duration
+	for _, n := range strings.Split(s, ",") {
+		upper, err := time.ParseDuration(strings.TrimSpace(n))
+		if err != nil || upper <= lower {
+			return nil, fmt.Errorf("invalid bucket bound %s, expect increasing durations like 1s,5s,10s", n)
+		}
+		name := fmt.Sprintf("%d-%dms", lower.Milliseconds(), upper.Milliseconds())
+		if lower%time.Second == 0 && upper%time.Second == 0 {
+			name = fmt.Sprintf("%d-%ds", int64(lower.Seconds()), int64(upper.Seconds()))
+		}
+		buckets = append(buckets, LatencyBucket{name, upper})
+		lower = upper
+	}
+	name := fmt.Sprintf("%dms+", lower.Milliseconds())
+	if lower%time.Second == 0 {
+		name = fmt.Sprintf("%ds+", int64(lower.Seconds()))
+	}
+	return append(buckets, LatencyBucket{name, time.Duration(math.MaxInt64)}), nil
+}
+
+// BucketCount is the count of the durations in a bucket, below UpperMs, which is 0 for the last one.
+type BucketCount struct {
+	Name    string `json:"name"`
+	UpperMs int64  `json:"upper_ms,omitempty"`
+	Count   int    `json:"count"`
+}
+
+// LatencyHistogram is the latency distribution of a resource and operation type.
+type LatencyHistogram struct {
+	ResourceType  string        `json:"resource_type"`
+	OperationType string        `json:"operation_type"`
+	Count         int           `json:"count"`
+	Buckets       []BucketCount `json:"buckets"`
+	P50           int64         `json:"p50_ms"`
+	P95           int64         `json:"p95_ms"`
+	P99           int64         `json:"p99_ms"`
+
+	// with --neutron-command-profiling.
+	StartupP50 int64 `json:"startup_p50_ms,omitempty"`
+	StartupP95 int64 `json:"startup_p95_ms,omitempty"`
+	APICallP50 int64 `json:"api_call_p50_ms,omitempty"`
+	APICallP95 int64 `json:"api_call_p95_ms,omitempty"`
+
+	// the lbaas POST/PUT/DELETE call only, of the commands making one.
+	APILatencyP50 int64 `json:"api_latency_p50_ms,omitempty"`
+	APILatencyP95 int64 `json:"api_latency_p95_ms,omitempty"`
+}
+
+// Percentile get the nearest-rank percentile of the sorted durations.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// LatencyHistograms group the durations of executed commands by resource and operation type,
+// counted in the buckets in order.
+func LatencyHistograms(results []*CommandContext, buckets []LatencyBucket) []*LatencyHistogram {
+	durations := map[string][]time.Duration{}
+	startups := map[string][]time.Duration{}
+	apiCalls := map[string][]time.Duration{}
+	apiLatencies := map[string][]time.Duration{}
+	histograms := map[string]*LatencyHistogram{}
+	keys := []string{}
+	for _, n := range results {
+		if n.StartedAt.IsZero() {
+			continue
+		}
+		key := n.ResourceType + "-" + n.OperationType
+		h, ok := histograms[key]
+		if !ok {
+			h = &LatencyHistogram{ResourceType: n.ResourceType, OperationType: n.OperationType}
+			for i, b := range buckets {
+				h.Buckets = append(h.Buckets, BucketCount{Name: b.Name})
+				if i < len(buckets)-1 {
+					h.Buckets[i].UpperMs = b.Upper.Milliseconds()
+				}
+			}
+			histograms[key] = h
+			keys = append(keys, key)
+		}
+		h.Count++
+		for i, b := range buckets {
+			if n.Duration < b.Upper {
+				h.Buckets[i].Count++
+				break
+			}
+		}
+		durations[key] = append(durations[key], n.Duration)
+		startups[key] = append(startups[key], time.Duration(n.StartupMs)*time.Millisecond)
+		apiCalls[key] = append(apiCalls[key], time.Duration(n.APICallMs)*time.Millisecond)
+		if n.APILatencyMs > 0 {
+			apiLatencies[key] = append(apiLatencies[key], time.Duration(n.APILatencyMs)*time.Millisecond)
+		}
+	}
+
+	sort.Strings(keys)
+	rlt := []*LatencyHistogram{}
+	for _, key := range keys {
+		ds := durations[key]
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		h := histograms[key]
+		h.P50 = Percentile(ds, 50).Milliseconds()
+		h.P95 = Percentile(ds, 95).Milliseconds()
+		h.P99 = Percentile(ds, 99).Milliseconds()
+		if neutronProfiling {
+			for _, ps := range [][]time.Duration{startups[key], apiCalls[key]} {
+				sort.Slice(ps, func(i, j int) bool { return ps[i] < ps[j] })
+			}
+			h.StartupP50 = Percentile(startups[key], 50).Milliseconds()
+			h.StartupP95 = Percentile(startups[key], 95).Milliseconds()
+			h.APICallP50 = Percentile(apiCalls[key], 50).Milliseconds()
+			h.APICallP95 = Percentile(apiCalls[key], 95).Milliseconds()
+		}
+		als := apiLatencies[key]
+		sort.Slice(als, func(i, j int) bool { return als[i] < als[j] })
+		h.APILatencyP50 = Percentile(als, 50).Milliseconds()
+		h.APILatencyP95 = Percentile(als, 95).Milliseconds()
+		rlt = append(rlt, h)
+	}
+	return rlt
+}
+
+// PrintLatencyPercentiles print the percentiles of the command durations and of the lbaas API calls
+// by resource and operation type, telling the client slowness from the neutron-server and driver one.
+func PrintLatencyPercentiles() {
+	fmt.Println(Colorize(colorBold, "Latency Percentiles(ms):"))
+	fmt.Printf("%-24s %6s %8s %8s %8s %8s %8s\n", "RESOURCE-OPERATION", "COUNT", "P50", "P95", "P99", "API P50", "API P95")
+	for _, h := range LatencyHistograms(cmdResults.Sorted(), latencyBuckets) {
+		fmt.Printf("%-24s %6d %8d %8d %8d %8s %8s\n", h.ResourceType+"-"+h.OperationType, h.Count, h.P50, h.P95, h.P99,
+			msOrDash(h.APILatencyP50), msOrDash(h.APILatencyP95))
+	}
+}
+
+// msOrDash format the milliseconds, '-' for none.
+func msOrDash(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+// WriteHistogramOutput write the latency histograms to histogramOutput, in the fixed buckets.
+func WriteHistogramOutput() {
+	jd, _ := json.MarshalIndent(LatencyHistograms(cmdResults.Sorted(), fixedLatencyBuckets), "", "  ")
+	if err := ioutil.WriteFile(histogramOutput, jd, 0644); err != nil {
+		logger.Printf("Failed to write histogram file %s: %s", histogramOutput, err.Error())
+		return
+	}
+	logger.Printf("Writen latency histograms to file %s", histogramOutput)
+}
+
+// histogramBarWidth is the width of the longest bar of the histograms in the report.
+const histogramBarWidth = 40
+
+// PrintDurationHistograms print the histograms of the command durations by resource and operation type,
+// with the empty buckets too for the shape to be readable.
+func PrintDurationHistograms() {
+	fmt.Println(Colorize(colorBold, "Duration Histograms:"))
+	for _, h := range LatencyHistograms(cmdResults.Sorted(), latencyBuckets) {
+		fmt.Printf("%s-%s(%d):\n", h.ResourceType, h.OperationType, h.Count)
+		max := 0
+		for _, b := range h.Buckets {
+			if b.Count > max {
+				max = b.Count
+			}
+		}
+		for _, b := range h.Buckets {
+			fmt.Printf("  %12s %6d %s\n", b.Name, b.Count, strings.Repeat("#", (b.Count*histogramBarWidth+max-1)/max))
+		}
+	}
+}
+
+// HistogramCounts get the bucket counts of the histograms keyed by resource-operation, for the summary.
+func HistogramCounts(results []*CommandContext) map[string]map[string]int {
+	counts := map[string]map[string]int{}
+	for _, h := range LatencyHistograms(results, latencyBuckets) {
+		bc := map[string]int{}
+		for _, b := range h.Buckets {
+			bc[b.Name] = b.Count
+		}
+		counts[h.ResourceType+"-"+h.OperationType] = bc
+	}
+	return counts
+}
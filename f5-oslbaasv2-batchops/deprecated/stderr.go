@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+var stderrDir string
+
+// StderrFilePath is the file of the command's stderr in --neutron-command-stderr-dir.
+func (cmdctx *CommandContext) StderrFilePath() string {
+	return filepath.Join(stderrDir, fmt.Sprintf("cmd-%d-stderr.txt", cmdctx.Seq))
+}
+
+// WriteStderrFile write the stderr of the executed command to its own file.
+func (cmdctx *CommandContext) WriteStderrFile() {
+	if err := ioutil.WriteFile(cmdctx.StderrFilePath(), []byte(cmdctx.Stderr), 0644); err != nil {
+		logger.Printf("Command(%d/%d): Failed to write stderr file: %s", cmdctx.Seq, len(cmdList), err.Error())
+	}
+}
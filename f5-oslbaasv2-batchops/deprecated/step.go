@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	confirmBatch bool
+	stepMode     bool
+	// stepQuit is set when the user quits in --step mode, for the partial results to be written.
+	stepQuit bool
+
+	// previewCommands is the number of commands previewed by --confirm.
+	previewCommands = 10
+
+	stdinReader = bufio.NewReader(os.Stdin)
+)
+
+// ConfirmBatch print the count and a preview of the commands, and require the user to type yes.
+// Returns true if the user confirms.
+func ConfirmBatch() bool {
+	fmt.Printf("%d command(s) to run:\n", len(cmdList))
+	for i, n := range cmdList {
+		if i == previewCommands {
+			fmt.Printf("  ... %d more\n", len(cmdList)-previewCommands)
+			break
+		}
+		cmdctx := NewCommandContext(n)
+		fmt.Printf("  %d: %s | %s\n", i+1, cmdctx.Command, cmdctx.LoadBalancer)
+	}
+	fmt.Printf("Type yes to run: ")
+	answer, _ := stdinReader.ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
+
+// StepCommand show the command with the current status of its loadbalancer, and ask the user
+// to run, skip the command, or quit. Returns run, skip or quit.
+func StepCommand(cmdctx *CommandContext) string {
+	status := "-"
+	if cmdctx.LoadBalancer != "" {
+		s, err := LBStatus(context.Background(), cmdctx.LoadBalancer)
+		if err != nil {
+			s = "unknown: " + err.Error()
+		}
+		status = s
+	}
+	fmt.Printf("Command(%d/%d): %s\n", cmdctx.Seq, len(cmdList), cmdctx.Command)
+	fmt.Printf("  loadbalancer: %s, status: %s\n", cmdctx.LoadBalancer, status)
+	for {
+		fmt.Printf("[Enter] run, [s] skip, [q] quit: ")
+		answer, err := stdinReader.ReadString('\n')
+		if err != nil {
+			// stdin closed, nothing more can be confirmed.
+			return "quit"
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "":
+			return "run"
+		case "s":
+			return "skip"
+		case "q":
+			return "quit"
+		}
+	}
+}
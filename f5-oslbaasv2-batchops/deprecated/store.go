@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"f5-oslbaasv2-batchops/pkg/batch"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+var (
+	storeResults bool
+	resultsDSN   string
+	resultsDB    *gorm.DB = nil
+
+	reportSince string
+	reportUntil string
+)
+
+// ResultRecord is a command result persisted in the batchops_results table.
+type ResultRecord struct {
+	ID            uint   `gorm:"primaryKey"`
+	RunID         string `gorm:"size:32;index"`
+	Seq           int
+	Command       string `gorm:"type:text"`
+	ObjectID      string `gorm:"size:64"`
+	Output        string `gorm:"type:longtext"`
+	Error         string `gorm:"type:text"`
+	ExitCode      int
+	DurationMs    int64
+	WaitMs        int64
+	ResourceType  string `gorm:"size:32"`
+	OperationType string `gorm:"size:32"`
+	LoadBalancer  string `gorm:"size:255"`
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	CreatedAt     time.Time
+}
+
+// TableName keeps the results apart from the neutron tables.
+func (ResultRecord) TableName() string {
+	return "batchops_results"
+}
+
+// RunSummary is a past run found in the batchops_results table.
+type RunSummary struct {
+	RunID      string    `json:"run_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Commands   int       `json:"commands"`
+	Failures   int       `json:"failures"`
+}
+
+// OpenResultsDB connect the results database and migrate the results table.
+// The neutron database is used unless --results-db-dsn is given.
+func OpenResultsDB() error {
+	resultsDB = dbConn
+	if resultsDSN != "" {
+		conn, err := gorm.Open(mysql.Open(resultsDSN), &gorm.Config{})
+		if err != nil {
+			return MaskDSNError(err, resultsDSN)
+		}
+		resultsDB = conn
+	}
+	if resultsDB == nil {
+		return fmt.Errorf("--store-results, runs and report modes require --results-db-dsn or --mysql-uri")
+	}
+	return resultsDB.AutoMigrate(&ResultRecord{})
+}
+
+// StoreResult insert the command result, failures are logged only.
+func StoreResult(cmdctx *CommandContext) {
+	record := ResultRecord{
+		RunID:         runMeta.RunID,
+		Seq:           cmdctx.Seq,
+		Command:       cmdctx.Command,
+		ObjectID:      cmdctx.ObjectID,
+		Output:        cmdctx.RawOut,
+		Error:         cmdctx.Err,
+		ExitCode:      cmdctx.ExitCode,
+		DurationMs:    cmdctx.Duration.Milliseconds(),
+		WaitMs:        cmdctx.WaitDuration.Milliseconds(),
+		ResourceType:  cmdctx.ResourceType,
+		OperationType: cmdctx.OperationType,
+		LoadBalancer:  cmdctx.LoadBalancer,
+		StartedAt:     cmdctx.StartedAt,
+		FinishedAt:    cmdctx.FinishedAt,
+	}
+	if err := resultsDB.Create(&record).Error; err != nil {
+		logWarn("Command(%d/%d): Failed to store result: %s", cmdctx.Seq, len(cmdList), err.Error())
+	}
+}
+
+// CommandContext get the result as executed, for the report.
+func (r ResultRecord) CommandContext() *CommandContext {
+	return &CommandContext{CommandContext: batch.CommandContext{
+		Seq:           r.Seq,
+		Command:       r.Command,
+		ObjectID:      r.ObjectID,
+		RawOut:        r.Output,
+		Err:           r.Error,
+		ExitCode:      r.ExitCode,
+		Duration:      time.Duration(r.DurationMs) * time.Millisecond,
+		WaitDuration:  time.Duration(r.WaitMs) * time.Millisecond,
+		StartedAt:     r.StartedAt,
+		FinishedAt:    r.FinishedAt,
+		ResourceType:  r.ResourceType,
+		OperationType: r.OperationType,
+		LoadBalancer:  r.LoadBalancer,
+	}}
+}
+
+// ParseReportTime parse the bound of the report window: RFC3339, '2006-01-02 15:04:05',
+// '2006-01-02', or a duration before now like 24h.
+func ParseReportTime(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s, expect RFC3339, '2006-01-02 15:04:05', '2006-01-02' or a duration like 24h", s)
+}
+
+// ReportResults print the report of the stored results started in the --report-since and
+// --report-until window, without running anything, and write them to the output file.
+// Returns the exit code.
+func ReportResults() int {
+	defer outputFile.Close()
+
+	if err := OpenResultsDB(); err != nil {
+		logger.Printf("Failed to open results database: %s", err.Error())
+		return exitDB
+	}
+
+	query := resultsDB.Model(&ResultRecord{})
+	for _, n := range []struct {
+		value string
+		cond  string
+	}{{reportSince, "started_at >= ?"}, {reportUntil, "started_at <= ?"}} {
+		if n.value == "" {
+			continue
+		}
+		t, err := ParseReportTime(n.value)
+		if err != nil {
+			logger.Printf("%s", err.Error())
+			return 1
+		}
+		query = query.Where(n.cond, t)
+	}
+
+	records := []ResultRecord{}
+	if err := query.Order("started_at, run_id, seq").Find(&records).Error; err != nil {
+		logger.Printf("Failed to query results: %s", err.Error())
+		return 1
+	}
+	// a batch per run, the runs in the order they started.
+	runs := map[string][]*CommandContext{}
+	runIDs := []string{}
+	for _, r := range records {
+		if _, ok := runs[r.RunID]; !ok {
+			runIDs = append(runIDs, r.RunID)
+		}
+		runs[r.RunID] = append(runs[r.RunID], r.CommandContext())
+	}
+	for _, id := range runIDs {
+		cmdResults.AddBatch(runs[id])
+	}
+	logger.Printf("%20s: %d", "Results Found", cmdResults.Len())
+
+	PrintReport()
+
+	jd, _ := json.MarshalIndent(cmdResults.Sorted(), "", "  ")
+	if _, e := outputFile.WriteString(string(jd)); e != nil {
+		logger.Printf("Error happens while writing: %s", e.Error())
+		return 1
+	}
+	return 0
+}
+
+// ListRuns print the past runs stored in the results table and write them to the output file.
+// Returns the exit code.
+func ListRuns() int {
+	defer outputFile.Close()
+
+	if err := OpenResultsDB(); err != nil {
+		logger.Printf("Failed to open results database: %s", err.Error())
+		return exitDB
+	}
+
+	runs := []RunSummary{}
+	err := resultsDB.Model(&ResultRecord{}).
+		Select("run_id, MIN(started_at) AS started_at, MAX(finished_at) AS finished_at, " +
+			"COUNT(*) AS commands, SUM(CASE WHEN exit_code <> 0 THEN 1 ELSE 0 END) AS failures").
+		Group("run_id").Order("started_at DESC").Scan(&runs).Error
+	if err != nil {
+		logger.Printf("Failed to list runs: %s", err.Error())
+		return 1
+	}
+
+	fmt.Println()
+	fmt.Printf("%-16s %-23s %-23s %8s %8s\n", "RUN ID", "STARTED", "FINISHED", "COMMANDS", "FAILURES")
+	for _, n := range runs {
+		fmt.Printf("%-16s %-23s %-23s %8d %8d\n", n.RunID,
+			n.StartedAt.Format("2006-01-02 15:04:05.000"), n.FinishedAt.Format("2006-01-02 15:04:05.000"),
+			n.Commands, n.Failures)
+	}
+	fmt.Println()
+
+	jd, _ := json.MarshalIndent(runs, "", "  ")
+	if _, e := outputFile.WriteString(string(jd)); e != nil {
+		logger.Printf("Error happens while writing: %s", e.Error())
+		return 1
+	}
+	return 0
+}
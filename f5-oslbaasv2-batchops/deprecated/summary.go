@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+var summaryFilePath string
+
+// Summary is the compact aggregate of a run, without the outputs of the commands.
+type Summary struct {
+	RunID      string          `json:"run_id"`
+	Total      int             `json:"total"`
+	Succeeded  int             `json:"succeeded"`
+	Failed     int             `json:"failed"`
+	DurationMs int64           `json:"duration"`
+	Failures   []FailedCommand `json:"failures"`
+	// WaitDurationMs is the total time waiting for ready, ExecutionDurationMs the total time executing the commands.
+	WaitDurationMs      int64 `json:"wait_duration"`
+	ExecutionDurationMs int64 `json:"execution_duration"`
+	// Histogram is the duration bucket counts by resource-operation.
+	Histogram map[string]map[string]int `json:"histogram"`
+	// LoadBalancers is the breakdown by loadbalancer, the problem ones first.
+	LoadBalancers []*LoadBalancerStats `json:"loadbalancers"`
+}
+
+// FailedCommand is a command exited non-zero or failing the --check-done verification.
+type FailedCommand struct {
+	Seq      int    `json:"seq"`
+	Command  string `json:"command"`
+	ExitCode int    `json:"exitcode"`
+	Error    string `json:"error"`
+}
+
+// NewSummary count the results, commands not ready to run are failures as in the report.
+func NewSummary(results []*CommandContext) *Summary {
+	summary := &Summary{RunID: runMeta.RunID, Total: len(results), Failures: []FailedCommand{}}
+	finishedAt := runMeta.FinishedAt
+	if finishedAt.IsZero() {
+		finishedAt = time.Now()
+	}
+	summary.DurationMs = finishedAt.Sub(runMeta.StartedAt).Milliseconds()
+
+	for _, n := range results {
+		if n.ExitCode == 0 && n.CheckErr == "" {
+			summary.Succeeded++
+			continue
+		}
+		errmsg := n.Err
+		if n.ExitCode == 0 {
+			errmsg = n.CheckErr
+		}
+		summary.Failures = append(summary.Failures, FailedCommand{n.Seq, n.Command, n.ExitCode, errmsg})
+	}
+	summary.Failed = len(summary.Failures)
+	wait, execution := WaitTotals(results)
+	summary.WaitDurationMs, summary.ExecutionDurationMs = wait.Milliseconds(), execution.Milliseconds()
+	summary.Histogram = HistogramCounts(results)
+	summary.LoadBalancers = LoadBalancerBreakdown(results)
+	return summary
+}
+
+// WriteSummary write the summary of the results to summaryFilePath.
+func WriteSummary() {
+	jd, _ := json.MarshalIndent(NewSummary(cmdResults.Sorted()), "", "  ")
+	if err := ioutil.WriteFile(summaryFilePath, append(jd, '\n'), 0644); err != nil {
+		logger.Printf("Failed to write summary %s: %s", summaryFilePath, err.Error())
+		return
+	}
+	logger.Printf("Writen summary to file %s", summaryFilePath)
+}
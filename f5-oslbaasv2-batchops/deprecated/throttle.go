@@ -0,0 +1,78 @@
+package main
+
+import (
+	"time"
+)
+
+var (
+	adaptiveThrottle  bool
+	throttleMaxDelay  = time.Minute
+	throttleStep      = time.Second
+	throttleSuccesses = 10
+
+	// throttle paces the commands when --adaptive-throttle, nil otherwise.
+	throttle *Throttle
+)
+
+// Throttle is an AIMD controller of the inter-command delay: the delay doubles on each rate-limited
+// execution, up to Max, and decreases by Step after Successes executions in a row, down to Base.
+type Throttle struct {
+	Base      time.Duration
+	Max       time.Duration
+	Step      time.Duration
+	Successes int
+
+	Delay  time.Duration
+	streak int
+}
+
+// NewThrottle create the throttle starting at the base delay.
+func NewThrottle(base time.Duration, max time.Duration, step time.Duration, successes int) *Throttle {
+	if max < base {
+		max = base
+	}
+	return &Throttle{Base: base, Max: max, Step: step, Successes: successes, Delay: base}
+}
+
+// Observe adjust the delay by the execution of the command. The failures other than RateLimited
+// neither slow down nor count as successes.
+func (t *Throttle) Observe(cmdctx *CommandContext) {
+	if t == nil {
+		return
+	}
+	switch {
+	case cmdctx.ExitCode > 0 && cmdctx.FailureClass == "RateLimited":
+		t.streak = 0
+		delay := t.Delay * 2
+		if delay < t.Step {
+			delay = t.Step
+		}
+		if delay > t.Max {
+			delay = t.Max
+		}
+		if delay != t.Delay {
+			logWarn("Command(%d/%d): Rate limited, inter-command delay %s -> %s", cmdctx.Seq, len(cmdList), t.Delay, delay)
+			t.Delay = delay
+		}
+	case cmdctx.ExitCode == 0:
+		t.streak++
+		if t.streak < t.Successes || t.Delay == t.Base {
+			return
+		}
+		t.streak = 0
+		delay := t.Delay - t.Step
+		if delay < t.Base {
+			delay = t.Base
+		}
+		logInfo("Command(%d/%d): %d successes, inter-command delay %s -> %s", cmdctx.Seq, len(cmdList), t.Successes, t.Delay, delay)
+		t.Delay = delay
+	}
+}
+
+// InterCommandDelay get the delay after each command, the throttled one with --adaptive-throttle.
+func InterCommandDelay() time.Duration {
+	if throttle == nil {
+		return interCommandDelay
+	}
+	return throttle.Delay
+}
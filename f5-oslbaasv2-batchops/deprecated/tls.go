@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	neutronInsecure bool
+	neutronCACert   string
+)
+
+// NeutronTLSArgs are the global options of the neutron client for --neutron-insecure and --neutron-cacert.
+func NeutronTLSArgs() []string {
+	args := []string{}
+	if neutronInsecure {
+		args = append(args, "--insecure")
+	}
+	if neutronCACert != "" {
+		args = append(args, "--os-cacert", neutronCACert)
+	}
+	return args
+}
+
+// NeutronTLSConfig is the TLS of the calls to the OpenStack endpoints, verified with --neutron-cacert
+// or not at all with --neutron-insecure. Returns nil for the system defaults.
+func NeutronTLSConfig() (*tls.Config, error) {
+	if !neutronInsecure && neutronCACert == "" {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: neutronInsecure}
+	if neutronCACert != "" {
+		data, err := ioutil.ReadFile(neutronCACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificate found in %s", neutronCACert)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// NeutronTransport is the transport of the http clients calling the OpenStack endpoints.
+func NeutronTransport() http.RoundTripper {
+	config, _ := NeutronTLSConfig()
+	if config == nil {
+		return http.DefaultTransport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return transport
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+var (
+	unstickLB        string
+	unstickStatus    = "ACTIVE"
+	unstickMinAge    = time.Hour
+	unstickConfirmed bool
+)
+
+// UnstickRecord is the loadbalancer state before and after unstick.
+type UnstickRecord struct {
+	ID           string       `json:"id"`
+	Before       *StuckObject `json:"before"`
+	After        *StuckObject `json:"after"`
+	RowsAffected int64        `json:"rows_affected"`
+}
+
+// UnstickLoadbalancer reset the provisioning status of a loadbalancer stuck in PENDING_*.
+// Returns the exit code.
+func UnstickLoadbalancer() int {
+	defer outputFile.Close()
+
+	if dbConn == nil {
+		logger.Printf("unstick mode requires --mysql-uri")
+		return 1
+	}
+	if unstickLB == "" {
+		logger.Printf("unstick mode requires --unstick-lb")
+		return 1
+	}
+	if unstickStatus != "ACTIVE" && unstickStatus != "ERROR" {
+		logger.Printf("Invalid --unstick-status %s, should be ACTIVE or ERROR", unstickStatus)
+		return 1
+	}
+	if !unstickConfirmed {
+		logger.Printf("unstick mode updates neutron database directly, add --i-know-what-i-am-doing to proceed")
+		return 1
+	}
+
+	lbID, err := dbSource().ID(lbaasSchema.LoadBalancerType, unstickLB)
+	if err != nil {
+		logger.Printf("Failed to find loadbalancer %s: %s", unstickLB, err.Error())
+		return 1
+	}
+
+	before, err := unstickLBState(lbID)
+	if err != nil {
+		logger.Printf("Failed to get loadbalancer %s state: %s", lbID, err.Error())
+		return 1
+	}
+	record := UnstickRecord{ID: lbID, Before: before}
+	defer func() {
+		jd, _ := json.MarshalIndent(record, "", "  ")
+		if _, e := outputFile.WriteString(string(jd)); e != nil {
+			logger.Printf("Error happens while writing: %s", e.Error())
+		}
+	}()
+
+	if before == nil {
+		logger.Printf("Loadbalancer %s is not PENDING, nothing to do", lbID)
+		return 1
+	}
+	if before.UpdatedAt == nil {
+		logger.Printf("Loadbalancer %s has no update time in database, refuse to reset it", lbID)
+		return 1
+	}
+	if age := time.Since(*before.UpdatedAt); age < unstickMinAge {
+		logger.Printf("Loadbalancer %s is %s for %s, newer than %s, refuse to reset it",
+			lbID, before.ProvisioningStatus, age.Round(time.Second), unstickMinAge)
+		return 1
+	}
+
+	rlt := dbConn.Table(lbaasSchema.Tables["loadbalancer"]).
+		Where("id = ? AND provisioning_status = ?", lbID, before.ProvisioningStatus).
+		Update("provisioning_status", unstickStatus)
+	if rlt.Error != nil {
+		logger.Printf("Failed to reset loadbalancer %s: %s", lbID, rlt.Error.Error())
+		return 1
+	}
+	record.RowsAffected = rlt.RowsAffected
+	logger.Printf("Updated %d row(s) in %s: id=%s provisioning_status %s -> %s",
+		rlt.RowsAffected, lbaasSchema.Tables["loadbalancer"], lbID, before.ProvisioningStatus, unstickStatus)
+
+	status, err := dbSource().StatusOf("loadbalancer", lbID, true)
+	if err != nil {
+		logger.Printf("Failed to get loadbalancer %s state after reset: %s", lbID, err.Error())
+		return 1
+	}
+	after := *before
+	after.ProvisioningStatus = status
+	record.After = &after
+
+	if rlt.RowsAffected != 1 {
+		return 1
+	}
+	return 0
+}
+
+// unstickLBState get the loadbalancer from database if it is PENDING_*, or nil.
+func unstickLBState(lbID string) (*StuckObject, error) {
+	rows, err := StuckObjectsFromDB("loadbalancer", lbID)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range rows {
+		if strings.HasPrefix(n.ProvisioningStatus, "PENDING_") {
+			return &n, nil
+		}
+	}
+	return nil, nil
+}
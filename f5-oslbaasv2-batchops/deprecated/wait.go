@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"f5-oslbaasv2-batchops/pkg/batch"
+)
+
+var (
+	waitOverrideFlags StringsFlag
+	checkInterval     = time.Second
+
+	// waitOverrides the check budgets by resource-operation, like loadbalancer-create.
+	waitOverrides = map[string]batch.WaitBudget{}
+	// waitOperations are the operations waited for, before and after running.
+	waitOperations = []string{"create", "update", "delete"}
+
+	// pendingStates are the transitional statuses to keep waiting, from --pending-states.
+	pendingStates           = StringArray{"PENDING_CREATE", "PENDING_UPDATE", "PENDING_DELETE"}
+	pendingStatesFlag       = strings.Join(pendingStates, ",")
+	pendingStatesIgnoreCase bool
+
+	// waitWarnRatio warns the commands waited for ready longer than this times their duration, from --wait-warn-ratio.
+	waitWarnRatio float64 = 10
+)
+
+// WaitOverrideKeys get the valid resource-operation keys of --wait-override, sorted.
+func WaitOverrideKeys() []string {
+	keys := []string{}
+	for resourceType := range lbaasSchema.Tables {
+		for _, op := range waitOperations {
+			keys = append(keys, resourceType+"-"+op)
+		}
+	}
+	if lbaasAPIVersion == "v2" {
+		for _, op := range waitOperations {
+			keys = append(keys, "l7rule-"+op)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseWaitOverride parse resource-operation=times[:interval] of --wait-override, like
+// loadbalancer-create=300 or member-update=30:500ms. The interval defaults to --check-interval.
+func ParseWaitOverride(s string) (string, batch.WaitBudget, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return "", batch.WaitBudget{}, fmt.Errorf("invalid wait override %s, expect resource-operation=times[:interval]", s)
+	}
+	if StringArray(WaitOverrideKeys()).IndexOf(kv[0]) == -1 {
+		return "", batch.WaitBudget{}, fmt.Errorf("unknown key %s, should be one of %s", kv[0], strings.Join(WaitOverrideKeys(), ", "))
+	}
+	ti := strings.SplitN(kv[1], ":", 2)
+	budget := batch.WaitBudget{Interval: checkInterval}
+	times, err := strconv.Atoi(ti[0])
+	if err != nil || times <= 0 {
+		return "", budget, fmt.Errorf("invalid times %s of %s, expect a positive integer", ti[0], kv[0])
+	}
+	budget.Times = times
+	if len(ti) == 2 {
+		interval, err := time.ParseDuration(ti[1])
+		if err != nil || interval < 0 {
+			return "", budget, fmt.Errorf("invalid interval %s of %s, expect a duration like 2s", ti[1], kv[0])
+		}
+		budget.Interval = interval
+	}
+	return kv[0], budget, nil
+}
+
+// WaitBudget get the check budget of the command, --max-check-times and --check-interval
+// unless overridden for its resource and operation.
+func (cmdctx *CommandContext) WaitBudget() batch.WaitBudget {
+	if budget, ok := waitOverrides[cmdctx.ResourceType+"-"+cmdctx.OperationType]; ok {
+		return budget
+	}
+	return batch.WaitBudget{Times: maxCheckTimes, Interval: checkInterval}
+}
+
+// ParsePendingStates parse the comma separated statuses of --pending-states.
+func ParsePendingStates(s string) (StringArray, error) {
+	states := StringArray{}
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			states = append(states, n)
+		}
+	}
+	if len(states) == 0 {
+		return nil, fmt.Errorf("no status given")
+	}
+	return states, nil
+}
+
+// IsPending tells the status is transitional, to keep waiting. Case-insensitive with --pending-states-ignore-case.
+func IsPending(status string) bool {
+	for _, n := range pendingStates {
+		if n == status || pendingStatesIgnoreCase && strings.EqualFold(n, status) {
+			return true
+		}
+	}
+	return false
+}
+
+// WarnLongWait warn the command waited for ready longer than --wait-warn-ratio times its duration,
+// likely serialized behind the other commands of the loadbalancer.
+func (cmdctx *CommandContext) WarnLongWait() {
+	if waitWarnRatio <= 0 || cmdctx.Duration <= 0 || cmdctx.WaitDuration <= time.Duration(float64(cmdctx.Duration)*waitWarnRatio) {
+		return
+	}
+	logWarn("Command(%d/%d): Waited %s for ready, %.1f times the command duration %s",
+		cmdctx.Seq, len(cmdList), cmdctx.WaitDuration.Round(time.Millisecond),
+		float64(cmdctx.WaitDuration)/float64(cmdctx.Duration), cmdctx.Duration.Round(time.Millisecond))
+}
+
+// WaitTotals sum the time waiting for ready and the time executing of the results.
+func WaitTotals(results []*CommandContext) (wait time.Duration, execution time.Duration) {
+	for _, n := range results {
+		wait += n.WaitDuration
+		execution += n.Duration
+	}
+	return wait, execution
+}